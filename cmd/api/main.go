@@ -3,53 +3,244 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
-	"os/signal"
-	"syscall"
-	"time"
+	"os"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/api"
 	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	domainproduct "github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
 	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/ratelimit"
 	"github.com/ftfmtavares/shipping-optimizer/internal/repositories"
 	"github.com/ftfmtavares/shipping-optimizer/internal/server"
 	"github.com/ftfmtavares/shipping-optimizer/internal/services/order"
 	"github.com/ftfmtavares/shipping-optimizer/internal/services/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/services/stock"
 )
 
 func main() {
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// the configured logger can't be built without a configuration, so the default one is used
+		instrumentation.NewLogger(instrumentation.LoggerConfig{}).Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger := instrumentation.NewLogger(instrumentation.LoggerConfig{
+		Format: cfg.LogFormat,
+		Level:  cfg.LogLevel,
+	})
+	if cfg.PrintConfig {
+		err = config.Print(os.Stdout, cfg)
+		if err != nil {
+			logger.Error("Failed to print configuration", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	cfg := config.InitConfig()
 	server := server.NewHTTPServer(server.HTTPServerConfig{
-		Address:      cfg.ServerAddress,
-		Port:         cfg.ServerPort,
-		ReadTimeout:  time.Second * 30,
-		WriteTimeout: time.Second * 30,
-		IdleTimeout:  time.Second * 30,
-		Logger:       instrumentation.NewLogger(),
+		Address:         cfg.ServerAddress,
+		Port:            cfg.ServerPort,
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		IdleTimeout:     cfg.IdleTimeout,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		Logger:          logger,
 	})
 
-	servicesRegistration(ctx, &server)
-	staticWeb(&server)
+	err = server.WithOpenAPI(api.OpenAPI)
+	if err != nil {
+		logger.Error("Invalid OpenAPI document", "error", err)
+		os.Exit(1)
+	}
+
+	targets, err := servicesRegistration(cfg, &server, logger)
+	if err != nil {
+		logger.Error("Services registration failed", "error", err)
+		os.Exit(1)
+	}
+	err = seedCatalogue(cfg.SeedFile, targets.catalogue, logger)
+	if err != nil {
+		logger.Error("Seed catalogue import failed", "file", cfg.SeedFile, "error", err)
+		os.Exit(1)
+	}
+
+	// predefined routes are added before the static web one, which serves every other path
 	server.WithHealthCheck()
+	server.WithMetrics()
+	staticWeb(cfg, &server)
+
+	// the reloadable settings are applied on SIGHUP and whenever the config or seed files change
+	configReloader := &reloader{
+		load: func() (config.Config, error) {
+			return config.Load(os.Args[1:], os.Getenv)
+		},
+		current: cfg,
+		targets: targets,
+	}
+	server.WithReload(configReloader.reload)
+	if cfg.ConfigFile != "" {
+		go config.WatchFile(context.Background(), cfg.ConfigFile, configWatchInterval, configReloader.reload)
+	}
+	if cfg.SeedFile != "" {
+		go config.WatchFile(context.Background(), cfg.SeedFile, configWatchInterval, configReloader.reload)
+	}
 
 	server.StartHTTPServerAsync()
 	server.WithShutdownGracefully()
 }
 
-func servicesRegistration(ctx context.Context, server *server.HTTPServer) {
-	rep := repositories.NewAPIRepositories()
+// servicesRegistration registers every service route, returning the services whose settings can be reloaded
+// invalid storage or credentials settings fail the registration
+func servicesRegistration(cfg config.Config, server *server.HTTPServer, logger instrumentation.Logger) (reloadTargets, error) {
+	rep, err := repositories.NewAPIRepositories(cfg, logger)
+	if err != nil {
+		return reloadTargets{}, fmt.Errorf("invalid storage: %w", err)
+	}
+
+	metrics := server.Metrics()
+	metrics.NewGaugeFunc("shipping_optimizer_configured_products", "Number of products with package sizes configured.", func() float64 {
+		return float64(rep.PackSizes.Count())
+	})
+
+	authenticator, err := newAuthenticator(cfg, logger)
+	if err != nil {
+		return reloadTargets{}, err
+	}
+	if authenticator != nil {
+		server.WithAuthenticator(authenticator)
+		server.WithServiceHandler("/auth/keys", auth.Admin, api.APIKeys(authenticator), http.MethodOptions, http.MethodGet)
+		server.WithServiceHandler("/auth/keys", auth.Admin, api.CreateAPIKey(authenticator), http.MethodOptions, http.MethodPost)
+		server.WithServiceHandler("/auth/keys/{id}", auth.Admin, api.DeleteAPIKey(authenticator), http.MethodOptions, http.MethodDelete)
+	}
+
+	// the rate limit is always set, so that it can be enabled by reloading the configuration
+	rateLimit := ratelimit.NewBuckets(cfg.RateLimit, cfg.RateBurst)
+	server.WithRateLimit(rateLimit)
 
-	shippingOptimizer := order.NewOptimizer(rep.PackSizes)
-	server.WithServiceHandler("/product/{pid}/shipping-calculation", api.OrderCalculation(ctx, shippingOptimizer), http.MethodOptions, http.MethodGet)
+	shippingOptimizer := order.NewOptimizer(rep.PackSizes, rep.Stock).WithRecorder(instrumentation.NewCalculationMetrics(metrics))
+	recommender := order.NewRecommender(rep.PackSizes)
+	comparator := order.NewComparator(rep.PackSizes)
+	if cfg.SolverCapacity > 0 {
+		solverCapacity := ratelimit.NewSemaphore(cfg.SolverCapacity)
+		metrics.NewGaugeFunc("shipping_optimizer_solver_units_in_use", "Solver table entries allocated by concurrent calculations.", func() float64 {
+			return float64(solverCapacity.InUse())
+		})
+		shippingOptimizer = shippingOptimizer.WithLimiter(solverCapacity)
+		recommender = recommender.WithLimiter(solverCapacity)
+		comparator = comparator.WithLimiter(solverCapacity)
+	}
 
 	productConfigurator := product.NewConfigurator(rep.PackSizes)
-	server.WithServiceHandler("/product/{pid}/packsizes", api.ProductPackSizes(ctx, productConfigurator), http.MethodOptions, http.MethodGet)
-	server.WithServiceHandler("/product/{pid}/packsizes", api.StoreProductPackSizes(ctx, productConfigurator), http.MethodOptions, http.MethodPost)
+	if cfg.CacheSize > 0 {
+		cache := order.NewCache(cfg.CacheSize, cfg.SolverCacheSize)
+		metrics.NewCounterFunc("shipping_optimizer_cache_hits_total", "Shipping calculations served from the cache.", func() float64 {
+			return float64(cache.Stats().Hits)
+		})
+		metrics.NewCounterFunc("shipping_optimizer_cache_misses_total", "Shipping calculations not found in the cache.", func() float64 {
+			return float64(cache.Stats().Misses)
+		})
+		metrics.NewGaugeFunc("shipping_optimizer_cache_entries", "Shipping calculations held in the cache.", func() float64 {
+			return float64(cache.Stats().Entries)
+		})
+		shippingOptimizer = shippingOptimizer.WithCache(cache)
+		productConfigurator = productConfigurator.WithInvalidator(cache)
+	}
+	orderLimit := api.NewOrderLimit(cfg.MaxOrder)
+	server.WithServiceHandler("/product/{pid}/shipping-calculation", auth.Viewer, api.OrderCalculation(shippingOptimizer, orderLimit, cfg.CalculationTimeout), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/product/{pid}/shipping-calculation/range", auth.Viewer, api.ShippingCalculationRange(shippingOptimizer, orderLimit), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/orders/shipping-calculation", auth.Viewer, api.OrdersCalculation(shippingOptimizer, orderLimit, cfg.OrdersCalculationTimeout), http.MethodOptions, http.MethodPost)
+
+	server.WithServiceHandler("/product/{pid}/packsizes", auth.Viewer, api.ProductPackSizes(productConfigurator), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/product/{pid}/packsizes", auth.Editor, api.StoreProductPackSizes(productConfigurator), http.MethodOptions, http.MethodPost)
+	server.WithServiceHandler("/product/{pid}/packsizes", auth.Editor, api.DeleteProductPackSizes(productConfigurator), http.MethodOptions, http.MethodDelete)
+	server.WithServiceHandler("/product/{pid}/packsizes/history", auth.Viewer, api.ProductPackSizesHistory(productConfigurator), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/product/{pid}/packsizes/analysis", auth.Viewer, api.PackSizesAnalysis(shippingOptimizer, cfg.CalculationTimeout), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/product/{pid}/packsizes/recommend", auth.Viewer, api.RecommendPackSizes(recommender, cfg.RecommendationTimeout), http.MethodOptions, http.MethodPost)
+	server.WithServiceHandler("/product/{pid}/packsizes/compare", auth.Viewer, api.ComparePackSizes(comparator, cfg.OrdersCalculationTimeout), http.MethodOptions, http.MethodPost)
+	server.WithServiceHandler("/product/{pid}/packsizes/versions/{version}", auth.Viewer, api.ProductPackSizesVersion(productConfigurator), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/product/{pid}/packsizes/versions/{version}/restore", auth.Editor, api.RestoreProductPackSizes(productConfigurator), http.MethodOptions, http.MethodPost)
+	server.WithServiceHandler("/products", auth.Viewer, api.ListProducts(productConfigurator), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/products/export", auth.Viewer, api.ExportProducts(productConfigurator), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/products/import", auth.Editor, api.ImportProducts(productConfigurator), http.MethodOptions, http.MethodPost)
+
+	stockInventory := stock.NewInventory(rep.Stock)
+	server.WithServiceHandler("/product/{pid}/stock", auth.Viewer, api.ProductStock(stockInventory), http.MethodOptions, http.MethodGet)
+	server.WithServiceHandler("/product/{pid}/stock", auth.Editor, api.SetProductStock(stockInventory), http.MethodOptions, http.MethodPut)
+	server.WithServiceHandler("/product/{pid}/stock/decrement", auth.Editor, api.DecrementProductStock(stockInventory), http.MethodOptions, http.MethodPost)
+
+	return reloadTargets{
+		logger:     logger,
+		rateLimit:  rateLimit,
+		orderLimit: orderLimit,
+		catalogue:  productConfigurator,
+	}, nil
 }
 
-func staticWeb(server *server.HTTPServer) {
-	server.WithStatic("/", "web")
+// seedCatalogue imports a seed catalogue file, if there is one, products already configured the same being left unchanged
+// every product that can't be stored is logged, the import failing once the other ones are imported
+func seedCatalogue(path string, catalogue api.Catalogue, logger instrumentation.Logger) error {
+	if path == "" {
+		return nil
+	}
+
+	products, err := api.LoadCatalogue(path)
+	if err != nil {
+		return err
+	}
+
+	logger = logger.With("seed_file", path)
+	failed := 0
+	for _, result := range catalogue.Import(instrumentation.WithLogger(context.Background(), logger), products, "seed", false) {
+		if result.Status == domainproduct.ImportFailed {
+			failed++
+			logger.Error("Seed product import failed", "pid", result.PID, "error", result.Err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d products not stored", failed, len(products))
+	}
+
+	return nil
+}
+
+// newAuthenticator initializes the authenticator of the configured credentials, or none when there are no credentials
+func newAuthenticator(cfg config.Config, logger instrumentation.Logger) (*server.Authenticator, error) {
+	if !cfg.AuthEnabled() {
+		logger.Warning("No credentials configured, authentication disabled")
+		return nil, nil
+	}
+
+	keys := make([]server.APIKey, len(cfg.APIKeys))
+	for i, key := range cfg.APIKeys {
+		keys[i] = server.APIKey{ID: key.ID, Role: key.Role, Key: key.Key}
+	}
+
+	authenticator, err := server.NewAuthenticator(server.AuthConfig{
+		Keys:      keys,
+		KeysFile:  cfg.APIKeysFile,
+		JWTSecret: cfg.JWTSecret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials: %w", err)
+	}
+
+	return authenticator, nil
+}
+
+// staticWeb serves the demonstration UI from the configured directory, unless none is configured
+func staticWeb(cfg config.Config, server *server.HTTPServer) {
+	if cfg.StaticDir == "" {
+		return
+	}
+
+	server.WithStatic("/", cfg.StaticDir)
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/api"
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServicesRegistration(t *testing.T) {
+	s := server.NewHTTPServer(server.HTTPServerConfig{
+		Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{}),
+	})
+	assert.NoError(t, s.WithOpenAPI(api.OpenAPI))
+
+	// credentials are configured so that the key management routes are registered as well
+	_, err := servicesRegistration(config.Config{StorageBackend: config.MemoryStorage, JWTSecret: "secret"}, &s, instrumentation.NewLogger(instrumentation.LoggerConfig{}))
+	assert.NoError(t, err)
+
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(api.OpenAPI, &spec))
+
+	routes := s.Routes()
+	assert.NotEmpty(t, routes)
+	for _, route := range routes {
+		assert.NotEqual(t, auth.Public, route.Role, "route %s doesn't require any role", route.Path)
+
+		for _, method := range route.Methods {
+			if method == http.MethodOptions {
+				continue
+			}
+
+			_, found := spec.Paths[route.Path][strings.ToLower(method)]
+			assert.True(t, found, "route %s %s missing from the OpenAPI document", method, route.Path)
+		}
+	}
+}
+
+// mockCatalogue imports every product but the unavailable one, recording the imported ones
+type mockCatalogue struct {
+	imported    *[]product.Product
+	unavailable int
+}
+
+func (m mockCatalogue) List(ctx context.Context, after, limit int) ([]product.Product, int) {
+	return nil, 0
+}
+
+func (m mockCatalogue) Export(ctx context.Context) []product.Product {
+	return nil
+}
+
+func (m mockCatalogue) Import(ctx context.Context, products []product.Product, caller string, dryRun bool) []product.ImportResult {
+	results := make([]product.ImportResult, len(products))
+	for i, prd := range products {
+		if prd.PID == m.unavailable {
+			results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportFailed, Err: product.ErrStorageUnavailable}
+			continue
+		}
+		*m.imported = append(*m.imported, prd)
+		results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportStored, Version: 1}
+	}
+	return results
+}
+
+func TestServicesRegistrationInvalidCredentials(t *testing.T) {
+	s := server.NewHTTPServer(server.HTTPServerConfig{
+		Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{}),
+	})
+
+	cfg := config.Config{StorageBackend: config.MemoryStorage, APIKeys: []config.APIKey{{ID: "ci", Role: auth.Viewer}}}
+	_, err := servicesRegistration(cfg, &s, instrumentation.NewLogger(instrumentation.LoggerConfig{}))
+	assert.EqualError(t, err, `invalid credentials: invalid static api key "ci"`)
+}
+
+func TestSeedCatalogue(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		content       string
+		unavailable   int
+		expected      []product.Product
+		expectedError string
+		expectedLogs  []string
+	}{
+		{
+			desc:     "seed imported",
+			content:  `[{"pid":1,"packs":[5,10]},{"pid":2,"packs":[23]}]`,
+			expected: []product.Product{{PID: 1, Packs: []int{5, 10}}, {PID: 2, Packs: []int{23}}},
+		},
+		{
+			desc:          "invalid row",
+			content:       `[{"pid":1,"packs":[5,10]},{"pid":2,"packs":[0]}]`,
+			expectedError: "row 2: pack sizes must be positive integers",
+		},
+		{
+			desc:          "product not stored",
+			content:       `[{"pid":1,"packs":[5,10]},{"pid":2,"packs":[23]}]`,
+			unavailable:   1,
+			expected:      []product.Product{{PID: 2, Packs: []int{23}}},
+			expectedError: "1 of 2 products not stored",
+			expectedLogs:  []string{`level=ERROR msg="Seed product import failed" seed_file=`, `pid=1 error="storage unavailable"`},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "seed.json")
+			assert.NoError(t, os.WriteFile(path, []byte(tC.content), 0o644))
+			var (
+				buf      bytes.Buffer
+				imported []product.Product
+			)
+
+			err := seedCatalogue(path, mockCatalogue{imported: &imported, unavailable: tC.unavailable}, instrumentation.NewLogger(instrumentation.LoggerConfig{Output: &buf}))
+
+			if tC.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tC.expectedError)
+			}
+			assert.Equal(t, tC.expected, imported)
+			for _, log := range tC.expectedLogs {
+				assert.Contains(t, buf.String(), log)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/api"
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/ratelimit"
+)
+
+// configWatchInterval is how often the config file is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// reloadTargets holds the services whose settings can be changed while the server is running
+type reloadTargets struct {
+	logger     instrumentation.Logger
+	rateLimit  *ratelimit.Buckets
+	orderLimit *api.OrderLimit
+	catalogue  api.Catalogue
+}
+
+// reloader applies the reloadable settings of a newly loaded configuration to the running services
+type reloader struct {
+	m       sync.Mutex
+	load    func() (config.Config, error)
+	current config.Config
+	targets reloadTargets
+}
+
+// reload method loads the configuration again and applies its reloadable settings
+// an invalid configuration is not applied at all, and the changes requiring a restart are only reported
+// the seed file is imported again on every reload, as it may have changed without any setting changing
+func (r *reloader) reload() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	logger := r.targets.logger
+	cfg, err := r.load()
+	if err != nil {
+		logger.Error("Configuration reload failed, keeping the current one", "error", err)
+		return
+	}
+
+	reloadable, restart := config.Changes(r.current, cfg)
+	if len(restart) > 0 {
+		logger.Warning("Configuration changes require a restart", "settings", strings.Join(restart, ","))
+	}
+	if len(reloadable) == 0 {
+		logger.Info("Configuration reloaded without changes to apply")
+	} else {
+		r.apply(cfg)
+		logger.Info("Configuration reloaded", "settings", strings.Join(reloadable, ","))
+	}
+
+	// products missing from the reloaded seed file are kept, as they may have been configured through the api
+	err = seedCatalogue(cfg.SeedFile, r.targets.catalogue, logger)
+	if err != nil {
+		logger.Error("Seed catalogue reload failed", "file", cfg.SeedFile, "error", err)
+	}
+}
+
+// apply method applies the reloadable settings of a configuration to the running services
+func (r *reloader) apply(cfg config.Config) {
+	// every setting is already validated, so they are all applied
+	r.targets.logger.SetLevel(cfg.LogLevel)
+	r.targets.rateLimit.SetRate(cfg.RateLimit, cfg.RateBurst)
+	r.targets.orderLimit.Set(cfg.MaxOrder)
+
+	// the current configuration keeps the settings requiring a restart, so that they are reported until it happens
+	r.current.LogLevel = cfg.LogLevel
+	r.current.RateLimit = cfg.RateLimit
+	r.current.RateBurst = cfg.RateBurst
+	r.current.MaxOrder = cfg.MaxOrder
+	r.current.SeedFile = cfg.SeedFile
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/api"
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/ratelimit"
+	"github.com/ftfmtavares/shipping-optimizer/internal/repositories/memory/packsizes"
+	"github.com/ftfmtavares/shipping-optimizer/internal/services/product"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloader(t *testing.T) {
+	current := config.Config{ServerPort: 8080, LogLevel: "info", RateLimit: 0, RateBurst: 40, MaxOrder: 1000}
+
+	testCases := []struct {
+		desc             string
+		next             config.Config
+		err              error
+		expectedMaxOrder int
+		expectedLevel    string
+		expectedLimited  bool
+		expectedLogs     []string
+	}{
+		{
+			desc:             "reloadable settings applied",
+			next:             config.Config{ServerPort: 8080, LogLevel: "debug", RateLimit: 1, RateBurst: 1, MaxOrder: 500},
+			expectedMaxOrder: 500,
+			expectedLevel:    "debug",
+			expectedLimited:  true,
+			expectedLogs:     []string{`level=INFO msg="Configuration reloaded" settings=MAX_ORDER,LOG_LEVEL,RATE_LIMIT,RATE_LIMIT_BURST`},
+		},
+		{
+			desc:             "restart required",
+			next:             config.Config{ServerPort: 9000, LogLevel: "info", RateLimit: 0, RateBurst: 40, MaxOrder: 2000},
+			expectedMaxOrder: 2000,
+			expectedLevel:    "info",
+			expectedLogs: []string{
+				`level=WARN msg="Configuration changes require a restart" settings=SERVER_PORT`,
+				`level=INFO msg="Configuration reloaded" settings=MAX_ORDER`,
+			},
+		},
+		{
+			desc:             "nothing to apply",
+			next:             current,
+			expectedMaxOrder: 1000,
+			expectedLevel:    "info",
+			expectedLogs:     []string{`level=INFO msg="Configuration reloaded without changes to apply"`},
+		},
+		{
+			desc:             "invalid configuration",
+			err:              errors.New("invalid LOG_LEVEL"),
+			expectedMaxOrder: 1000,
+			expectedLevel:    "info",
+			expectedLogs:     []string{`level=ERROR msg="Configuration reload failed, keeping the current one" error="invalid LOG_LEVEL"`},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			r := &reloader{
+				load: func() (config.Config, error) {
+					return tC.next, tC.err
+				},
+				current: current,
+				targets: reloadTargets{
+					logger:     instrumentation.NewLogger(instrumentation.LoggerConfig{Level: current.LogLevel, Output: &buf}),
+					rateLimit:  ratelimit.NewBuckets(current.RateLimit, current.RateBurst),
+					orderLimit: api.NewOrderLimit(current.MaxOrder),
+				},
+			}
+
+			r.reload()
+
+			assert.Equal(t, tC.expectedMaxOrder, r.targets.orderLimit.Max())
+			assert.Equal(t, tC.expectedLevel, r.current.LogLevel)
+			r.targets.rateLimit.Allow("ci")
+			allowed, _ := r.targets.rateLimit.Allow("ci")
+			assert.Equal(t, tC.expectedLimited, !allowed)
+			for _, log := range tC.expectedLogs {
+				assert.Contains(t, buf.String(), log)
+			}
+			// settings requiring a restart are kept, so that they keep being reported
+			assert.Equal(t, current.ServerPort, r.current.ServerPort)
+		})
+	}
+}
+
+func TestReloaderSeedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.csv")
+	current := config.Config{LogLevel: "info", MaxOrder: 1000, SeedFile: path}
+	configurator := product.NewConfigurator(packsizes.NewPackSizes())
+	var buf bytes.Buffer
+	r := &reloader{
+		load: func() (config.Config, error) {
+			return current, nil
+		},
+		current: current,
+		targets: reloadTargets{
+			logger:     instrumentation.NewLogger(instrumentation.LoggerConfig{Level: current.LogLevel, Output: &buf}),
+			rateLimit:  ratelimit.NewBuckets(current.RateLimit, current.RateBurst),
+			orderLimit: api.NewOrderLimit(current.MaxOrder),
+			catalogue:  configurator,
+		},
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("pid,packs\n1,5 10\n"), 0o644))
+	assert.NoError(t, seedCatalogue(path, configurator, r.targets.logger))
+
+	// the changed seed file is imported again without any setting changing
+	assert.NoError(t, os.WriteFile(path, []byte("pid,packs\n1,250 500\n2,23\n"), 0o644))
+	r.reload()
+
+	assert.Contains(t, buf.String(), `level=INFO msg="Configuration reloaded without changes to apply"`)
+	assert.Contains(t, buf.String(), `level=INFO msg="Products imported" seed_file=`+path+` products=2 stored=2 failed=0`)
+	prd, err := configurator.PackSizes(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{250, 500}, prd.Packs)
+	assert.Equal(t, 2, prd.Version)
+	prd, err = configurator.PackSizes(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{23}, prd.Packs)
+
+	// an invalid seed file is reported, leaving the imported products as they are
+	assert.NoError(t, os.WriteFile(path, []byte("pid,packs\n1,0\n"), 0o644))
+	r.reload()
+
+	assert.Contains(t, buf.String(), `level=ERROR msg="Seed catalogue reload failed"`)
+	prd, err = configurator.PackSizes(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{250, 500}, prd.Packs)
+}
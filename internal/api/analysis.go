@@ -0,0 +1,68 @@
+// Package api handles the api requests and definitions
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+)
+
+// PackSizesAnalyzer provides the package sizes analysis service
+type PackSizesAnalyzer interface {
+	Analyze(context.Context, int, int) (order.Analysis, error)
+}
+
+// PackSizesAnalysisResponse holds the package sizes analysis response
+// frobenius and unreachable are null when infinitely many quantities can't be shipped exactly, and frobenius also when none
+type PackSizesAnalysisResponse struct {
+	PID         int   `json:"pid"`
+	Version     int   `json:"version"`
+	Packs       []int `json:"packs"`
+	GCD         int   `json:"gcd"`
+	Frobenius   *int  `json:"frobenius"`
+	Unreachable *int  `json:"unreachable"`
+	Redundant   []int `json:"redundant"`
+	WorstExcess int   `json:"worstexcess"`
+}
+
+// PackSizesAnalysis handles the product package sizes analysis requests
+// analyses are stopped once the caller goes away or the timeout expires, not being limited when it is zero
+func PackSizesAnalysis(analyzer PackSizesAnalyzer, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		version, valid := validateVersionQuery(w, r)
+		if !valid {
+			return
+		}
+
+		ctx, cancel := solveContext(r, timeout)
+		defer cancel()
+
+		analysis, err := analyzer.Analyze(ctx, productID, version)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(PackSizesAnalysisResponse{
+			PID:         analysis.PID,
+			Version:     analysis.Version,
+			Packs:       analysis.Sizes,
+			GCD:         analysis.GCD,
+			Frobenius:   analysis.Frobenius,
+			Unreachable: analysis.Unreachable,
+			Redundant:   analysis.Redundant,
+			WorstExcess: analysis.WorstExcess,
+		})
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
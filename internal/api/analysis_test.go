@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAnalyzer struct {
+	called   *bool
+	pid      *int
+	version  *int
+	response order.Analysis
+	err      error
+}
+
+func (m mockAnalyzer) Analyze(ctx context.Context, pid, version int) (order.Analysis, error) {
+	*m.called = true
+	*m.pid = pid
+	*m.version = version
+	return m.response, m.err
+}
+
+func TestPackSizesAnalysis(t *testing.T) {
+	var (
+		requestedAnalysis bool
+		requestedPID      int
+		requestedVersion  int
+	)
+	frobenius, unreachable := 43, 22
+
+	testCases := []struct {
+		desc             string
+		analyzer         mockAnalyzer
+		url              string
+		pid              string
+		expectedAnalysis bool
+		expectedPID      int
+		expectedVersion  int
+		expectedCode     int
+		expectedBody     string
+	}{
+		{
+			desc:         "invalid pid",
+			url:          "/product/a/packsizes/analysis",
+			pid:          "a",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc:         "invalid version",
+			url:          "/product/1/packsizes/analysis?version=0",
+			pid:          "1",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "version query parameter not valid"),
+		},
+		{
+			desc: "product not found",
+			analyzer: mockAnalyzer{
+				err: product.ErrProductNotFound,
+			},
+			url:              "/product/1/packsizes/analysis",
+			pid:              "1",
+			expectedAnalysis: true,
+			expectedPID:      1,
+			expectedCode:     http.StatusNotFound,
+			expectedBody:     errorBody(CodeProductNotFound, "product not found"),
+		},
+		{
+			desc: "coprime sizes",
+			analyzer: mockAnalyzer{
+				response: order.Analysis{
+					PID:         1,
+					Version:     2,
+					Sizes:       []int{5, 10, 12},
+					GCD:         1,
+					Frobenius:   &frobenius,
+					Unreachable: &unreachable,
+					Redundant:   []int{10},
+					WorstExcess: 4,
+				},
+			},
+			url:              "/product/1/packsizes/analysis",
+			pid:              "1",
+			expectedAnalysis: true,
+			expectedPID:      1,
+			expectedCode:     http.StatusOK,
+			expectedBody:     "{\"pid\":1,\"version\":2,\"packs\":[5,10,12],\"gcd\":1,\"frobenius\":43,\"unreachable\":22,\"redundant\":[10],\"worstexcess\":4}\n",
+		},
+		{
+			desc: "sizes with a common divisor of a previous version",
+			analyzer: mockAnalyzer{
+				response: order.Analysis{
+					PID:         1,
+					Version:     1,
+					Sizes:       []int{250, 500},
+					GCD:         250,
+					Redundant:   []int{500},
+					WorstExcess: 249,
+				},
+			},
+			url:              "/product/1/packsizes/analysis?version=1",
+			pid:              "1",
+			expectedAnalysis: true,
+			expectedPID:      1,
+			expectedVersion:  1,
+			expectedCode:     http.StatusOK,
+			expectedBody:     "{\"pid\":1,\"version\":1,\"packs\":[250,500],\"gcd\":250,\"frobenius\":null,\"unreachable\":null,\"redundant\":[500],\"worstexcess\":249}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedAnalysis = false
+			requestedPID = 0
+			requestedVersion = 0
+			tC.analyzer.called = &requestedAnalysis
+			tC.analyzer.pid = &requestedPID
+			tC.analyzer.version = &requestedVersion
+
+			req := httptest.NewRequest(http.MethodGet, tC.url, nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			PackSizesAnalysis(tC.analyzer, 0)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedAnalysis, requestedAnalysis)
+			assert.Equal(t, tC.expectedPID, requestedPID)
+			assert.Equal(t, tC.expectedVersion, requestedVersion)
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+)
+
+// JSONContentType is the content type of the JSON catalogues, as of most other responses
+const JSONContentType = "application/json"
+
+// maxCatalogueProducts is the largest amount of products imported at once
+const maxCatalogueProducts = 10000
+
+// maxCatalogueSize is the largest catalogue imported at once, in bytes
+const maxCatalogueSize = 8 << 20
+
+// errCatalogueTooLarge is returned when an imported catalogue exceeds maxCatalogueSize
+var errCatalogueTooLarge = fmt.Errorf("catalogue too large: maximum %d bytes", maxCatalogueSize)
+
+// products are listed in pages of defaultListLimit products unless the caller asks for up to maxListLimit
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// catalogueHeader is the header row of the csv catalogues, the packs and costs being separated by spaces
+// the packaging levels are name:capacity pairs separated by semicolons, and the costs and packaging levels columns are optional on imports
+var catalogueHeader = []string{"pid", "packs", "costs", "containers"}
+
+// catalogueRequiredColumns is how many of the first catalogueHeader columns a csv catalogue must have
+const catalogueRequiredColumns = 2
+
+// Catalogue provides the products catalogue export and import services
+type Catalogue interface {
+	List(context.Context, int, int) ([]product.Product, int)
+	Export(context.Context) []product.Product
+	Import(context.Context, []product.Product, string, bool) []product.ImportResult
+}
+
+// CatalogueProduct holds the package sizes configuration of a product in a catalogue
+// the version is only exported, imported products being stored as new versions
+type CatalogueProduct struct {
+	PID        int              `json:"pid"`
+	Version    int              `json:"version,omitempty"`
+	Packs      []int            `json:"packs"`
+	Costs      []int            `json:"costs,omitempty"`
+	Containers []ContainerLevel `json:"containers,omitempty"`
+}
+
+// ProductsResponse holds a page of configured products, in product id order
+// the next cursor lists the following page, being omitted from the last one
+type ProductsResponse struct {
+	Products   []ProductPackSizesResponse `json:"products"`
+	NextCursor int                        `json:"nextcursor,omitempty"`
+}
+
+// ImportedProductResponse holds what importing a catalogue row did, rows being numbered from 1
+type ImportedProductResponse struct {
+	Row     int    `json:"row"`
+	PID     int    `json:"pid"`
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+}
+
+// ImportErrorResponse holds why a catalogue row could not be imported
+type ImportErrorResponse struct {
+	Row     int    `json:"row"`
+	PID     int    `json:"pid"`
+	Message string `json:"message"`
+}
+
+// CatalogueImportResponse holds what importing a catalogue did, the invalid rows being reported and not imported
+type CatalogueImportResponse struct {
+	DryRun    bool                      `json:"dryrun"`
+	Stored    int                       `json:"stored"`
+	Unchanged int                       `json:"unchanged"`
+	Failed    int                       `json:"failed"`
+	Results   []ImportedProductResponse `json:"results"`
+	Errors    []ImportErrorResponse     `json:"errors"`
+}
+
+// a catalogueRow holds a product read from a catalogue, or why it is not valid
+type catalogueRow struct {
+	row     int
+	pid     int
+	product product.Product
+	err     error
+}
+
+// ListProducts handles the configured products listing requests, a page at a time
+func ListProducts(catalogue Catalogue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cursor, limit, valid := validateListQuery(w, r)
+		if !valid {
+			return
+		}
+
+		products, next := catalogue.List(r.Context(), cursor, limit)
+
+		res := ProductsResponse{
+			Products:   make([]ProductPackSizesResponse, len(products)),
+			NextCursor: next,
+		}
+		for i, prd := range products {
+			res.Products[i] = ProductPackSizesResponse{
+				PID:        prd.PID,
+				Version:    prd.Version,
+				Packs:      prd.Packs,
+				Costs:      prd.Costs,
+				Containers: containerLevelsResponse(prd.Containers),
+			}
+		}
+
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+// ExportProducts handles the products catalogue export requests, as JSON or as CSV as accepted by the caller
+func ExportProducts(catalogue Catalogue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, valid := validateCatalogueAccept(w, r)
+		if !valid {
+			return
+		}
+
+		products := catalogue.Export(r.Context())
+
+		w.Header().Set("Content-Type", contentType)
+		var err error
+		if contentType == CSVContentType {
+			err = writeCatalogueCSV(w, products)
+		} else {
+			err = writeCatalogueJSON(w, products)
+		}
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+// ImportProducts handles the products catalogue import requests, given as JSON or as CSV according to their content type
+// every valid row is imported, the invalid ones and those that can't be stored being reported, and a dry run only reports what would be imported
+func ImportProducts(catalogue Catalogue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dryRun, valid := validateDryRunQuery(w, r)
+		if !valid {
+			return
+		}
+
+		rows, valid := validateCatalogueRequest(w, r)
+		if !valid {
+			return
+		}
+
+		res := CatalogueImportResponse{
+			DryRun:  dryRun,
+			Results: []ImportedProductResponse{},
+			Errors:  []ImportErrorResponse{},
+		}
+		var (
+			products  []product.Product
+			validRows []int
+		)
+		for _, row := range rows {
+			if row.err != nil {
+				res.Errors = append(res.Errors, ImportErrorResponse{Row: row.row, PID: row.pid, Message: row.err.Error()})
+				continue
+			}
+			products = append(products, row.product)
+			validRows = append(validRows, row.row)
+		}
+		res.Failed = len(res.Errors)
+
+		if len(products) > 0 {
+			for i, result := range catalogue.Import(r.Context(), products, caller(r), dryRun) {
+				switch result.Status {
+				case product.ImportStored:
+					res.Stored++
+				case product.ImportUnchanged:
+					res.Unchanged++
+				case product.ImportFailed:
+					res.Failed++
+					res.Errors = append(res.Errors, ImportErrorResponse{Row: validRows[i], PID: result.PID, Message: serviceError(result.Err).message})
+					continue
+				}
+				res.Results = append(res.Results, ImportedProductResponse{
+					Row:     validRows[i],
+					PID:     result.PID,
+					Status:  string(result.Status),
+					Version: result.Version,
+				})
+			}
+		}
+
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+// LoadCatalogue reads the products of a catalogue file, as CSV when its extension is .csv and as JSON otherwise
+// unlike imports through the api, a catalogue with any invalid row is rejected as a whole
+func LoadCatalogue(path string) ([]product.Product, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []catalogueRow
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		rows, err = readCatalogueCSV(f)
+	} else {
+		rows, err = readCatalogueJSON(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		products []product.Product
+		errs     []error
+	)
+	for _, row := range rows {
+		if row.err != nil {
+			errs = append(errs, fmt.Errorf("row %d: %w", row.row, row.err))
+			continue
+		}
+		products = append(products, row.product)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return products, nil
+}
+
+// catalogueContentType negotiates the content type of an exported catalogue, JSON being preferred
+func catalogueContentType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSONContentType, true
+	}
+
+	for entry := range strings.SplitSeq(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case JSONContentType, "application/*", "*/*":
+			return JSONContentType, true
+		case CSVContentType, "text/*":
+			return CSVContentType, true
+		}
+	}
+
+	return "", false
+}
+
+// readCatalogueJSON reads a json array of catalogue products, failing only when it is not one
+func readCatalogueJSON(r io.Reader) ([]catalogueRow, error) {
+	var products []CatalogueProduct
+	err := json.NewDecoder(r).Decode(&products)
+	if err != nil {
+		return nil, payloadError(err, "invalid request payload")
+	}
+
+	rows := make([]catalogueRow, len(products))
+	for i, prd := range products {
+		rows[i] = catalogueProductRow(i+1, prd)
+	}
+	checkRepeatedProducts(rows)
+
+	return rows, nil
+}
+
+// readCatalogueCSV reads a csv catalogue with a pid,packs header, optionally followed by costs and containers, failing only when it is not one
+func readCatalogueCSV(r io.Reader) ([]catalogueRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, payloadError(err, "invalid csv payload")
+	}
+	if !validCatalogueHeader(header) {
+		required, optional := catalogueHeader[:catalogueRequiredColumns], catalogueHeader[catalogueRequiredColumns:]
+		return nil, fmt.Errorf("csv header must be %s, optionally followed by %s", strings.Join(required, ","), strings.Join(optional, ","))
+	}
+
+	var rows []catalogueRow
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, payloadError(err, "invalid csv payload")
+		}
+
+		if len(record) != len(header) {
+			rows = append(rows, catalogueRow{row: row, err: fmt.Errorf("expected %s columns", strings.Join(catalogueHeader[:len(header)], ","))})
+			continue
+		}
+
+		pid, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			rows = append(rows, catalogueRow{row: row, err: errors.New("product id not valid")})
+			continue
+		}
+
+		prd := CatalogueProduct{PID: pid}
+		for field := range strings.FieldsSeq(record[1]) {
+			// sizes that are not integers are kept as invalid ones, so that they are reported as any other invalid size
+			size, _ := strconv.Atoi(field)
+			prd.Packs = append(prd.Packs, size)
+		}
+		if len(record) > 2 {
+			for field := range strings.FieldsSeq(record[2]) {
+				cost, err := strconv.Atoi(field)
+				if err != nil {
+					cost = -1
+				}
+				prd.Costs = append(prd.Costs, cost)
+			}
+		}
+		if len(record) > 3 {
+			for field := range strings.SplitSeq(record[3], ";") {
+				if strings.TrimSpace(field) == "" {
+					continue
+				}
+				// the capacity follows the last colon, missing ones or those that are not integers being reported as any other invalid capacity
+				name, capacity := field, 0
+				if separator := strings.LastIndex(field, ":"); separator >= 0 {
+					name = field[:separator]
+					capacity, _ = strconv.Atoi(strings.TrimSpace(field[separator+1:]))
+				}
+				prd.Containers = append(prd.Containers, ContainerLevel{Name: strings.TrimSpace(name), Capacity: capacity})
+			}
+		}
+
+		rows = append(rows, catalogueProductRow(row, prd))
+	}
+	checkRepeatedProducts(rows)
+
+	return rows, nil
+}
+
+// validCatalogueHeader checks that a csv header holds the required catalogueHeader columns, along with any of the following ones in order
+func validCatalogueHeader(header []string) bool {
+	if len(header) < catalogueRequiredColumns || len(header) > len(catalogueHeader) {
+		return false
+	}
+
+	for i, column := range header {
+		if !strings.EqualFold(strings.TrimSpace(column), catalogueHeader[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// payloadError returns the error of a catalogue that could not be read, telling apart the ones above maxCatalogueSize
+func payloadError(err error, message string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errCatalogueTooLarge
+	}
+
+	return errors.New(message)
+}
+
+// catalogueProductRow validates a catalogue product as a package sizes configuration, which must have package sizes
+func catalogueProductRow(row int, prd CatalogueProduct) catalogueRow {
+	if prd.PID <= 0 {
+		return catalogueRow{row: row, pid: prd.PID, err: errors.New("product id not valid")}
+	}
+	if len(prd.Packs) == 0 {
+		return catalogueRow{row: row, pid: prd.PID, err: errors.New("pack sizes must be specified")}
+	}
+
+	converted, err := packSizesProduct(ProductPackSizesRequest{Packs: prd.Packs, Costs: prd.Costs, Containers: prd.Containers})
+	if err != nil {
+		return catalogueRow{row: row, pid: prd.PID, err: err}
+	}
+	converted.PID = prd.PID
+
+	return catalogueRow{row: row, pid: prd.PID, product: converted}
+}
+
+// checkRepeatedProducts invalidates the rows of products already given by a previous row
+func checkRepeatedProducts(rows []catalogueRow) {
+	first := make(map[int]int, len(rows))
+	for i, row := range rows {
+		if row.err != nil {
+			continue
+		}
+
+		if previous, found := first[row.pid]; found {
+			rows[i].err = fmt.Errorf("product repeated from row %d", previous)
+			continue
+		}
+		first[row.pid] = row.row
+	}
+}
+
+func writeCatalogueJSON(w io.Writer, products []product.Product) error {
+	res := make([]CatalogueProduct, len(products))
+	for i, prd := range products {
+		res[i] = CatalogueProduct{
+			PID:        prd.PID,
+			Version:    prd.Version,
+			Packs:      prd.Packs,
+			Costs:      prd.Costs,
+			Containers: containerLevelsResponse(prd.Containers),
+		}
+	}
+
+	return json.NewEncoder(w).Encode(res)
+}
+
+// writeCatalogueCSV writes the package sizes, costs and packaging levels of the products, so that they are imported back unchanged
+func writeCatalogueCSV(w io.Writer, products []product.Product) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(catalogueHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, prd := range products {
+		packs := make([]string, len(prd.Packs))
+		for i, size := range prd.Packs {
+			packs[i] = strconv.Itoa(size)
+		}
+		costs := make([]string, len(prd.Costs))
+		for i, cost := range prd.Costs {
+			costs[i] = strconv.Itoa(cost)
+		}
+		containers := make([]string, len(prd.Containers))
+		for i, level := range prd.Containers {
+			containers[i] = level.Name + ":" + strconv.Itoa(level.Capacity)
+		}
+
+		err = writer.Write([]string{strconv.Itoa(prd.PID), strings.Join(packs, " "), strings.Join(costs, " "), strings.Join(containers, ";")})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
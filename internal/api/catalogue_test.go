@@ -0,0 +1,432 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCatalogue struct {
+	imported *[]product.Product
+	caller   *string
+	dryRun   *bool
+	cursor   *int
+	limit    *int
+	products []product.Product
+	next     int
+}
+
+func (m mockCatalogue) List(ctx context.Context, cursor, limit int) ([]product.Product, int) {
+	*m.cursor = cursor
+	*m.limit = limit
+	return m.products, m.next
+}
+
+func (m mockCatalogue) Export(ctx context.Context) []product.Product {
+	return m.products
+}
+
+func (m mockCatalogue) Import(ctx context.Context, products []product.Product, caller string, dryRun bool) []product.ImportResult {
+	*m.imported = products
+	*m.caller = caller
+	*m.dryRun = dryRun
+
+	results := make([]product.ImportResult, len(products))
+	for i, prd := range products {
+		// products above 100 can't be stored
+		if prd.PID > 100 {
+			results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportFailed, Err: product.ErrStorageUnavailable}
+			continue
+		}
+		// even products are already configured as imported
+		if prd.PID%2 == 0 {
+			results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportUnchanged, Version: 4}
+			continue
+		}
+		results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportStored, Version: 1}
+	}
+	return results
+}
+
+func TestListProducts(t *testing.T) {
+	var (
+		requestedCursor int
+		requestedLimit  int
+	)
+
+	testCases := []struct {
+		desc           string
+		query          string
+		catalogue      mockCatalogue
+		expectedCursor int
+		expectedLimit  int
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			desc: "first page",
+			catalogue: mockCatalogue{
+				products: []product.Product{
+					{PID: 1, Packs: []int{23, 31, 53}, Version: 2},
+					{PID: 4, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}}, Version: 1},
+				},
+				next: 4,
+			},
+			expectedCursor: 0,
+			expectedLimit:  100,
+			expectedCode:   http.StatusOK,
+			expectedBody: `{"products":[{"pid":1,"version":2,"packs":[23,31,53]},` +
+				`{"pid":4,"version":1,"packs":[250,500],"costs":[3,5],"containers":[{"name":"carton","capacity":4}]}],"nextcursor":4}` + "\n",
+		},
+		{
+			desc:  "last page",
+			query: "?cursor=4&limit=2",
+			catalogue: mockCatalogue{
+				products: []product.Product{{PID: 9, Packs: []int{5}, Version: 1}},
+			},
+			expectedCursor: 4,
+			expectedLimit:  2,
+			expectedCode:   http.StatusOK,
+			expectedBody:   `{"products":[{"pid":9,"version":1,"packs":[5]}]}` + "\n",
+		},
+		{
+			desc:           "no products",
+			query:          "?cursor=&limit=1000",
+			catalogue:      mockCatalogue{},
+			expectedCursor: 0,
+			expectedLimit:  1000,
+			expectedCode:   http.StatusOK,
+			expectedBody:   `{"products":[]}` + "\n",
+		},
+		{
+			desc:         "invalid cursor",
+			query:        "?cursor=-1",
+			catalogue:    mockCatalogue{},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "cursor query parameter not valid"),
+		},
+		{
+			desc:         "invalid limit",
+			query:        "?limit=0",
+			catalogue:    mockCatalogue{},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "limit query parameter not valid"),
+		},
+		{
+			desc:         "limit too large",
+			query:        "?limit=1001",
+			catalogue:    mockCatalogue{},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "too many products: maximum 1000"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedCursor = 0
+			requestedLimit = 0
+			tC.catalogue.cursor = &requestedCursor
+			tC.catalogue.limit = &requestedLimit
+
+			req := httptest.NewRequest(http.MethodGet, "/products"+tC.query, nil)
+			rec := httptest.NewRecorder()
+
+			ListProducts(tC.catalogue)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			assert.Equal(t, tC.expectedCursor, requestedCursor)
+			assert.Equal(t, tC.expectedLimit, requestedLimit)
+		})
+	}
+}
+
+func TestExportProducts(t *testing.T) {
+	catalogue := mockCatalogue{
+		products: []product.Product{
+			{PID: 1, Packs: []int{23, 31, 53}, Version: 2},
+			{PID: 4, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}}, Version: 1},
+		},
+	}
+
+	testCases := []struct {
+		desc                string
+		accept              string
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			desc:                "json by default",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody: `[{"pid":1,"version":2,"packs":[23,31,53]},` +
+				`{"pid":4,"version":1,"packs":[250,500],"costs":[3,5],"containers":[{"name":"carton","capacity":4}]}]` + "\n",
+		},
+		{
+			desc:                "csv",
+			accept:              "text/csv",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody:        "pid,packs,costs,containers\n1,23 31 53,,\n4,250 500,3 5,carton:4\n",
+		},
+		{
+			desc:                "not acceptable",
+			accept:              "application/xml",
+			expectedCode:        http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeNotAcceptable, "accept header must allow application/json or text/csv"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products/export", nil)
+			if tC.accept != "" {
+				req.Header.Set("Accept", tC.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			ExportProducts(catalogue)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedContentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestImportProducts(t *testing.T) {
+	var (
+		imported []product.Product
+		caller   string
+		dryRun   bool
+	)
+
+	testCases := []struct {
+		desc             string
+		query            string
+		contentType      string
+		body             string
+		expectedImported []product.Product
+		expectedDryRun   bool
+		expectedCode     int
+		expectedBody     string
+	}{
+		{
+			desc: "json import",
+			body: `[{"pid":1,"packs":[23,31,53]},{"pid":2,"version":7,"packs":[250,500],"costs":[3,5],"containers":[{"name":"carton","capacity":4}]}]`,
+			expectedImported: []product.Product{
+				{PID: 1, Packs: []int{23, 31, 53}},
+				{PID: 2, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}}},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"dryrun":false,"stored":1,"unchanged":1,"failed":0,` +
+				`"results":[{"row":1,"pid":1,"status":"stored","version":1},{"row":2,"pid":2,"status":"unchanged","version":4}],"errors":[]}` + "\n",
+		},
+		{
+			desc:        "csv dry run with invalid rows",
+			query:       "?dryrun=true",
+			contentType: "text/csv; charset=utf-8",
+			body:        "pid,packs\n1,23 31 53\n0,5\n3,\n5,5 x\n1,10\n7\n9, 250 500 \n",
+			expectedImported: []product.Product{
+				{PID: 1, Packs: []int{23, 31, 53}},
+				{PID: 9, Packs: []int{250, 500}},
+			},
+			expectedDryRun: true,
+			expectedCode:   http.StatusOK,
+			expectedBody: `{"dryrun":true,"stored":2,"unchanged":0,"failed":5,` +
+				`"results":[{"row":1,"pid":1,"status":"stored","version":1},{"row":7,"pid":9,"status":"stored","version":1}],` +
+				`"errors":[{"row":2,"pid":0,"message":"product id not valid"},` +
+				`{"row":3,"pid":3,"message":"pack sizes must be specified"},` +
+				`{"row":4,"pid":5,"message":"pack sizes must be positive integers"},` +
+				`{"row":5,"pid":1,"message":"product repeated from row 1"},` +
+				`{"row":6,"pid":0,"message":"expected pid,packs columns"}]}` + "\n",
+		},
+		{
+			desc:        "csv import with costs and packaging levels",
+			contentType: "text/csv",
+			body:        "pid,packs,costs,containers\n1,23 31 53,,\n2,250 500,3 5,carton:4; outer box:10\n3,5 10,1 x,\n5,5,1,carton\n7,5,1\n",
+			expectedImported: []product.Product{
+				{PID: 1, Packs: []int{23, 31, 53}},
+				{PID: 2, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}, {Name: "outer box", Capacity: 10}}},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"dryrun":false,"stored":1,"unchanged":1,"failed":3,` +
+				`"results":[{"row":1,"pid":1,"status":"stored","version":1},{"row":2,"pid":2,"status":"unchanged","version":4}],` +
+				`"errors":[{"row":3,"pid":3,"message":"pack costs must be non negative integers"},` +
+				`{"row":4,"pid":5,"message":"container capacities must be positive integers"},` +
+				`{"row":5,"pid":0,"message":"expected pid,packs,costs,containers columns"}]}` + "\n",
+		},
+		{
+			desc: "storage unavailable for a product",
+			body: `[{"pid":1,"packs":[23,31,53]},{"pid":101,"packs":[5]}]`,
+			expectedImported: []product.Product{
+				{PID: 1, Packs: []int{23, 31, 53}},
+				{PID: 101, Packs: []int{5}},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"dryrun":false,"stored":1,"unchanged":0,"failed":1,` +
+				`"results":[{"row":1,"pid":1,"status":"stored","version":1}],` +
+				`"errors":[{"row":2,"pid":101,"message":"package sizes storage unavailable, retry later"}]}` + "\n",
+		},
+		{
+			desc:         "only invalid rows",
+			body:         `[{"pid":1,"packs":[5],"costs":[1,2]}]`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"dryrun":false,"stored":0,"unchanged":0,"failed":1,"results":[],` +
+				`"errors":[{"row":1,"pid":1,"message":"pack costs must match pack sizes"}]}` + "\n",
+		},
+		{
+			desc:         "invalid dry run",
+			query:        "?dryrun=maybe",
+			body:         `[{"pid":1,"packs":[5]}]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "dryrun query parameter not valid"),
+		},
+		{
+			desc:         "invalid json payload",
+			body:         `{"pid":1}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "invalid request payload"),
+		},
+		{
+			desc:         "invalid csv header",
+			contentType:  "text/csv",
+			body:         "product,sizes\n1,5\n",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "csv header must be pid,packs, optionally followed by costs,containers"),
+		},
+		{
+			desc:         "empty catalogue",
+			body:         `[]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "products must be specified"),
+		},
+		{
+			desc:         "too many products",
+			contentType:  "text/csv",
+			body:         "pid,packs\n" + strings.Repeat("1,5\n", maxCatalogueProducts+1),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "too many products: maximum 10000"),
+		},
+		{
+			desc:         "csv catalogue too large",
+			contentType:  "text/csv",
+			body:         "pid,packs\n1," + strings.Repeat("5 ", maxCatalogueSize/2) + "\n",
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: errorBody(CodeBodyTooLarge, "catalogue too large: maximum 8388608 bytes"),
+		},
+		{
+			desc:         "json catalogue too large",
+			body:         `[{"pid":1,"packs":[` + strings.Repeat("5,", maxCatalogueSize/2) + `5]}]`,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: errorBody(CodeBodyTooLarge, "catalogue too large: maximum 8388608 bytes"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			imported = nil
+			caller = ""
+			dryRun = false
+
+			req := httptest.NewRequest(http.MethodPost, "/products/import"+tC.query, strings.NewReader(tC.body))
+			req.Header.Set(callerHeader, "planner")
+			if tC.contentType != "" {
+				req.Header.Set("Content-Type", tC.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			ImportProducts(mockCatalogue{imported: &imported, caller: &caller, dryRun: &dryRun})(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			assert.Equal(t, tC.expectedImported, imported)
+			assert.Equal(t, tC.expectedDryRun, dryRun)
+			if tC.expectedImported != nil {
+				assert.Equal(t, "planner", caller)
+			}
+		})
+	}
+}
+
+func TestCatalogueCSVRoundTrip(t *testing.T) {
+	products := []product.Product{
+		{PID: 1, Packs: []int{23, 31, 53}},
+		{PID: 2, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}, {Name: "pallet: euro", Capacity: 10}}},
+	}
+
+	var csv strings.Builder
+	assert.NoError(t, writeCatalogueCSV(&csv, products))
+
+	// costs and packaging levels are imported back, so that an exported catalogue is stored unchanged
+	rows, err := readCatalogueCSV(strings.NewReader(csv.String()))
+	assert.NoError(t, err)
+	assert.Len(t, rows, len(products))
+	for i, row := range rows {
+		assert.NoError(t, row.err)
+		assert.Equal(t, products[i], row.product)
+	}
+}
+
+func TestLoadCatalogue(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		file          string
+		content       string
+		expected      []product.Product
+		expectedError string
+	}{
+		{
+			desc:     "csv catalogue",
+			file:     "seed.csv",
+			content:  "pid,packs\n1,23 31 53\n2,250\n",
+			expected: []product.Product{{PID: 1, Packs: []int{23, 31, 53}}, {PID: 2, Packs: []int{250}}},
+		},
+		{
+			desc:     "json catalogue",
+			file:     "seed.json",
+			content:  `[{"pid":1,"packs":[5,10],"costs":[1,2]}]`,
+			expected: []product.Product{{PID: 1, Packs: []int{5, 10}, Costs: []int{1, 2}}},
+		},
+		{
+			desc:          "invalid rows",
+			file:          "seed.csv",
+			content:       "pid,packs\n1,5\n-1,5\n1,10\n",
+			expectedError: "row 2: product id not valid\nrow 3: product repeated from row 1",
+		},
+		{
+			desc:          "invalid catalogue",
+			file:          "seed.json",
+			content:       `{}`,
+			expectedError: "invalid request payload",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tC.file)
+			assert.NoError(t, os.WriteFile(path, []byte(tC.content), 0o600))
+
+			res, err := LoadCatalogue(path)
+
+			assert.Equal(t, tC.expected, res)
+			if tC.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tC.expectedError)
+		})
+	}
+
+	_, err := LoadCatalogue(filepath.Join(t.TempDir(), "missing.csv"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+)
+
+// PackSizesComparator provides the package sizes comparison service
+type PackSizesComparator interface {
+	Compare(context.Context, order.ComparisonRequest) (order.Comparison, error)
+}
+
+// QtyRangeRequest holds a range of order quantities, from and to included, every step units
+type QtyRangeRequest struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	Step int `json:"step"`
+}
+
+// PackSizesComparisonRequest holds the proposed package sizes and the order quantities to compare them on
+// the quantities are given either as a list of orders or as a range
+type PackSizesComparisonRequest struct {
+	Packs  []int            `json:"packs"`
+	Orders []int            `json:"orders"`
+	Range  *QtyRangeRequest `json:"range"`
+}
+
+// ComparedPlanResponse holds the least excess plan of an order under a configuration
+type ComparedPlanResponse struct {
+	Packs      []PackResponse `json:"packs"`
+	PacksCount int            `json:"packscount"`
+	Total      int            `json:"total"`
+	Excess     int            `json:"excess"`
+}
+
+// OrderComparisonResponse holds the plans of an order under both configurations and how the proposed one changes it
+type OrderComparisonResponse struct {
+	Order       int                  `json:"order"`
+	Current     ComparedPlanResponse `json:"current"`
+	Proposed    ComparedPlanResponse `json:"proposed"`
+	ExcessDelta int                  `json:"excessdelta"`
+	PacksDelta  int                  `json:"packsdelta"`
+}
+
+// ComparisonTotalsResponse holds the totals of every compared order
+type ComparisonTotalsResponse struct {
+	CurrentExcess  int `json:"currentexcess"`
+	ProposedExcess int `json:"proposedexcess"`
+	CurrentPacks   int `json:"currentpacks"`
+	ProposedPacks  int `json:"proposedpacks"`
+	Better         int `json:"better"`
+	Worse          int `json:"worse"`
+	Unchanged      int `json:"unchanged"`
+}
+
+// PackSizesComparisonResponse holds the comparison of the stored and the proposed package sizes
+type PackSizesComparisonResponse struct {
+	PID      int                       `json:"pid"`
+	Version  int                       `json:"version"`
+	Current  []int                     `json:"current"`
+	Proposed []int                     `json:"proposed"`
+	Orders   []OrderComparisonResponse `json:"orders"`
+	Totals   ComparisonTotalsResponse  `json:"totals"`
+}
+
+// ComparePackSizes handles the product package sizes comparison requests, nothing being stored
+// comparisons are stopped once the caller goes away or the timeout expires, not being limited when it is zero
+func ComparePackSizes(comparator PackSizesComparator, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		req, valid := validateComparisonRequest(w, r, productID)
+		if !valid {
+			return
+		}
+
+		ctx, cancel := solveContext(r, timeout)
+		defer cancel()
+
+		cmp, err := comparator.Compare(ctx, req)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		res := PackSizesComparisonResponse{
+			PID:      cmp.PID,
+			Version:  cmp.Version,
+			Current:  cmp.Current,
+			Proposed: cmp.Proposed,
+			Orders:   make([]OrderComparisonResponse, len(cmp.Orders)),
+			Totals: ComparisonTotalsResponse{
+				CurrentExcess:  cmp.CurrentExcess,
+				ProposedExcess: cmp.ProposedExcess,
+				CurrentPacks:   cmp.CurrentPacks,
+				ProposedPacks:  cmp.ProposedPacks,
+				Better:         cmp.Better,
+				Worse:          cmp.Worse,
+				Unchanged:      cmp.Unchanged,
+			},
+		}
+		for i, qc := range cmp.Orders {
+			res.Orders[i] = OrderComparisonResponse{
+				Order:       qc.Qty,
+				Current:     comparedPlanResponse(qc.Current),
+				Proposed:    comparedPlanResponse(qc.Proposed),
+				ExcessDelta: qc.Proposed.Excess - qc.Current.Excess,
+				PacksDelta:  qc.Proposed.PacksCount - qc.Current.PacksCount,
+			}
+		}
+
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+func comparedPlanResponse(p order.Plan) ComparedPlanResponse {
+	return ComparedPlanResponse{
+		Packs:      packsResponse(p.Packs),
+		PacksCount: p.PacksCount,
+		Total:      p.Total,
+		Excess:     p.Excess,
+	}
+}
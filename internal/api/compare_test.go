@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockComparator struct {
+	called   *bool
+	req      *order.ComparisonRequest
+	response order.Comparison
+	err      error
+}
+
+func (m mockComparator) Compare(ctx context.Context, req order.ComparisonRequest) (order.Comparison, error) {
+	*m.called = true
+	*m.req = req
+	return m.response, m.err
+}
+
+func TestComparePackSizes(t *testing.T) {
+	var (
+		requestedComparison bool
+		requestedRequest    order.ComparisonRequest
+	)
+
+	testCases := []struct {
+		desc               string
+		comparator         mockComparator
+		pid                string
+		body               string
+		expectedComparison bool
+		expectedRequest    order.ComparisonRequest
+		expectedCode       int
+		expectedBody       string
+	}{
+		{
+			desc:         "invalid pid",
+			pid:          "0",
+			body:         `{"packs":[5],"orders":[10]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc:         "invalid payload",
+			pid:          "1",
+			body:         `{"packs":`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "invalid request payload"),
+		},
+		{
+			desc:         "no pack sizes",
+			pid:          "1",
+			body:         `{"orders":[10]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "pack sizes must be specified"),
+		},
+		{
+			desc:         "invalid pack size",
+			pid:          "1",
+			body:         `{"packs":[5,0],"orders":[10]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "pack sizes must be positive integers"),
+		},
+		{
+			desc:         "pack size too large",
+			pid:          "1",
+			body:         `{"packs":[5,1099511627776],"orders":[10]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "pack size too large: maximum 100000"),
+		},
+		{
+			desc:         "orders and range",
+			pid:          "1",
+			body:         `{"packs":[5],"orders":[10],"range":{"from":1,"to":10}}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "either orders or range must be specified"),
+		},
+		{
+			desc:         "no orders",
+			pid:          "1",
+			body:         `{"packs":[5]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "either orders or range must be specified"),
+		},
+		{
+			desc:         "invalid range",
+			pid:          "1",
+			body:         `{"packs":[5],"range":{"from":10,"to":5}}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "range not valid: from must be positive and not above to, with a positive step"),
+		},
+		{
+			desc:         "range too large",
+			pid:          "1",
+			body:         `{"packs":[5],"range":{"from":1,"to":1001}}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "too many orders: maximum 1000"),
+		},
+		{
+			desc:         "order too large",
+			pid:          "1",
+			body:         `{"packs":[5],"orders":[10,1000001]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "order quantities must be between 1 and 1000000"),
+		},
+		{
+			desc: "product not found",
+			comparator: mockComparator{
+				err: product.ErrProductNotFound,
+			},
+			pid:                "1",
+			body:               `{"packs":[5],"range":{"from":10,"to":20,"step":5}}`,
+			expectedComparison: true,
+			expectedRequest:    order.ComparisonRequest{PID: 1, Packs: []int{5}, Quantities: []int{10, 15, 20}},
+			expectedCode:       http.StatusNotFound,
+			expectedBody:       errorBody(CodeProductNotFound, "product not found"),
+		},
+		{
+			desc:               "service error",
+			comparator:         mockComparator{err: errors.New("error")},
+			pid:                "1",
+			body:               `{"packs":[5],"orders":[10]}`,
+			expectedComparison: true,
+			expectedRequest:    order.ComparisonRequest{PID: 1, Packs: []int{5}, Quantities: []int{10}},
+			expectedCode:       http.StatusInternalServerError,
+			expectedBody:       errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "comparison",
+			comparator: mockComparator{
+				response: order.Comparison{
+					PID:      1,
+					Version:  2,
+					Current:  []int{5, 12},
+					Proposed: []int{6},
+					Orders: []order.QtyComparison{
+						{
+							Qty:      12,
+							Current:  order.Plan{Packs: []order.Pack{{PackSize: 12, Quantity: 1}}, PacksCount: 1, Total: 12},
+							Proposed: order.Plan{Packs: []order.Pack{{PackSize: 6, Quantity: 2}}, PacksCount: 2, Total: 12},
+						},
+					},
+					CurrentPacks:  1,
+					ProposedPacks: 2,
+					Worse:         1,
+				},
+			},
+			pid:                "1",
+			body:               `{"packs":[6],"orders":[12]}`,
+			expectedComparison: true,
+			expectedRequest:    order.ComparisonRequest{PID: 1, Packs: []int{6}, Quantities: []int{12}},
+			expectedCode:       http.StatusOK,
+			expectedBody: "{\"pid\":1,\"version\":2,\"current\":[5,12],\"proposed\":[6],\"orders\":[{\"order\":12," +
+				"\"current\":{\"packs\":[{\"packsize\":12,\"quantity\":1}],\"packscount\":1,\"total\":12,\"excess\":0}," +
+				"\"proposed\":{\"packs\":[{\"packsize\":6,\"quantity\":2}],\"packscount\":2,\"total\":12,\"excess\":0}," +
+				"\"excessdelta\":0,\"packsdelta\":1}],\"totals\":{\"currentexcess\":0,\"proposedexcess\":0," +
+				"\"currentpacks\":1,\"proposedpacks\":2,\"better\":0,\"worse\":1,\"unchanged\":0}}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedComparison = false
+			requestedRequest = order.ComparisonRequest{}
+			tC.comparator.called = &requestedComparison
+			tC.comparator.req = &requestedRequest
+
+			req := httptest.NewRequest(http.MethodPost, "/product/"+tC.pid+"/packsizes/compare", bytes.NewBufferString(tC.body))
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			ComparePackSizes(tC.comparator, 0)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedComparison, requestedComparison)
+			assert.Equal(t, tC.expectedRequest, requestedRequest)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package api handles the api requests and definitions
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// Machine readable error codes of the error responses
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeBodyTooLarge       = "body_too_large"
+	CodeEmptyOrder         = "empty_order"
+	CodeProductNotFound    = "product_not_found"
+	CodeVersionNotFound    = "version_not_found"
+	CodeVersionConflict    = "version_conflict"
+	CodeStorageUnavailable = "storage_unavailable"
+	CodeStockNotFound      = "stock_not_found"
+	CodeNoConfiguration    = "no_configuration"
+	CodeNoCosts            = "no_costs"
+	CodeUnservableOrder    = "unservable_order"
+	CodeOrderTooLarge      = "order_too_large"
+	CodeInsufficientStock  = "insufficient_stock"
+	CodeKeyNotFound        = "key_not_found"
+	CodeKeyExists          = "key_exists"
+	CodeStaticKey          = "static_key"
+	CodeOverloaded         = "overloaded"
+	CodeOversized          = "calculation_too_large"
+	CodeTimeout            = "calculation_timeout"
+	CodeCanceled           = "request_canceled"
+	CodeNotAcceptable      = "not_acceptable"
+	CodeInternalError      = "internal_error"
+)
+
+// ErrorResponse holds the structured error response
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// an apiError describes how a service error is responded
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+// errorsMap maps the services errors into their responses
+var errorsMap = []struct {
+	err error
+	apiError
+}{
+	{order.ErrEmptyOrder, apiError{http.StatusBadRequest, CodeEmptyOrder, "empty order"}},
+	{product.ErrProductNotFound, apiError{http.StatusNotFound, CodeProductNotFound, "product not found"}},
+	{product.ErrVersionNotFound, apiError{http.StatusNotFound, CodeVersionNotFound, "version not found"}},
+	{product.ErrVersionConflict, apiError{http.StatusPreconditionFailed, CodeVersionConflict, "package sizes changed since the given version"}},
+	{product.ErrStorageUnavailable, apiError{http.StatusServiceUnavailable, CodeStorageUnavailable, "package sizes storage unavailable, retry later"}},
+	{product.ErrStockNotFound, apiError{http.StatusNotFound, CodeStockNotFound, "stock not found"}},
+	{product.ErrNoPackSizes, apiError{http.StatusUnprocessableEntity, CodeNoConfiguration, "no pack sizes configured for product"}},
+	{product.ErrNoPackCosts, apiError{http.StatusUnprocessableEntity, CodeNoCosts, "no pack costs configured for product"}},
+	{order.ErrUnservableOrder, apiError{http.StatusUnprocessableEntity, CodeUnservableOrder, "no shipping plan within the maximum excess"}},
+	{order.ErrOrderTooLarge, apiError{http.StatusUnprocessableEntity, CodeOrderTooLarge, "order too large for the available stock"}},
+	{product.ErrInsufficientStock, apiError{http.StatusConflict, CodeInsufficientStock, "insufficient stock"}},
+	{order.ErrOverloaded, apiError{http.StatusTooManyRequests, CodeOverloaded, "solver capacity exhausted, retry later"}},
+	{order.ErrCalculationTooLarge, apiError{http.StatusUnprocessableEntity, CodeOversized, "calculation too large for the solver capacity"}},
+	{context.DeadlineExceeded, apiError{http.StatusGatewayTimeout, CodeTimeout, "calculation took longer than allowed"}},
+	{context.Canceled, apiError{http.StatusServiceUnavailable, CodeCanceled, "request canceled before completion"}},
+	{auth.ErrKeyNotFound, apiError{http.StatusNotFound, CodeKeyNotFound, "api key not found"}},
+	{auth.ErrKeyExists, apiError{http.StatusConflict, CodeKeyExists, "api key already exists"}},
+	{auth.ErrStaticKey, apiError{http.StatusConflict, CodeStaticKey, "api key loaded from configuration can't be changed"}},
+}
+
+// serviceError returns how a service error is responded, as an internal error when it isn't a known one
+func serviceError(err error) apiError {
+	for _, mapped := range errorsMap {
+		if errors.Is(err, mapped.err) {
+			return mapped.apiError
+		}
+	}
+
+	return apiError{http.StatusInternalServerError, CodeInternalError, "internal error"}
+}
+
+// overloadedRetryAfter is the Retry-After header of overloaded responses, in seconds
+const overloadedRetryAfter = "1"
+
+// writeServiceError writes the error response of a service error
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	res := serviceError(err)
+	if res.status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", overloadedRetryAfter)
+	}
+	writeError(w, r, res.status, res.code, res.message)
+}
+
+// writeInvalidRequest writes the error response of a request failing validation
+func writeInvalidRequest(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+// writeInternalError writes the error response of an unexpected failure
+func writeInternalError(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusInternalServerError, CodeInternalError, "internal error")
+}
+
+// writeError writes a structured error response identified by the request ID
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: instrumentation.RequestID(r.Context()),
+	})
+}
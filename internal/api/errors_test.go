@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/stretchr/testify/assert"
+)
+
+// errorBody returns the structured error response of a request without request ID
+func errorBody(code, message string) string {
+	return `{"code":"` + code + `","message":"` + message + `","request_id":""}` + "\n"
+}
+
+func TestWriteServiceError(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			desc:         "empty order",
+			err:          order.ErrEmptyOrder,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"code":"empty_order","message":"empty order","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "product not found",
+			err:          product.ErrProductNotFound,
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"code":"product_not_found","message":"product not found","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "wrapped version not found",
+			err:          fmt.Errorf("retrieving product: %w", product.ErrVersionNotFound),
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"code":"version_not_found","message":"version not found","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "stock not found",
+			err:          product.ErrStockNotFound,
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"code":"stock_not_found","message":"stock not found","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "no pack sizes",
+			err:          product.ErrNoPackSizes,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"code":"no_configuration","message":"no pack sizes configured for product","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "no pack costs",
+			err:          product.ErrNoPackCosts,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"code":"no_costs","message":"no pack costs configured for product","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "unservable order",
+			err:          order.ErrUnservableOrder,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"code":"unservable_order","message":"no shipping plan within the maximum excess","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "overloaded",
+			err:          order.ErrOverloaded,
+			expectedCode: http.StatusTooManyRequests,
+			expectedBody: `{"code":"overloaded","message":"solver capacity exhausted, retry later","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "calculation too large",
+			err:          order.ErrCalculationTooLarge,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"code":"calculation_too_large","message":"calculation too large for the solver capacity","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "calculation timeout",
+			err:          fmt.Errorf("solving shipping: %w", context.DeadlineExceeded),
+			expectedCode: http.StatusGatewayTimeout,
+			expectedBody: `{"code":"calculation_timeout","message":"calculation took longer than allowed","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "request canceled",
+			err:          context.Canceled,
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"code":"request_canceled","message":"request canceled before completion","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+		{
+			desc:         "unknown error",
+			err:          errors.New("error"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"code":"internal_error","message":"internal error","request_id":"4f2a9c61d0b3e875"}` + "\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/product/1/packsizes", nil)
+			req = req.WithContext(instrumentation.WithRequestID(req.Context(), "4f2a9c61d0b3e875"))
+			rec := httptest.NewRecorder()
+
+			writeServiceError(rec, req, tC.err)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			if tC.expectedCode == http.StatusTooManyRequests {
+				assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/gorilla/mux"
+)
+
+// KeyManager provides the api keys management service
+type KeyManager interface {
+	Keys() []auth.Key
+	CreateKey(string, auth.Role) (string, error)
+	DeleteKey(string) error
+}
+
+// APIKeyRequest holds an api key creation request
+type APIKeyRequest struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// APIKeyResponse holds an api key without its secret
+type APIKeyResponse struct {
+	ID     string `json:"id"`
+	Role   string `json:"role"`
+	Static bool   `json:"static"`
+}
+
+// APIKeysResponse holds all api keys
+type APIKeysResponse struct {
+	Keys []APIKeyResponse `json:"keys"`
+}
+
+// CreatedAPIKeyResponse holds a created api key along with its secret, which is never returned again
+type CreatedAPIKeyResponse struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+	Key  string `json:"key"`
+}
+
+// APIKeys handles the api keys listing requests
+func APIKeys(manager KeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := APIKeysResponse{Keys: []APIKeyResponse{}}
+		for _, key := range manager.Keys() {
+			res.Keys = append(res.Keys, APIKeyResponse{
+				ID:     key.ID,
+				Role:   key.Role.String(),
+				Static: key.Static,
+			})
+		}
+
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+// CreateAPIKey handles the api key creation requests
+func CreateAPIKey(manager KeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, role, valid := validateAPIKeyRequest(w, r)
+		if !valid {
+			return
+		}
+
+		key, err := manager.CreateKey(id, role)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(CreatedAPIKeyResponse{
+			ID:   id,
+			Role: role.String(),
+			Key:  key,
+		})
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+// DeleteAPIKey handles the api key deletion requests
+func DeleteAPIKey(manager KeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := manager.DeleteKey(mux.Vars(r)["id"])
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockKeyManager struct {
+	called *bool
+	id     *string
+	role   *auth.Role
+	keys   []auth.Key
+	key    string
+	err    error
+}
+
+func (m mockKeyManager) Keys() []auth.Key {
+	*m.called = true
+	return m.keys
+}
+
+func (m mockKeyManager) CreateKey(id string, role auth.Role) (string, error) {
+	*m.called = true
+	*m.id = id
+	*m.role = role
+	return m.key, m.err
+}
+
+func (m mockKeyManager) DeleteKey(id string) error {
+	*m.called = true
+	*m.id = id
+	return m.err
+}
+
+func TestAPIKeys(t *testing.T) {
+	var called bool
+
+	testCases := []struct {
+		desc         string
+		manager      mockKeyManager
+		expectedBody string
+	}{
+		{
+			desc:         "no keys",
+			manager:      mockKeyManager{called: &called},
+			expectedBody: "{\"keys\":[]}\n",
+		},
+		{
+			desc: "listed keys",
+			manager: mockKeyManager{
+				called: &called,
+				keys: []auth.Key{
+					{ID: "ci", Role: auth.Editor},
+					{ID: "ops", Role: auth.Admin, Static: true},
+				},
+			},
+			expectedBody: "{\"keys\":[{\"id\":\"ci\",\"role\":\"editor\",\"static\":false},{\"id\":\"ops\",\"role\":\"admin\",\"static\":true}]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			called = false
+
+			rec := httptest.NewRecorder()
+			APIKeys(tC.manager)(rec, httptest.NewRequest(http.MethodGet, "/auth/keys", nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			assert.True(t, called)
+		})
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	var (
+		called        bool
+		requestedID   string
+		requestedRole auth.Role
+	)
+
+	testCases := []struct {
+		desc           string
+		manager        mockKeyManager
+		body           string
+		expectedCalled bool
+		expectedID     string
+		expectedRole   auth.Role
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			desc:         "invalid payload",
+			body:         `{"id":`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "invalid request payload"),
+		},
+		{
+			desc:         "invalid key id",
+			body:         `{"id":"c i","role":"viewer"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "key id not valid"),
+		},
+		{
+			desc:         "invalid role",
+			body:         `{"id":"ci","role":"public"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "role not valid"),
+		},
+		{
+			desc: "existing key",
+			manager: mockKeyManager{
+				called: &called,
+				id:     &requestedID,
+				role:   &requestedRole,
+				err:    auth.ErrKeyExists,
+			},
+			body:           `{"id":"ci","role":"editor"}`,
+			expectedCalled: true,
+			expectedID:     "ci",
+			expectedRole:   auth.Editor,
+			expectedCode:   http.StatusConflict,
+			expectedBody:   errorBody(CodeKeyExists, "api key already exists"),
+		},
+		{
+			desc: "created key",
+			manager: mockKeyManager{
+				called: &called,
+				id:     &requestedID,
+				role:   &requestedRole,
+				key:    "9f86d081884c7d65",
+			},
+			body:           `{"id":"ci","role":"editor"}`,
+			expectedCalled: true,
+			expectedID:     "ci",
+			expectedRole:   auth.Editor,
+			expectedCode:   http.StatusCreated,
+			expectedBody:   "{\"id\":\"ci\",\"role\":\"editor\",\"key\":\"9f86d081884c7d65\"}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			called = false
+			requestedID = ""
+			requestedRole = auth.Public
+
+			rec := httptest.NewRecorder()
+			CreateAPIKey(tC.manager)(rec, httptest.NewRequest(http.MethodPost, "/auth/keys", bytes.NewBufferString(tC.body)))
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedCalled, called)
+			assert.Equal(t, tC.expectedID, requestedID)
+			assert.Equal(t, tC.expectedRole, requestedRole)
+		})
+	}
+}
+
+func TestDeleteAPIKey(t *testing.T) {
+	var (
+		called      bool
+		requestedID string
+	)
+
+	testCases := []struct {
+		desc         string
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			desc:         "deleted key",
+			expectedCode: http.StatusNoContent,
+			expectedBody: "",
+		},
+		{
+			desc:         "key not found",
+			err:          auth.ErrKeyNotFound,
+			expectedCode: http.StatusNotFound,
+			expectedBody: errorBody(CodeKeyNotFound, "api key not found"),
+		},
+		{
+			desc:         "static key",
+			err:          auth.ErrStaticKey,
+			expectedCode: http.StatusConflict,
+			expectedBody: errorBody(CodeStaticKey, "api key loaded from configuration can't be changed"),
+		},
+		{
+			desc:         "persistence error",
+			err:          errors.New("error"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: errorBody(CodeInternalError, "internal error"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			called = false
+			requestedID = ""
+
+			req := httptest.NewRequest(http.MethodDelete, "/auth/keys/ci", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "ci"})
+			rec := httptest.NewRecorder()
+			DeleteAPIKey(mockKeyManager{called: &called, id: &requestedID, err: tC.err})(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.True(t, called)
+			assert.Equal(t, "ci", requestedID)
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import "sync/atomic"
+
+// OrderLimit holds the largest order quantity accepted by the shipping calculation handlers
+// it can be changed while the handlers are serving, such as when the configuration is reloaded
+type OrderLimit struct {
+	max atomic.Int64
+}
+
+// NewOrderLimit returns an initialized OrderLimit
+func NewOrderLimit(max int) *OrderLimit {
+	l := &OrderLimit{}
+	l.Set(max)
+
+	return l
+}
+
+// Max method returns the largest order quantity accepted
+func (l *OrderLimit) Max() int {
+	return int(l.max.Load())
+}
+
+// Set method changes the largest order quantity accepted
+func (l *OrderLimit) Set(max int) {
+	l.max.Store(int64(max))
+}
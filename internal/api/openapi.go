@@ -0,0 +1,8 @@
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document describing every service route
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,102 @@
+// Package api handles the api requests and definitions
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+)
+
+// LinesOptimizer provides the multi product order packages calculation service
+type LinesOptimizer interface {
+	CalculateLines(context.Context, []order.Order) []order.LineShipping
+}
+
+// OrderLineRequest holds a multi product order line
+type OrderLineRequest struct {
+	PID int `json:"pid"`
+	Qty int `json:"qty"`
+}
+
+// OrderLineResponse holds the calculation of a multi product order line
+type OrderLineResponse struct {
+	Line int `json:"line"`
+	PID  int `json:"pid"`
+	ShippingCalculationResponse
+}
+
+// FailedLineResponse holds a multi product order line that could not be calculated along with its error code and message
+type FailedLineResponse struct {
+	Line  int    `json:"line"`
+	PID   int    `json:"pid"`
+	Order int    `json:"order"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// OrdersCalculationResponse holds the multi product orders calculation response along with its consolidated totals
+type OrdersCalculationResponse struct {
+	Lines      []OrderLineResponse  `json:"lines"`
+	Failed     []FailedLineResponse `json:"failed"`
+	PacksCount int                  `json:"packscount"`
+	Excess     int                  `json:"excess"`
+}
+
+// OrdersCalculation handles the multi product orders calculation requests
+// lines above the order limit are rejected, and lines are calculated under the request context so they stop once the caller goes away or the timeout expires
+func OrdersCalculation(calculator LinesOptimizer, limit *OrderLimit, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lines, valid := validateOrderLinesRequest(w, r, limit.Max())
+		if !valid {
+			return
+		}
+
+		ctx, cancel := solveContext(r, timeout)
+		defer cancel()
+
+		res := OrdersCalculationResponse{
+			Lines:  []OrderLineResponse{},
+			Failed: []FailedLineResponse{},
+		}
+		for i, line := range calculator.CalculateLines(ctx, lines) {
+			if line.Err != nil {
+				lineErr := serviceError(line.Err)
+				res.Failed = append(res.Failed, FailedLineResponse{
+					Line:  i,
+					PID:   lines[i].PID,
+					Order: lines[i].Qty,
+					Code:  lineErr.code,
+					Error: lineErr.message,
+				})
+				continue
+			}
+
+			sd := line.Shipping
+			res.Lines = append(res.Lines, OrderLineResponse{
+				Line: i,
+				PID:  sd.PID,
+				ShippingCalculationResponse: ShippingCalculationResponse{
+					Version:    sd.Version,
+					Order:      sd.Order,
+					Packs:      packsResponse(sd.Packs),
+					PacksCount: sd.PacksCount,
+					Total:      sd.Total,
+					Excess:     sd.Excess,
+					Cost:       sd.Cost,
+					Containers: containersResponse(sd.Containers),
+					Levels:     levelsResponse(sd.Levels),
+				},
+			})
+			res.PacksCount += sd.PacksCount
+			res.Excess += sd.Excess
+		}
+
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLinesCalculator struct {
+	called   *bool
+	lines    *[]order.Order
+	response []order.LineShipping
+}
+
+func (m mockLinesCalculator) CalculateLines(ctx context.Context, lines []order.Order) []order.LineShipping {
+	*m.called = true
+	*m.lines = lines
+	return m.response
+}
+
+func TestOrdersCalculation(t *testing.T) {
+	var (
+		requestedCalculation bool
+		requestedLines       []order.Order
+	)
+
+	testCases := []struct {
+		desc                string
+		calculator          mockLinesCalculator
+		body                string
+		expectedCalculation bool
+		expectedLines       []order.Order
+		expectedCode        int
+		expectedBody        string
+	}{
+		{
+			desc:                "invalid payload",
+			calculator:          mockLinesCalculator{},
+			body:                `{"pid":1,"qty":10}`,
+			expectedCalculation: false,
+			expectedLines:       nil,
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "invalid request payload"),
+		},
+		{
+			desc:                "missing lines",
+			calculator:          mockLinesCalculator{},
+			body:                `[]`,
+			expectedCalculation: false,
+			expectedLines:       nil,
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "order lines must be specified"),
+		},
+		{
+			desc:                "invalid product id",
+			calculator:          mockLinesCalculator{},
+			body:                `[{"pid":1,"qty":10},{"pid":0,"qty":10}]`,
+			expectedCalculation: false,
+			expectedLines:       nil,
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "line 1: product id not valid"),
+		},
+		{
+			desc:                "invalid order quantity",
+			calculator:          mockLinesCalculator{},
+			body:                `[{"pid":1,"qty":-10}]`,
+			expectedCalculation: false,
+			expectedLines:       nil,
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "line 0: order quantity not valid"),
+		},
+		{
+			desc:                "maximum order quantity exceeded",
+			calculator:          mockLinesCalculator{},
+			body:                `[{"pid":1,"qty":10000000001}]`,
+			expectedCalculation: false,
+			expectedLines:       nil,
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "line 0: order too large: maximum 10000000000"),
+		},
+		{
+			desc: "lines calculation",
+			calculator: mockLinesCalculator{
+				response: []order.LineShipping{
+					{
+						Shipping: order.Shipping{
+							PID:   1,
+							Order: 21,
+							Packs: []order.Pack{
+								{
+									PackSize: 10,
+									Quantity: 1,
+								},
+								{
+									PackSize: 12,
+									Quantity: 1,
+								},
+							},
+							PacksCount: 2,
+							Total:      22,
+							Excess:     1,
+						},
+					},
+					{
+						Err: product.ErrProductNotFound,
+					},
+					{
+						Shipping: order.Shipping{
+							PID:   2,
+							Order: 8,
+							Packs: []order.Pack{
+								{
+									PackSize: 5,
+									Quantity: 2,
+								},
+							},
+							PacksCount: 2,
+							Total:      10,
+							Excess:     2,
+						},
+					},
+				},
+			},
+			body:                `[{"pid":1,"qty":21},{"pid":3,"qty":5},{"pid":2,"qty":8}]`,
+			expectedCalculation: true,
+			expectedLines: []order.Order{
+				{
+					PID: 1,
+					Qty: 21,
+				},
+				{
+					PID: 3,
+					Qty: 5,
+				},
+				{
+					PID: 2,
+					Qty: 8,
+				},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"lines":[{"line":0,"pid":1,"version":0,"order":21,"packs":[{"packsize":10,"quantity":1},{"packsize":12,"quantity":1}],"packscount":2,"total":22,"excess":1,"cost":0},` +
+				`{"line":2,"pid":2,"version":0,"order":8,"packs":[{"packsize":5,"quantity":2}],"packscount":2,"total":10,"excess":2,"cost":0}],` +
+				`"failed":[{"line":1,"pid":3,"order":5,"code":"product_not_found","error":"product not found"}],"packscount":4,"excess":3}` + "\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedCalculation = false
+			requestedLines = nil
+			tC.calculator.called = &requestedCalculation
+			tC.calculator.lines = &requestedLines
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/shipping-calculation", bytes.NewReader([]byte(tC.body)))
+			rec := httptest.NewRecorder()
+
+			OrdersCalculation(tC.calculator, NewOrderLimit(config.MaxOrderLimit), 0)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedCalculation, requestedCalculation)
+			assert.Equal(t, tC.expectedLines, requestedLines)
+		})
+	}
+}
@@ -5,72 +5,337 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/server"
 )
 
+// callerHeader identifies who is calling the api when authentication is disabled, being recorded along with the package sizes changes
+const callerHeader = "X-Caller"
+
+// anonymousCaller identifies unauthenticated callers that don't set the caller header
+const anonymousCaller = "anonymous"
+
 // Product provides the product package sizes management service
 type Product interface {
 	PackSizes(context.Context, int) (product.Product, error)
-	Update(context.Context, int, []int)
+	Update(context.Context, product.Product, string) (product.Revision, error)
+	UpdateIf(context.Context, product.Product, string, product.Precondition) (product.Revision, error)
+	History(context.Context, int) []product.Revision
+	Version(context.Context, int, int) (product.Revision, error)
+	Restore(context.Context, int, int, string) (product.Revision, error)
+	RestoreIf(context.Context, int, int, string, product.Precondition) (product.Revision, error)
+	Delete(context.Context, int, string) error
+}
+
+// ContainerLevel holds a packaging level, each of its containers holding up to capacity items of the level below
+type ContainerLevel struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
 }
 
 // ProductPackSizesResponse holds the product package sizes response
 type ProductPackSizesResponse struct {
-	PID   int   `json:"pid"`
-	Packs []int `json:"packs"`
+	PID        int              `json:"pid"`
+	Version    int              `json:"version"`
+	Packs      []int            `json:"packs"`
+	Costs      []int            `json:"costs,omitempty"`
+	Containers []ContainerLevel `json:"containers,omitempty"`
+}
+
+// PackSizesVersionResponse holds a product package sizes version along with when and by whom it was stored
+type PackSizesVersionResponse struct {
+	PID        int              `json:"pid"`
+	Version    int              `json:"version"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Caller     string           `json:"caller"`
+	Packs      []int            `json:"packs"`
+	Costs      []int            `json:"costs,omitempty"`
+	Containers []ContainerLevel `json:"containers,omitempty"`
+}
+
+// PackSizesHistoryResponse holds all product package sizes versions, from the oldest to the latest
+type PackSizesHistoryResponse struct {
+	PID      int                        `json:"pid"`
+	Versions []PackSizesVersionResponse `json:"versions"`
 }
 
 // ProductPackSizes handles the product packages sizes retrieval requests
-func ProductPackSizes(ctx context.Context, retriever Product) http.HandlerFunc {
+// the response is tagged with the configuration generation, so that callers can skip unchanged configurations and condition their updates
+func ProductPackSizes(retriever Product) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		productID, valid := validatePidVar(w, r)
 		if !valid {
 			return
 		}
 
-		prd, err := retriever.PackSizes(ctx, productID)
+		prd, err := retriever.PackSizes(r.Context(), productID)
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			writeServiceError(w, r, err)
+			return
+		}
+
+		etag := packSizesETag(prd.Generation)
+		w.Header().Set("ETag", etag)
+		if ifNoneMatch(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 
 		err = json.NewEncoder(w).Encode(ProductPackSizesResponse{
-			PID:   productID,
-			Packs: prd.Packs,
+			PID:        productID,
+			Version:    prd.Version,
+			Packs:      prd.Packs,
+			Costs:      prd.Costs,
+			Containers: containerLevelsResponse(prd.Containers),
 		})
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			writeInternalError(w, r)
 		}
 	}
 }
 
 // ProductPackSizesRequest holds the product package sizes update request
+// containers are optional and hold the packaging levels, from the innermost one
 type ProductPackSizesRequest struct {
-	Packs []int `json:"packs"`
+	Packs      []int            `json:"packs"`
+	Costs      []int            `json:"costs"`
+	Containers []ContainerLevel `json:"containers"`
 }
 
 // StoreProductPackSizes handles the product packages sizes update requests
-func StoreProductPackSizes(ctx context.Context, updater Product) http.HandlerFunc {
+// every update is stored as a new version of the product package sizes
+// updates with an If-Match header are only stored while the latest configuration is one of the given ones, failing as stale otherwise
+func StoreProductPackSizes(updater Product) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		productID, valid := validatePidVar(w, r)
 		if !valid {
 			return
 		}
 
-		packSizes, valid := validatePackSizesRequest(w, r)
+		prd, valid := validatePackSizesRequest(w, r)
 		if !valid {
 			return
 		}
 
-		updater.Update(ctx, productID, packSizes)
+		prd.PID = productID
+		var (
+			rev product.Revision
+			err error
+		)
+		precondition, conditional := ifMatch(r)
+		if conditional {
+			rev, err = updater.UpdateIf(r.Context(), prd, caller(r), precondition)
+		} else {
+			rev, err = updater.Update(r.Context(), prd, caller(r))
+		}
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
 
-		err := json.NewEncoder(w).Encode(ProductPackSizesResponse{
-			PID:   productID,
-			Packs: packSizes,
+		w.Header().Set("ETag", packSizesETag(rev.Product.Generation))
+		err = json.NewEncoder(w).Encode(ProductPackSizesResponse{
+			PID:        productID,
+			Version:    rev.Product.Version,
+			Packs:      prd.Packs,
+			Costs:      prd.Costs,
+			Containers: containerLevelsResponse(prd.Containers),
 		})
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			writeInternalError(w, r)
 		}
 	}
 }
+
+// ProductPackSizesHistory handles the product packages sizes versions history requests
+func ProductPackSizesHistory(retriever Product) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		history := retriever.History(r.Context(), productID)
+
+		versions := make([]PackSizesVersionResponse, len(history))
+		for i, rev := range history {
+			versions[i] = versionResponse(rev)
+		}
+
+		err := json.NewEncoder(w).Encode(PackSizesHistoryResponse{
+			PID:      productID,
+			Versions: versions,
+		})
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+// ProductPackSizesVersion handles the product packages sizes version retrieval requests
+func ProductPackSizesVersion(retriever Product) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		version, valid := validateVersionVar(w, r)
+		if !valid {
+			return
+		}
+
+		rev, err := retriever.Version(r.Context(), productID, version)
+		writeVersion(w, r, rev, err)
+	}
+}
+
+// RestoreProductPackSizes handles the product packages sizes version restore requests
+// the restored package sizes are stored as a new version of the product, conditioned by an If-Match header as any other update
+func RestoreProductPackSizes(updater Product) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		version, valid := validateVersionVar(w, r)
+		if !valid {
+			return
+		}
+
+		var (
+			rev product.Revision
+			err error
+		)
+		precondition, conditional := ifMatch(r)
+		if conditional {
+			rev, err = updater.RestoreIf(r.Context(), productID, version, caller(r), precondition)
+		} else {
+			rev, err = updater.Restore(r.Context(), productID, version, caller(r))
+		}
+		if err == nil {
+			w.Header().Set("ETag", packSizesETag(rev.Product.Generation))
+		}
+		writeVersion(w, r, rev, err)
+	}
+}
+
+// DeleteProductPackSizes handles the product packages sizes deletion requests
+// all versions of the product package sizes are deleted, the product being configured again from its first version
+func DeleteProductPackSizes(deleter Product) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		err := deleter.Delete(r.Context(), productID, caller(r))
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeVersion(w http.ResponseWriter, r *http.Request, rev product.Revision, err error) {
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(versionResponse(rev))
+	if err != nil {
+		writeInternalError(w, r)
+	}
+}
+
+func versionResponse(rev product.Revision) PackSizesVersionResponse {
+	return PackSizesVersionResponse{
+		PID:        rev.Product.PID,
+		Version:    rev.Product.Version,
+		Timestamp:  rev.Timestamp,
+		Caller:     rev.Caller,
+		Packs:      rev.Product.Packs,
+		Costs:      rev.Product.Costs,
+		Containers: containerLevelsResponse(rev.Product.Containers),
+	}
+}
+
+func containerLevelsResponse(levels []product.ContainerLevel) []ContainerLevel {
+	var res []ContainerLevel
+	for _, level := range levels {
+		res = append(res, ContainerLevel{Name: level.Name, Capacity: level.Capacity})
+	}
+
+	return res
+}
+
+// packSizesETag returns the entity tag of a product package sizes configuration generation
+// generations are never reused, so that a tag never matches a configuration stored after the product was deleted
+func packSizesETag(generation int) string {
+	return `"` + strconv.Itoa(generation) + `"`
+}
+
+// ifMatch reads the If-Match header of a request as the configuration generations it requires, if it has one
+// weak and unknown entity tags never match, as If-Match requires the strong comparison
+func ifMatch(r *http.Request) (product.Precondition, bool) {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return product.Precondition{}, false
+	}
+
+	var precondition product.Precondition
+	for _, value := range values {
+		for tag := range strings.SplitSeq(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				precondition.Any = true
+				continue
+			}
+
+			generation, err := strconv.Atoi(strings.Trim(tag, `"`))
+			if err == nil && tag == packSizesETag(generation) {
+				precondition.Generations = append(precondition.Generations, generation)
+			}
+		}
+	}
+
+	return precondition, true
+}
+
+// ifNoneMatch checks whether the If-None-Match header of a request holds a given entity tag, weak ones included
+func ifNoneMatch(r *http.Request, etag string) bool {
+	for _, value := range r.Header.Values("If-None-Match") {
+		for tag := range strings.SplitSeq(value, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// caller returns the identity of who is calling the api
+// authenticated callers are identified by their credentials, which can't be overridden by the caller header
+func caller(r *http.Request) string {
+	identity, authenticated := server.ContextIdentity(r.Context())
+	if authenticated {
+		return identity.Subject
+	}
+
+	id := r.Header.Get(callerHeader)
+	if id == "" {
+		return anonymousCaller
+	}
+
+	return id
+}
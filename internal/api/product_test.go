@@ -6,9 +6,15 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/repositories/memory/packsizes"
+	"github.com/ftfmtavares/shipping-optimizer/internal/server"
+	productservice "github.com/ftfmtavares/shipping-optimizer/internal/services/product"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,9 +22,17 @@ import (
 type mockProduct struct {
 	calledPackSizes *bool
 	calledUpdate    *bool
+	calledRestore   *bool
 	pid             *int
+	version         *int
 	packs           *[]int
+	costs           *[]int
+	containers      *[]product.ContainerLevel
+	caller          *string
+	precondition    *product.Precondition
 	response        product.Product
+	revision        product.Revision
+	history         []product.Revision
 	err             error
 }
 
@@ -28,10 +42,63 @@ func (m mockProduct) PackSizes(ctx context.Context, pid int) (product.Product, e
 	return m.response, m.err
 }
 
-func (m mockProduct) Update(ctx context.Context, pid int, packs []int) {
+func (m mockProduct) Update(ctx context.Context, prd product.Product, caller string) (product.Revision, error) {
 	*m.calledUpdate = true
+	*m.pid = prd.PID
+	*m.packs = prd.Packs
+	*m.costs = prd.Costs
+	if m.containers != nil {
+		*m.containers = prd.Containers
+	}
+	if m.caller != nil {
+		*m.caller = caller
+	}
+	if m.err != nil {
+		return product.Revision{}, m.err
+	}
+
+	prd.Version = 2
+	prd.Generation = 5
+	return product.Revision{Product: prd, Caller: caller}, nil
+}
+
+func (m mockProduct) UpdateIf(ctx context.Context, prd product.Product, caller string, precondition product.Precondition) (product.Revision, error) {
+	*m.precondition = precondition
+	if m.err != nil {
+		return product.Revision{}, m.err
+	}
+
+	return m.Update(ctx, prd, caller)
+}
+
+func (m mockProduct) History(ctx context.Context, pid int) []product.Revision {
 	*m.pid = pid
-	*m.packs = packs
+	return m.history
+}
+
+func (m mockProduct) Version(ctx context.Context, pid, version int) (product.Revision, error) {
+	*m.pid = pid
+	*m.version = version
+	return m.revision, m.err
+}
+
+func (m mockProduct) Restore(ctx context.Context, pid, version int, caller string) (product.Revision, error) {
+	*m.calledRestore = true
+	*m.pid = pid
+	*m.version = version
+	*m.caller = caller
+	return m.revision, m.err
+}
+
+func (m mockProduct) RestoreIf(ctx context.Context, pid, version int, caller string, precondition product.Precondition) (product.Revision, error) {
+	*m.precondition = precondition
+	return m.Restore(ctx, pid, version, caller)
+}
+
+func (m mockProduct) Delete(ctx context.Context, pid int, caller string) error {
+	*m.pid = pid
+	*m.caller = caller
+	return m.err
 }
 
 func TestProductPackSizes(t *testing.T) {
@@ -39,16 +106,17 @@ func TestProductPackSizes(t *testing.T) {
 		requestedPackSizes bool
 		requestedPID       int
 	)
-	ctx := context.Background()
 
 	testCases := []struct {
 		desc              string
 		product           mockProduct
 		url               string
 		pid               string
+		ifNoneMatch       string
 		expectedPackSizes bool
 		expectedPID       int
 		expectedCode      int
+		expectedETag      string
 		expectedBody      string
 	}{
 		{
@@ -59,7 +127,7 @@ func TestProductPackSizes(t *testing.T) {
 			expectedPackSizes: false,
 			expectedPID:       0,
 			expectedCode:      http.StatusBadRequest,
-			expectedBody:      "product id not valid\n",
+			expectedBody:      errorBody(CodeInvalidRequest, "product id not valid"),
 		},
 		{
 			desc: "pack sizes retrieval error",
@@ -76,7 +144,24 @@ func TestProductPackSizes(t *testing.T) {
 			expectedPackSizes: true,
 			expectedPID:       1,
 			expectedCode:      http.StatusInternalServerError,
-			expectedBody:      "internal error\n",
+			expectedBody:      errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "pack sizes product not found",
+			product: mockProduct{
+				calledPackSizes: &requestedPackSizes,
+				calledUpdate:    nil,
+				pid:             &requestedPID,
+				packs:           nil,
+				response:        product.Product{},
+				err:             product.ErrProductNotFound,
+			},
+			url:               "/product/2/packsizes",
+			pid:               "2",
+			expectedPackSizes: true,
+			expectedPID:       2,
+			expectedCode:      http.StatusNotFound,
+			expectedBody:      errorBody(CodeProductNotFound, "product not found"),
 		},
 		{
 			desc: "pack sizes retrieval success",
@@ -86,8 +171,10 @@ func TestProductPackSizes(t *testing.T) {
 				pid:             &requestedPID,
 				packs:           nil,
 				response: product.Product{
-					PID:   1,
-					Packs: []int{5, 10, 12},
+					PID:        1,
+					Packs:      []int{5, 10, 12},
+					Version:    3,
+					Generation: 7,
 				},
 				err: nil,
 			},
@@ -96,7 +183,56 @@ func TestProductPackSizes(t *testing.T) {
 			expectedPackSizes: true,
 			expectedPID:       1,
 			expectedCode:      http.StatusOK,
-			expectedBody:      "{\"pid\":1,\"packs\":[5,10,12]}\n",
+			expectedETag:      `"7"`,
+			expectedBody:      "{\"pid\":1,\"version\":3,\"packs\":[5,10,12]}\n",
+		},
+		{
+			desc: "pack sizes changed since the given entity tag",
+			product: mockProduct{
+				calledPackSizes: &requestedPackSizes,
+				pid:             &requestedPID,
+				response:        product.Product{PID: 1, Packs: []int{5, 10, 12}, Version: 3, Generation: 7},
+			},
+			url:               "/product/1/packsizes",
+			pid:               "1",
+			ifNoneMatch:       `"3"`,
+			expectedPackSizes: true,
+			expectedPID:       1,
+			expectedCode:      http.StatusOK,
+			expectedETag:      `"7"`,
+			expectedBody:      "{\"pid\":1,\"version\":3,\"packs\":[5,10,12]}\n",
+		},
+		{
+			desc: "pack sizes not modified",
+			product: mockProduct{
+				calledPackSizes: &requestedPackSizes,
+				pid:             &requestedPID,
+				response:        product.Product{PID: 1, Packs: []int{5, 10, 12}, Version: 3, Generation: 7},
+			},
+			url:               "/product/1/packsizes",
+			pid:               "1",
+			ifNoneMatch:       `"3", W/"7"`,
+			expectedPackSizes: true,
+			expectedPID:       1,
+			expectedCode:      http.StatusNotModified,
+			expectedETag:      `"7"`,
+			expectedBody:      "",
+		},
+		{
+			desc: "pack sizes not modified for any version",
+			product: mockProduct{
+				calledPackSizes: &requestedPackSizes,
+				pid:             &requestedPID,
+				response:        product.Product{PID: 1, Packs: []int{5, 10, 12}, Version: 3, Generation: 7},
+			},
+			url:               "/product/1/packsizes",
+			pid:               "1",
+			ifNoneMatch:       "*",
+			expectedPackSizes: true,
+			expectedPID:       1,
+			expectedCode:      http.StatusNotModified,
+			expectedETag:      `"7"`,
+			expectedBody:      "",
 		},
 	}
 
@@ -107,11 +243,15 @@ func TestProductPackSizes(t *testing.T) {
 
 			req := httptest.NewRequest(http.MethodGet, tC.url, nil)
 			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			if tC.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tC.ifNoneMatch)
+			}
 			rec := httptest.NewRecorder()
 
-			ProductPackSizes(ctx, tC.product)(rec, req)
+			ProductPackSizes(tC.product)(rec, req)
 
 			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedETag, rec.Header().Get("ETag"))
 			assert.Equal(t, tC.expectedBody, rec.Body.String())
 
 			assert.Equal(t, tC.expectedPackSizes, requestedPackSizes)
@@ -122,23 +262,26 @@ func TestProductPackSizes(t *testing.T) {
 
 func TestStoreProductPackSizes(t *testing.T) {
 	var (
-		requestedUpdate bool
-		requestedPID    int
-		requestedPacks  []int
+		requestedUpdate     bool
+		requestedPID        int
+		requestedPacks      []int
+		requestedCosts      []int
+		requestedContainers []product.ContainerLevel
 	)
-	ctx := context.Background()
 
 	testCases := []struct {
-		desc           string
-		product        mockProduct
-		url            string
-		pid            string
-		body           string
-		expectedUpdate bool
-		expectedPID    int
-		expectedPacks  []int
-		expectedCode   int
-		expectedBody   string
+		desc               string
+		product            mockProduct
+		url                string
+		pid                string
+		body               string
+		expectedUpdate     bool
+		expectedPID        int
+		expectedPacks      []int
+		expectedCosts      []int
+		expectedContainers []product.ContainerLevel
+		expectedCode       int
+		expectedBody       string
 	}{
 		{
 			desc:           "invalid product id",
@@ -150,7 +293,7 @@ func TestStoreProductPackSizes(t *testing.T) {
 			expectedPID:    0,
 			expectedPacks:  nil,
 			expectedCode:   http.StatusBadRequest,
-			expectedBody:   "product id not valid\n",
+			expectedBody:   errorBody(CodeInvalidRequest, "product id not valid"),
 		},
 		{
 			desc:           "invalid request json payload",
@@ -162,7 +305,7 @@ func TestStoreProductPackSizes(t *testing.T) {
 			expectedPID:    0,
 			expectedPacks:  nil,
 			expectedCode:   http.StatusBadRequest,
-			expectedBody:   "invalid request payload\n",
+			expectedBody:   errorBody(CodeInvalidRequest, "invalid request payload"),
 		},
 		{
 			desc:           "negative pack sizes request",
@@ -174,7 +317,19 @@ func TestStoreProductPackSizes(t *testing.T) {
 			expectedPID:    0,
 			expectedPacks:  nil,
 			expectedCode:   http.StatusBadRequest,
-			expectedBody:   "pack sizes must be positive integers\n",
+			expectedBody:   errorBody(CodeInvalidRequest, "pack sizes must be positive integers"),
+		},
+		{
+			desc:           "too large pack sizes request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[4000000000000]}",
+			expectedUpdate: false,
+			expectedPID:    0,
+			expectedPacks:  nil,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "pack size too large: maximum 100000"),
 		},
 		{
 			desc: "pack sizes update success",
@@ -183,6 +338,7 @@ func TestStoreProductPackSizes(t *testing.T) {
 				calledUpdate:    &requestedUpdate,
 				pid:             &requestedPID,
 				packs:           &requestedPacks,
+				costs:           &requestedCosts,
 				response: product.Product{
 					PID:   1,
 					Packs: []int{5, 10, 12},
@@ -195,8 +351,133 @@ func TestStoreProductPackSizes(t *testing.T) {
 			expectedUpdate: true,
 			expectedPID:    1,
 			expectedPacks:  []int{5, 10, 12},
+			expectedCosts:  nil,
+			expectedCode:   http.StatusOK,
+			expectedBody:   "{\"pid\":1,\"version\":2,\"packs\":[5,10,12]}\n",
+		},
+		{
+			desc: "pack sizes update storage unavailable",
+			product: mockProduct{
+				calledUpdate: &requestedUpdate,
+				pid:          &requestedPID,
+				packs:        &requestedPacks,
+				costs:        &requestedCosts,
+				err:          product.ErrStorageUnavailable,
+			},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12]}",
+			expectedUpdate: true,
+			expectedPID:    1,
+			expectedPacks:  []int{5, 10, 12},
+			expectedCosts:  nil,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedBody:   errorBody(CodeStorageUnavailable, "package sizes storage unavailable, retry later"),
+		},
+		{
+			desc:           "mismatching pack costs request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12],\"costs\":[7,12]}",
+			expectedUpdate: false,
+			expectedPID:    0,
+			expectedPacks:  nil,
+			expectedCosts:  nil,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "pack costs must match pack sizes"),
+		},
+		{
+			desc:           "negative pack costs request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12],\"costs\":[7,-12,13]}",
+			expectedUpdate: false,
+			expectedPID:    0,
+			expectedPacks:  nil,
+			expectedCosts:  nil,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "pack costs must be non negative integers"),
+		},
+		{
+			desc: "pack sizes with costs update success",
+			product: mockProduct{
+				calledPackSizes: nil,
+				calledUpdate:    &requestedUpdate,
+				pid:             &requestedPID,
+				packs:           &requestedPacks,
+				costs:           &requestedCosts,
+				err:             nil,
+			},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12],\"costs\":[7,12,13]}",
+			expectedUpdate: true,
+			expectedPID:    1,
+			expectedPacks:  []int{5, 10, 12},
+			expectedCosts:  []int{7, 12, 13},
 			expectedCode:   http.StatusOK,
-			expectedBody:   "{\"pid\":1,\"packs\":[5,10,12]}\n",
+			expectedBody:   "{\"pid\":1,\"version\":2,\"packs\":[5,10,12],\"costs\":[7,12,13]}\n",
+		},
+		{
+			desc:           "container without name request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12],\"containers\":[{\"name\":\"\",\"capacity\":20}]}",
+			expectedUpdate: false,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "container names must be specified"),
+		},
+		{
+			desc:           "invalid container capacity request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12],\"containers\":[{\"name\":\"carton\",\"capacity\":0}]}",
+			expectedUpdate: false,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "container capacities must be positive integers"),
+		},
+		{
+			desc:           "repeated container name request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5,10,12],\"containers\":[{\"name\":\"box\",\"capacity\":4},{\"name\":\"box\",\"capacity\":8}]}",
+			expectedUpdate: false,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "container names must not be repeated"),
+		},
+		{
+			desc:           "too many container levels request",
+			product:        mockProduct{},
+			url:            "/product/1/packsizes",
+			pid:            "1",
+			body:           "{\"packs\":[5],\"containers\":[{\"name\":\"a\",\"capacity\":1},{\"name\":\"b\",\"capacity\":1},{\"name\":\"c\",\"capacity\":1},{\"name\":\"d\",\"capacity\":1},{\"name\":\"e\",\"capacity\":1},{\"name\":\"f\",\"capacity\":1}]}",
+			expectedUpdate: false,
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "too many container levels: maximum 5"),
+		},
+		{
+			desc: "pack sizes with containers update success",
+			product: mockProduct{
+				calledUpdate: &requestedUpdate,
+				pid:          &requestedPID,
+				packs:        &requestedPacks,
+				costs:        &requestedCosts,
+				containers:   &requestedContainers,
+			},
+			url:                "/product/1/packsizes",
+			pid:                "1",
+			body:               "{\"packs\":[5,10,12],\"containers\":[{\"name\":\"carton\",\"capacity\":20},{\"name\":\"pallet\",\"capacity\":40}]}",
+			expectedUpdate:     true,
+			expectedPID:        1,
+			expectedPacks:      []int{5, 10, 12},
+			expectedContainers: []product.ContainerLevel{{Name: "carton", Capacity: 20}, {Name: "pallet", Capacity: 40}},
+			expectedCode:       http.StatusOK,
+			expectedBody:       "{\"pid\":1,\"version\":2,\"packs\":[5,10,12],\"containers\":[{\"name\":\"carton\",\"capacity\":20},{\"name\":\"pallet\",\"capacity\":40}]}\n",
 		},
 	}
 
@@ -205,12 +486,14 @@ func TestStoreProductPackSizes(t *testing.T) {
 			requestedUpdate = false
 			requestedPID = 0
 			requestedPacks = nil
+			requestedCosts = nil
+			requestedContainers = nil
 
 			req := httptest.NewRequest(http.MethodPost, tC.url, bytes.NewReader([]byte(tC.body)))
 			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
 			rec := httptest.NewRecorder()
 
-			StoreProductPackSizes(ctx, tC.product)(rec, req)
+			StoreProductPackSizes(tC.product)(rec, req)
 
 			assert.Equal(t, tC.expectedCode, rec.Code)
 			assert.Equal(t, tC.expectedBody, rec.Body.String())
@@ -218,6 +501,577 @@ func TestStoreProductPackSizes(t *testing.T) {
 			assert.Equal(t, tC.expectedUpdate, requestedUpdate)
 			assert.Equal(t, tC.expectedPID, requestedPID)
 			assert.Equal(t, tC.expectedPacks, requestedPacks)
+			assert.Equal(t, tC.expectedCosts, requestedCosts)
+			assert.Equal(t, tC.expectedContainers, requestedContainers)
+		})
+	}
+}
+
+func TestStoreProductPackSizesIfMatch(t *testing.T) {
+	var (
+		requestedUpdate       bool
+		requestedPID          int
+		requestedPacks        []int
+		requestedCosts        []int
+		requestedPrecondition product.Precondition
+	)
+
+	testCases := []struct {
+		desc                 string
+		ifMatch              []string
+		err                  error
+		expectedUpdate       bool
+		expectedPrecondition product.Precondition
+		expectedCode         int
+		expectedETag         string
+		expectedBody         string
+	}{
+		{
+			desc:                 "unconditional update",
+			ifMatch:              nil,
+			expectedUpdate:       true,
+			expectedPrecondition: product.Precondition{},
+			expectedCode:         http.StatusOK,
+			expectedETag:         `"5"`,
+			expectedBody:         "{\"pid\":1,\"version\":2,\"packs\":[5,10,12]}\n",
+		},
+		{
+			desc:                 "update of the given version",
+			ifMatch:              []string{`"1"`},
+			expectedUpdate:       true,
+			expectedPrecondition: product.Precondition{Generations: []int{1}},
+			expectedCode:         http.StatusOK,
+			expectedETag:         `"5"`,
+			expectedBody:         "{\"pid\":1,\"version\":2,\"packs\":[5,10,12]}\n",
+		},
+		{
+			desc:                 "update of any version",
+			ifMatch:              []string{"*"},
+			expectedUpdate:       true,
+			expectedPrecondition: product.Precondition{Any: true},
+			expectedCode:         http.StatusOK,
+			expectedETag:         `"5"`,
+			expectedBody:         "{\"pid\":1,\"version\":2,\"packs\":[5,10,12]}\n",
+		},
+		{
+			desc:                 "stale update",
+			ifMatch:              []string{`"1", "3"`, `"4"`},
+			err:                  product.ErrVersionConflict,
+			expectedUpdate:       false,
+			expectedPrecondition: product.Precondition{Generations: []int{1, 3, 4}},
+			expectedCode:         http.StatusPreconditionFailed,
+			expectedETag:         "",
+			expectedBody:         errorBody(CodeVersionConflict, "package sizes changed since the given version"),
+		},
+		{
+			desc:                 "weak and unknown entity tags",
+			ifMatch:              []string{`W/"1", "+2", 3, "v4"`},
+			err:                  product.ErrVersionConflict,
+			expectedUpdate:       false,
+			expectedPrecondition: product.Precondition{},
+			expectedCode:         http.StatusPreconditionFailed,
+			expectedETag:         "",
+			expectedBody:         errorBody(CodeVersionConflict, "package sizes changed since the given version"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedUpdate = false
+			requestedPID = 0
+			requestedPrecondition = product.Precondition{}
+			prd := mockProduct{
+				calledUpdate: &requestedUpdate,
+				pid:          &requestedPID,
+				packs:        &requestedPacks,
+				costs:        &requestedCosts,
+				precondition: &requestedPrecondition,
+				err:          tC.err,
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/product/1/packsizes", strings.NewReader("{\"packs\":[5,10,12]}"))
+			req = mux.SetURLVars(req, map[string]string{"pid": "1"})
+			for _, value := range tC.ifMatch {
+				req.Header.Add("If-Match", value)
+			}
+			rec := httptest.NewRecorder()
+
+			StoreProductPackSizes(prd)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedETag, rec.Header().Get("ETag"))
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			assert.Equal(t, tC.expectedUpdate, requestedUpdate)
+			assert.Equal(t, tC.expectedPrecondition, requestedPrecondition)
+		})
+	}
+}
+
+func TestPackSizesETagAfterRecreation(t *testing.T) {
+	configurator := productservice.NewConfigurator(packsizes.NewPackSizes())
+	request := func(handler http.HandlerFunc, method, url, body string, vars map[string]string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req = mux.SetURLVars(req, vars)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	pid := map[string]string{"pid": "1"}
+
+	rec := request(StoreProductPackSizes(configurator), http.MethodPost, "/product/1/packsizes", `{"packs":[5,10]}`, pid, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	stale := rec.Header().Get("ETag")
+
+	rec = request(DeleteProductPackSizes(configurator), http.MethodDelete, "/product/1/packsizes", "", pid, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// the product is configured again from its first version, which is not the one tagged before the deletion
+	rec = request(StoreProductPackSizes(configurator), http.MethodPost, "/product/1/packsizes", `{"packs":[5,10]}`, pid, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"pid\":1,\"version\":1,\"packs\":[5,10]}\n", rec.Body.String())
+	current := rec.Header().Get("ETag")
+	assert.NotEqual(t, stale, current)
+
+	rec = request(StoreProductPackSizes(configurator), http.MethodPost, "/product/1/packsizes", `{"packs":[7]}`, pid, http.Header{"If-Match": {stale}})
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = request(RestoreProductPackSizes(configurator), http.MethodPost, "/product/1/packsizes/versions/1/restore", "", map[string]string{"pid": "1", "version": "1"}, http.Header{"If-Match": {stale}})
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = request(ProductPackSizes(configurator), http.MethodGet, "/product/1/packsizes", "", pid, http.Header{"If-None-Match": {stale}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, current, rec.Header().Get("ETag"))
+
+	rec = request(StoreProductPackSizes(configurator), http.MethodPost, "/product/1/packsizes", `{"packs":[7]}`, pid, http.Header{"If-Match": {current}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"pid\":1,\"version\":2,\"packs\":[7]}\n", rec.Body.String())
+}
+
+func TestProductPackSizesHistory(t *testing.T) {
+	var requestedPID int
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc         string
+		product      mockProduct
+		pid          string
+		expectedPID  int
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			desc:         "invalid product id",
+			product:      mockProduct{},
+			pid:          "abc",
+			expectedPID:  0,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc: "empty history",
+			product: mockProduct{
+				pid: &requestedPID,
+			},
+			pid:          "1",
+			expectedPID:  1,
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"pid\":1,\"versions\":[]}\n",
+		},
+		{
+			desc: "history retrieval success",
+			product: mockProduct{
+				pid: &requestedPID,
+				history: []product.Revision{
+					{
+						Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 1},
+						Timestamp: timestamp,
+						Caller:    "creator",
+					},
+					{
+						Product:   product.Product{PID: 1, Packs: []int{5, 10, 12}, Costs: []int{7, 12, 13}, Version: 2},
+						Timestamp: timestamp.Add(time.Hour),
+						Caller:    "editor",
+					},
+				},
+			},
+			pid:          "1",
+			expectedPID:  1,
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"pid\":1,\"versions\":[" +
+				"{\"pid\":1,\"version\":1,\"timestamp\":\"2025-11-10T02:26:35Z\",\"caller\":\"creator\",\"packs\":[5,10]}," +
+				"{\"pid\":1,\"version\":2,\"timestamp\":\"2025-11-10T03:26:35Z\",\"caller\":\"editor\",\"packs\":[5,10,12],\"costs\":[7,12,13]}]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedPID = 0
+
+			req := httptest.NewRequest(http.MethodGet, "/product/"+tC.pid+"/packsizes/history", nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			ProductPackSizesHistory(tC.product)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedPID, requestedPID)
+		})
+	}
+}
+
+func TestProductPackSizesVersion(t *testing.T) {
+	var (
+		requestedPID     int
+		requestedVersion int
+	)
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc            string
+		product         mockProduct
+		version         string
+		expectedVersion int
+		expectedCode    int
+		expectedBody    string
+	}{
+		{
+			desc:            "invalid version",
+			product:         mockProduct{},
+			version:         "abc",
+			expectedVersion: 0,
+			expectedCode:    http.StatusBadRequest,
+			expectedBody:    errorBody(CodeInvalidRequest, "version not valid"),
+		},
+		{
+			desc: "version not found",
+			product: mockProduct{
+				pid:     &requestedPID,
+				version: &requestedVersion,
+				err:     product.ErrVersionNotFound,
+			},
+			version:         "3",
+			expectedVersion: 3,
+			expectedCode:    http.StatusNotFound,
+			expectedBody:    errorBody(CodeVersionNotFound, "version not found"),
+		},
+		{
+			desc: "version retrieval error",
+			product: mockProduct{
+				pid:     &requestedPID,
+				version: &requestedVersion,
+				err:     errors.New("error"),
+			},
+			version:         "1",
+			expectedVersion: 1,
+			expectedCode:    http.StatusInternalServerError,
+			expectedBody:    errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "version retrieval success",
+			product: mockProduct{
+				pid:     &requestedPID,
+				version: &requestedVersion,
+				revision: product.Revision{
+					Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 1},
+					Timestamp: timestamp,
+					Caller:    "creator",
+				},
+			},
+			version:         "1",
+			expectedVersion: 1,
+			expectedCode:    http.StatusOK,
+			expectedBody:    "{\"pid\":1,\"version\":1,\"timestamp\":\"2025-11-10T02:26:35Z\",\"caller\":\"creator\",\"packs\":[5,10]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedPID = 0
+			requestedVersion = 0
+
+			req := httptest.NewRequest(http.MethodGet, "/product/1/packsizes/versions/"+tC.version, nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": "1", "version": tC.version})
+			rec := httptest.NewRecorder()
+
+			ProductPackSizesVersion(tC.product)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedVersion, requestedVersion)
+		})
+	}
+}
+
+func TestRestoreProductPackSizes(t *testing.T) {
+	var (
+		requestedRestore bool
+		requestedPID     int
+		requestedVersion int
+		requestedCaller  string
+	)
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc            string
+		product         mockProduct
+		version         string
+		caller          string
+		identity        *auth.Identity
+		expectedRestore bool
+		expectedVersion int
+		expectedCaller  string
+		expectedCode    int
+		expectedETag    string
+		expectedBody    string
+	}{
+		{
+			desc:            "invalid version",
+			product:         mockProduct{},
+			version:         "-1",
+			caller:          "",
+			expectedRestore: false,
+			expectedVersion: 0,
+			expectedCaller:  "",
+			expectedCode:    http.StatusBadRequest,
+			expectedBody:    errorBody(CodeInvalidRequest, "version not valid"),
+		},
+		{
+			desc: "version not found",
+			product: mockProduct{
+				err: product.ErrVersionNotFound,
+			},
+			version:         "3",
+			caller:          "",
+			expectedRestore: true,
+			expectedVersion: 3,
+			expectedCaller:  "anonymous",
+			expectedCode:    http.StatusNotFound,
+			expectedBody:    errorBody(CodeVersionNotFound, "version not found"),
+		},
+		{
+			desc: "version restore success",
+			product: mockProduct{
+				revision: product.Revision{
+					Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 4, Generation: 9},
+					Timestamp: timestamp,
+					Caller:    "editor",
+				},
+			},
+			version:         "1",
+			caller:          "editor",
+			expectedRestore: true,
+			expectedVersion: 1,
+			expectedCaller:  "editor",
+			expectedCode:    http.StatusOK,
+			expectedETag:    `"9"`,
+			expectedBody:    "{\"pid\":1,\"version\":4,\"timestamp\":\"2025-11-10T02:26:35Z\",\"caller\":\"editor\",\"packs\":[5,10]}\n",
+		},
+		{
+			desc: "authenticated caller restore",
+			product: mockProduct{
+				revision: product.Revision{
+					Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 4, Generation: 9},
+					Timestamp: timestamp,
+					Caller:    "ci",
+				},
+			},
+			version:         "1",
+			caller:          "someone-else",
+			identity:        &auth.Identity{Subject: "ci", Role: auth.Editor},
+			expectedRestore: true,
+			expectedVersion: 1,
+			expectedCaller:  "ci",
+			expectedCode:    http.StatusOK,
+			expectedETag:    `"9"`,
+			expectedBody:    "{\"pid\":1,\"version\":4,\"timestamp\":\"2025-11-10T02:26:35Z\",\"caller\":\"ci\",\"packs\":[5,10]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedRestore = false
+			requestedPID = 0
+			requestedVersion = 0
+			requestedCaller = ""
+			tC.product.calledRestore = &requestedRestore
+			tC.product.pid = &requestedPID
+			tC.product.version = &requestedVersion
+			tC.product.caller = &requestedCaller
+
+			req := httptest.NewRequest(http.MethodPost, "/product/1/packsizes/versions/"+tC.version+"/restore", nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": "1", "version": tC.version})
+			if tC.caller != "" {
+				req.Header.Set("X-Caller", tC.caller)
+			}
+			if tC.identity != nil {
+				req = req.WithContext(server.WithIdentity(req.Context(), *tC.identity))
+			}
+			rec := httptest.NewRecorder()
+
+			RestoreProductPackSizes(tC.product)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedETag, rec.Header().Get("ETag"))
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedRestore, requestedRestore)
+			assert.Equal(t, tC.expectedVersion, requestedVersion)
+			assert.Equal(t, tC.expectedCaller, requestedCaller)
+		})
+	}
+}
+
+func TestRestoreProductPackSizesIfMatch(t *testing.T) {
+	var (
+		requestedRestore      bool
+		requestedPID          int
+		requestedVersion      int
+		requestedCaller       string
+		requestedPrecondition product.Precondition
+	)
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc                 string
+		ifMatch              []string
+		err                  error
+		expectedPrecondition product.Precondition
+		expectedCode         int
+		expectedETag         string
+		expectedBody         string
+	}{
+		{
+			desc:                 "unconditional restore",
+			ifMatch:              nil,
+			expectedPrecondition: product.Precondition{},
+			expectedCode:         http.StatusOK,
+			expectedETag:         `"9"`,
+			expectedBody:         "{\"pid\":1,\"version\":4,\"timestamp\":\"2025-11-10T02:26:35Z\",\"caller\":\"editor\",\"packs\":[5,10]}\n",
+		},
+		{
+			desc:                 "restore over the given configuration",
+			ifMatch:              []string{`"8"`},
+			expectedPrecondition: product.Precondition{Generations: []int{8}},
+			expectedCode:         http.StatusOK,
+			expectedETag:         `"9"`,
+			expectedBody:         "{\"pid\":1,\"version\":4,\"timestamp\":\"2025-11-10T02:26:35Z\",\"caller\":\"editor\",\"packs\":[5,10]}\n",
+		},
+		{
+			desc:                 "stale restore",
+			ifMatch:              []string{`"6"`},
+			err:                  product.ErrVersionConflict,
+			expectedPrecondition: product.Precondition{Generations: []int{6}},
+			expectedCode:         http.StatusPreconditionFailed,
+			expectedETag:         "",
+			expectedBody:         errorBody(CodeVersionConflict, "package sizes changed since the given version"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedRestore = false
+			requestedPrecondition = product.Precondition{}
+			prd := mockProduct{
+				calledRestore: &requestedRestore,
+				pid:           &requestedPID,
+				version:       &requestedVersion,
+				caller:        &requestedCaller,
+				precondition:  &requestedPrecondition,
+				revision: product.Revision{
+					Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 4, Generation: 9},
+					Timestamp: timestamp,
+					Caller:    "editor",
+				},
+				err: tC.err,
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/product/1/packsizes/versions/1/restore", nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": "1", "version": "1"})
+			req.Header.Set("X-Caller", "editor")
+			for _, value := range tC.ifMatch {
+				req.Header.Add("If-Match", value)
+			}
+			rec := httptest.NewRecorder()
+
+			RestoreProductPackSizes(prd)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedETag, rec.Header().Get("ETag"))
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			assert.True(t, requestedRestore)
+			assert.Equal(t, tC.expectedPrecondition, requestedPrecondition)
+		})
+	}
+}
+
+func TestDeleteProductPackSizes(t *testing.T) {
+	var (
+		requestedPID    int
+		requestedCaller string
+	)
+
+	testCases := []struct {
+		desc           string
+		product        mockProduct
+		pid            string
+		expectedPID    int
+		expectedCaller string
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			desc:         "invalid product id",
+			product:      mockProduct{},
+			pid:          "a",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc: "product not found",
+			product: mockProduct{
+				err: product.ErrProductNotFound,
+			},
+			pid:            "2",
+			expectedPID:    2,
+			expectedCaller: "planner",
+			expectedCode:   http.StatusNotFound,
+			expectedBody:   errorBody(CodeProductNotFound, "product not found"),
+		},
+		{
+			desc:           "product deleted",
+			product:        mockProduct{},
+			pid:            "1",
+			expectedPID:    1,
+			expectedCaller: "planner",
+			expectedCode:   http.StatusNoContent,
+			expectedBody:   "",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedPID = 0
+			requestedCaller = ""
+			tC.product.pid = &requestedPID
+			tC.product.caller = &requestedCaller
+
+			req := httptest.NewRequest(http.MethodDelete, "/product/"+tC.pid+"/packsizes", nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			req.Header.Set("X-Caller", "planner")
+			rec := httptest.NewRecorder()
+
+			DeleteProductPackSizes(tC.product)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+			assert.Equal(t, tC.expectedPID, requestedPID)
+			assert.Equal(t, tC.expectedCaller, requestedCaller)
 		})
 	}
 }
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// Content types of the shipping calculation range streams
+const (
+	NDJSONContentType = "application/x-ndjson"
+	CSVContentType    = "text/csv"
+)
+
+const (
+	// rangeFlushRows is how many plans are written between flushes of a range stream
+	rangeFlushRows = 256
+	// rangeWriteTimeout is how long a range stream waits for the client to take every flushed batch
+	rangeWriteTimeout = 30 * time.Second
+)
+
+// RangeOptimizer provides the order packages calculation service of ranges of orders
+type RangeOptimizer interface {
+	CalculateRange(context.Context, order.RangeOrder, func(order.Shipping) error) error
+}
+
+// a rangeEncoder writes the plans of a range stream in a given format
+type rangeEncoder interface {
+	encode(order.Shipping) error
+	flush() error
+}
+
+// ShippingCalculationRange handles the orders range calculation requests, streaming a plan per order as NDJSON or CSV as accepted by the caller
+// ranges ending above the order limit are rejected, plans are flushed as they are calculated, and calculations stop once the caller goes away
+// failures after the stream started can't be responded, so the stream is cut short and the failure is logged
+func ShippingCalculationRange(calculator RangeOptimizer, limit *OrderLimit) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		from, to, valid := validateRangeQuery(w, r, limit.Max())
+		if !valid {
+			return
+		}
+
+		version, valid := validateVersionQuery(w, r)
+		if !valid {
+			return
+		}
+
+		contentType, valid := validateRangeAccept(w, r)
+		if !valid {
+			return
+		}
+
+		// the server write timeout is replaced by a deadline renewed on every flush, so that only stalled clients are dropped
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Now().Add(rangeWriteTimeout))
+
+		var (
+			enc  rangeEncoder
+			rows int
+		)
+		emit := func(sd order.Shipping) error {
+			if enc == nil {
+				w.Header().Set("Content-Type", contentType)
+				w.WriteHeader(http.StatusOK)
+				enc = newRangeEncoder(w, contentType)
+			}
+
+			err := enc.encode(sd)
+			if err != nil {
+				return err
+			}
+
+			rows++
+			if rows%rangeFlushRows == 0 {
+				return flushRange(rc, enc)
+			}
+
+			return nil
+		}
+
+		err := calculator.CalculateRange(r.Context(), order.RangeOrder{
+			PID:     productID,
+			From:    from,
+			To:      to,
+			Version: version,
+		}, emit)
+		if err != nil && enc == nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		// the plans already calculated are still sent when the stream is cut short
+		flushErr := flushRange(rc, enc)
+		if err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			instrumentation.ContextLogger(r.Context()).Warning("Shipping range stream interrupted", "error", err.Error(), "orders", rows)
+		}
+	}
+}
+
+// flushRange sends the buffered plans to the client and renews the write deadline
+func flushRange(rc *http.ResponseController, enc rangeEncoder) error {
+	err := enc.flush()
+	if err != nil {
+		return err
+	}
+
+	// writers not supporting flushes or deadlines, such as test recorders, keep the written plans
+	rc.Flush()
+	rc.SetWriteDeadline(time.Now().Add(rangeWriteTimeout))
+
+	return nil
+}
+
+func newRangeEncoder(w http.ResponseWriter, contentType string) rangeEncoder {
+	if contentType == CSVContentType {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"version", "order", "total", "excess", "packscount", "cost", "packs"})
+		return csvEncoder{w: cw}
+	}
+
+	bw := bufio.NewWriter(w)
+	return ndjsonEncoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// an ndjsonEncoder writes every plan as a JSON line
+type ndjsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e ndjsonEncoder) encode(sd order.Shipping) error {
+	return e.enc.Encode(ShippingCalculationResponse{
+		Version:    sd.Version,
+		Order:      sd.Order,
+		Packs:      packsResponse(sd.Packs),
+		PacksCount: sd.PacksCount,
+		Total:      sd.Total,
+		Excess:     sd.Excess,
+		Cost:       sd.Cost,
+	})
+}
+
+func (e ndjsonEncoder) flush() error {
+	return e.w.Flush()
+}
+
+// a csvEncoder writes every plan as a CSV record, its packages as space separated size:quantity pairs
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e csvEncoder) encode(sd order.Shipping) error {
+	packs := make([]string, 0, len(sd.Packs))
+	for _, pack := range packsResponse(sd.Packs) {
+		packs = append(packs, strconv.Itoa(pack.PackSize)+":"+strconv.Itoa(pack.Quantity))
+	}
+
+	return e.w.Write([]string{
+		strconv.Itoa(sd.Version),
+		strconv.Itoa(sd.Order),
+		strconv.Itoa(sd.Total),
+		strconv.Itoa(sd.Excess),
+		strconv.Itoa(sd.PacksCount),
+		strconv.Itoa(sd.Cost),
+		strings.Join(packs, " "),
+	})
+}
+
+func (e csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// rangeContentType returns the stream content type accepted by the caller, NDJSON when any is accepted
+// media types are taken in the given order, their quality values being ignored
+func rangeContentType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return NDJSONContentType, true
+	}
+
+	for entry := range strings.SplitSeq(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case NDJSONContentType, "application/*", "*/*":
+			return NDJSONContentType, true
+		case CSVContentType, "text/*":
+			return CSVContentType, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRangeOptimizer struct {
+	called    *bool
+	req       *order.RangeOrder
+	shippings []order.Shipping
+	err       error
+}
+
+func (m mockRangeOptimizer) CalculateRange(ctx context.Context, req order.RangeOrder, emit func(order.Shipping) error) error {
+	*m.called = true
+	*m.req = req
+	for _, sd := range m.shippings {
+		err := emit(sd)
+		if err != nil {
+			return err
+		}
+	}
+	return m.err
+}
+
+func TestShippingCalculationRange(t *testing.T) {
+	var (
+		requestedCalculation bool
+		requestedRange       order.RangeOrder
+	)
+
+	shippings := []order.Shipping{
+		{PID: 1, Version: 2, Order: 11, Packs: []order.Pack{{PackSize: 5, Quantity: 0}, {PackSize: 12, Quantity: 1}}, PacksCount: 1, Total: 12, Excess: 1},
+		{PID: 1, Version: 2, Order: 13, Packs: []order.Pack{{PackSize: 5, Quantity: 1}, {PackSize: 10, Quantity: 1}}, PacksCount: 2, Total: 15, Excess: 2},
+	}
+
+	testCases := []struct {
+		desc                string
+		calculator          mockRangeOptimizer
+		pid                 string
+		query               string
+		accept              string
+		expectedCalculation bool
+		expectedRange       order.RangeOrder
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			desc:                "invalid pid",
+			pid:                 "a",
+			query:               "to=10",
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc:                "missing to",
+			pid:                 "1",
+			query:               "from=10",
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInvalidRequest, "to query parameter must be specified"),
+		},
+		{
+			desc:                "invalid from",
+			pid:                 "1",
+			query:               "from=0&to=10",
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInvalidRequest, "from query parameter not valid"),
+		},
+		{
+			desc:                "to below from",
+			pid:                 "1",
+			query:               "from=10&to=9",
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInvalidRequest, "to query parameter not valid"),
+		},
+		{
+			desc:                "order too large",
+			pid:                 "1",
+			query:               "from=10000000000&to=10000000001",
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInvalidRequest, "order too large: maximum 10000000000"),
+		},
+		{
+			desc:                "too many orders",
+			pid:                 "1",
+			query:               "to=1000001",
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInvalidRequest, "too many orders: maximum 1000000"),
+		},
+		{
+			desc:                "not acceptable",
+			pid:                 "1",
+			query:               "to=10",
+			accept:              "application/xml",
+			expectedCode:        http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeNotAcceptable, "accept header must allow application/x-ndjson or text/csv"),
+		},
+		{
+			desc:                "failure before streaming",
+			calculator:          mockRangeOptimizer{err: product.ErrProductNotFound},
+			pid:                 "1",
+			query:               "to=10",
+			expectedCalculation: true,
+			expectedRange:       order.RangeOrder{PID: 1, From: 1, To: 10},
+			expectedCode:        http.StatusNotFound,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeProductNotFound, "product not found"),
+		},
+		{
+			desc:                "ndjson stream",
+			calculator:          mockRangeOptimizer{shippings: shippings},
+			pid:                 "1",
+			query:               "from=11&to=13&version=2",
+			accept:              "application/x-ndjson",
+			expectedCalculation: true,
+			expectedRange:       order.RangeOrder{PID: 1, From: 11, To: 13, Version: 2},
+			expectedCode:        http.StatusOK,
+			expectedContentType: NDJSONContentType,
+			expectedBody: "{\"version\":2,\"order\":11,\"packs\":[{\"packsize\":12,\"quantity\":1}],\"packscount\":1,\"total\":12,\"excess\":1,\"cost\":0}\n" +
+				"{\"version\":2,\"order\":13,\"packs\":[{\"packsize\":5,\"quantity\":1},{\"packsize\":10,\"quantity\":1}],\"packscount\":2,\"total\":15,\"excess\":2,\"cost\":0}\n",
+		},
+		{
+			desc:                "csv stream",
+			calculator:          mockRangeOptimizer{shippings: shippings},
+			pid:                 "1",
+			query:               "from=11&to=13",
+			accept:              "text/csv, application/json;q=0.5",
+			expectedCalculation: true,
+			expectedRange:       order.RangeOrder{PID: 1, From: 11, To: 13},
+			expectedCode:        http.StatusOK,
+			expectedContentType: CSVContentType,
+			expectedBody:        "version,order,total,excess,packscount,cost,packs\n2,11,12,1,1,0,12:1\n2,13,15,2,2,0,5:1 10:1\n",
+		},
+		{
+			desc:                "failure after streaming",
+			calculator:          mockRangeOptimizer{shippings: shippings[:1], err: context.Canceled},
+			pid:                 "1",
+			query:               "from=11&to=13",
+			accept:              "text/csv",
+			expectedCalculation: true,
+			expectedRange:       order.RangeOrder{PID: 1, From: 11, To: 13},
+			expectedCode:        http.StatusOK,
+			expectedContentType: CSVContentType,
+			expectedBody:        "version,order,total,excess,packscount,cost,packs\n2,11,12,1,1,0,12:1\n",
+		},
+		{
+			desc:                "service error",
+			calculator:          mockRangeOptimizer{err: errors.New("error")},
+			pid:                 "1",
+			query:               "to=10",
+			accept:              "*/*",
+			expectedCalculation: true,
+			expectedRange:       order.RangeOrder{PID: 1, From: 1, To: 10},
+			expectedCode:        http.StatusInternalServerError,
+			expectedContentType: "application/json",
+			expectedBody:        errorBody(CodeInternalError, "internal error"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedCalculation = false
+			requestedRange = order.RangeOrder{}
+			tC.calculator.called = &requestedCalculation
+			tC.calculator.req = &requestedRange
+
+			req := httptest.NewRequest(http.MethodGet, "/product/"+tC.pid+"/shipping-calculation/range?"+tC.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			if tC.accept != "" {
+				req.Header.Set("Accept", tC.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			ShippingCalculationRange(tC.calculator, NewOrderLimit(config.MaxOrderLimit))(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedContentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedCalculation, requestedCalculation)
+			assert.Equal(t, tC.expectedRange, requestedRange)
+		})
+	}
+}
+
+func TestShippingCalculationRangeFlushes(t *testing.T) {
+	var (
+		called bool
+		req    order.RangeOrder
+	)
+	shippings := make([]order.Shipping, rangeFlushRows+1)
+	for i := range shippings {
+		shippings[i] = order.Shipping{Order: i + 1, Total: i + 1}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/product/1/shipping-calculation/range?to=257", nil)
+	r = mux.SetURLVars(r, map[string]string{"pid": "1"})
+	rec := httptest.NewRecorder()
+
+	ShippingCalculationRange(mockRangeOptimizer{called: &called, req: &req, shippings: shippings}, NewOrderLimit(config.MaxOrderLimit))(rec, r)
+
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, rangeFlushRows+1, bytes.Count(rec.Body.Bytes(), []byte("\n")))
+}
+
+func TestRangeContentType(t *testing.T) {
+	testCases := []struct {
+		accept   string
+		expected string
+		found    bool
+	}{
+		{accept: "", expected: NDJSONContentType, found: true},
+		{accept: "*/*", expected: NDJSONContentType, found: true},
+		{accept: "application/x-ndjson", expected: NDJSONContentType, found: true},
+		{accept: "text/csv; charset=utf-8", expected: CSVContentType, found: true},
+		{accept: "application/xml, text/*;q=0.8", expected: CSVContentType, found: true},
+		{accept: "application/xml", found: false},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.accept, func(t *testing.T) {
+			contentType, found := rangeContentType(tC.accept)
+
+			assert.Equal(t, tC.expected, contentType)
+			assert.Equal(t, tC.found, found)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+)
+
+// PackSizesRecommender provides the package sizes recommendation service
+type PackSizesRecommender interface {
+	Recommend(context.Context, order.RecommendationRequest) (order.Recommendation, error)
+}
+
+// DemandRequest holds how many orders of a given quantity are expected
+type DemandRequest struct {
+	Qty   int `json:"qty"`
+	Count int `json:"count"`
+}
+
+// PackSizesRecommendationRequest holds the package sizes recommendation request
+// the expected orders are given either as a histogram or as a sample of order quantities
+type PackSizesRecommendationRequest struct {
+	Histogram []DemandRequest `json:"histogram"`
+	Sample    []int           `json:"sample"`
+	MaxSizes  int             `json:"maxsizes"`
+	MinSize   int             `json:"minsize"`
+	MaxSize   int             `json:"maxsize"`
+	Results   int             `json:"results"`
+}
+
+// PackSetResponse holds the expected metrics of a package sizes set
+// the deltas compare it to the stored configuration, being omitted when the product has none
+type PackSetResponse struct {
+	Packs          []int    `json:"packs"`
+	ExpectedExcess float64  `json:"expectedexcess"`
+	ExpectedPacks  float64  `json:"expectedpacks"`
+	ExcessDelta    *float64 `json:"excessdelta,omitempty"`
+	PacksDelta     *float64 `json:"packsdelta,omitempty"`
+}
+
+// PackSizesRecommendationResponse holds the recommended package sizes sets, from the best one
+type PackSizesRecommendationResponse struct {
+	PID     int               `json:"pid"`
+	Version int               `json:"version"`
+	Current *PackSetResponse  `json:"current"`
+	Sets    []PackSetResponse `json:"sets"`
+}
+
+// RecommendPackSizes handles the product package sizes recommendation requests
+// searches are stopped once the caller goes away or the timeout expires, not being limited when it is zero
+func RecommendPackSizes(recommender PackSizesRecommender, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		req, valid := validateRecommendationRequest(w, r, productID)
+		if !valid {
+			return
+		}
+
+		ctx, cancel := solveContext(r, timeout)
+		defer cancel()
+
+		rec, err := recommender.Recommend(ctx, req)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		res := PackSizesRecommendationResponse{
+			PID:     rec.PID,
+			Version: rec.Version,
+			Sets:    make([]PackSetResponse, len(rec.Sets)),
+		}
+		if rec.Current != nil {
+			current := packSetResponse(*rec.Current)
+			res.Current = &current
+		}
+		for i, set := range rec.Sets {
+			res.Sets[i] = packSetResponse(set)
+			if rec.Current != nil {
+				excessDelta := set.ExpectedExcess - rec.Current.ExpectedExcess
+				packsDelta := set.ExpectedPacks - rec.Current.ExpectedPacks
+				res.Sets[i].ExcessDelta = &excessDelta
+				res.Sets[i].PacksDelta = &packsDelta
+			}
+		}
+
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			writeInternalError(w, r)
+		}
+	}
+}
+
+func packSetResponse(metrics order.PackSetMetrics) PackSetResponse {
+	return PackSetResponse{
+		Packs:          metrics.Packs,
+		ExpectedExcess: metrics.ExpectedExcess,
+		ExpectedPacks:  metrics.ExpectedPacks,
+	}
+}
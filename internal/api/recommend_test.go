@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRecommender struct {
+	called   *bool
+	req      *order.RecommendationRequest
+	response order.Recommendation
+	err      error
+}
+
+func (m mockRecommender) Recommend(ctx context.Context, req order.RecommendationRequest) (order.Recommendation, error) {
+	*m.called = true
+	*m.req = req
+	return m.response, m.err
+}
+
+func TestRecommendPackSizes(t *testing.T) {
+	var (
+		requestedRecommendation bool
+		requestedRequest        order.RecommendationRequest
+	)
+
+	testCases := []struct {
+		desc                   string
+		recommender            mockRecommender
+		pid                    string
+		body                   string
+		expectedRecommendation bool
+		expectedRequest        order.RecommendationRequest
+		expectedCode           int
+		expectedBody           string
+	}{
+		{
+			desc:         "invalid pid",
+			pid:          "a",
+			body:         `{"sample":[10],"maxsizes":1,"minsize":1,"maxsize":10}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc:         "invalid payload",
+			pid:          "1",
+			body:         `{"sample":`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "invalid request payload"),
+		},
+		{
+			desc:         "histogram and sample",
+			pid:          "1",
+			body:         `{"histogram":[{"qty":10,"count":2}],"sample":[10],"maxsizes":1,"minsize":1,"maxsize":10}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "either histogram or sample must be specified"),
+		},
+		{
+			desc:         "no demand",
+			pid:          "1",
+			body:         `{"maxsizes":1,"minsize":1,"maxsize":10}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "either histogram or sample must be specified"),
+		},
+		{
+			desc:         "demand quantity too large",
+			pid:          "1",
+			body:         `{"sample":[1000001],"maxsizes":1,"minsize":1,"maxsize":10}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "demand quantities must be between 1 and 1000000"),
+		},
+		{
+			desc:         "invalid demand count",
+			pid:          "1",
+			body:         `{"histogram":[{"qty":10,"count":0}],"maxsizes":1,"minsize":1,"maxsize":10}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "demand counts must be positive integers"),
+		},
+		{
+			desc:         "too many sizes",
+			pid:          "1",
+			body:         `{"sample":[10],"maxsizes":6,"minsize":1,"maxsize":10}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "maxsizes must be between 1 and 5"),
+		},
+		{
+			desc:         "invalid size bounds",
+			pid:          "1",
+			body:         `{"sample":[10],"maxsizes":1,"minsize":10,"maxsize":5}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "size bounds not valid: minsize must be positive and not above maxsize, at most 100000"),
+		},
+		{
+			desc:         "too many results",
+			pid:          "1",
+			body:         `{"sample":[10],"maxsizes":1,"minsize":1,"maxsize":10,"results":11}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errorBody(CodeInvalidRequest, "results must be between 1 and 10"),
+		},
+		{
+			desc: "service error",
+			recommender: mockRecommender{
+				err: errors.New("error"),
+			},
+			pid:                    "1",
+			body:                   `{"sample":[10,20,10],"maxsizes":2,"minsize":5,"maxsize":12}`,
+			expectedRecommendation: true,
+			expectedRequest: order.RecommendationRequest{
+				PID:      1,
+				Demand:   []order.Demand{{Qty: 10, Count: 1}, {Qty: 20, Count: 1}, {Qty: 10, Count: 1}},
+				MaxSizes: 2,
+				MinSize:  5,
+				MaxSize:  12,
+				Results:  3,
+			},
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "recommendation compared to the stored configuration",
+			recommender: mockRecommender{
+				response: order.Recommendation{
+					PID:     1,
+					Version: 2,
+					Current: &order.PackSetMetrics{Packs: []int{5, 12}, ExpectedExcess: 1, ExpectedPacks: 2.5},
+					Sets: []order.PackSetMetrics{
+						{Packs: []int{10}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+					},
+				},
+			},
+			pid:                    "1",
+			body:                   `{"histogram":[{"qty":10,"count":3},{"qty":20,"count":1}],"maxsizes":1,"minsize":5,"maxsize":12,"results":1}`,
+			expectedRecommendation: true,
+			expectedRequest: order.RecommendationRequest{
+				PID:      1,
+				Demand:   []order.Demand{{Qty: 10, Count: 3}, {Qty: 20, Count: 1}},
+				MaxSizes: 1,
+				MinSize:  5,
+				MaxSize:  12,
+				Results:  1,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"pid\":1,\"version\":2,\"current\":{\"packs\":[5,12],\"expectedexcess\":1,\"expectedpacks\":2.5}," +
+				"\"sets\":[{\"packs\":[10],\"expectedexcess\":0,\"expectedpacks\":1.25,\"excessdelta\":-1,\"packsdelta\":-1.25}]}\n",
+		},
+		{
+			desc: "recommendation without stored configuration",
+			recommender: mockRecommender{
+				response: order.Recommendation{
+					PID: 1,
+					Sets: []order.PackSetMetrics{
+						{Packs: []int{10}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+					},
+				},
+			},
+			pid:                    "1",
+			body:                   `{"histogram":[{"qty":10,"count":3},{"qty":20,"count":1}],"maxsizes":1,"minsize":5,"maxsize":12,"results":1}`,
+			expectedRecommendation: true,
+			expectedRequest: order.RecommendationRequest{
+				PID:      1,
+				Demand:   []order.Demand{{Qty: 10, Count: 3}, {Qty: 20, Count: 1}},
+				MaxSizes: 1,
+				MinSize:  5,
+				MaxSize:  12,
+				Results:  1,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"pid\":1,\"version\":0,\"current\":null,\"sets\":[{\"packs\":[10],\"expectedexcess\":0,\"expectedpacks\":1.25}]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedRecommendation = false
+			requestedRequest = order.RecommendationRequest{}
+			tC.recommender.called = &requestedRecommendation
+			tC.recommender.req = &requestedRequest
+
+			req := httptest.NewRequest(http.MethodPost, "/product/"+tC.pid+"/packsizes/recommend", bytes.NewBufferString(tC.body))
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			RecommendPackSizes(tC.recommender, 0)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedRecommendation, requestedRecommendation)
+			assert.Equal(t, tC.expectedRequest, requestedRequest)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
 )
@@ -22,54 +23,167 @@ type PackResponse struct {
 
 // ShippingCalculationResponse holds the orders calculation response
 type ShippingCalculationResponse struct {
-	Order      int            `json:"order"`
+	Version      int                  `json:"version"`
+	Order        int                  `json:"order"`
+	Packs        []PackResponse       `json:"packs"`
+	PacksCount   int                  `json:"packscount"`
+	Total        int                  `json:"total"`
+	Excess       int                  `json:"excess"`
+	Cost         int                  `json:"cost"`
+	Alternatives []PlanResponse       `json:"alternatives,omitempty"`
+	Containers   []ContainerResponse  `json:"containers,omitempty"`
+	Levels       []LevelUsageResponse `json:"levels,omitempty"`
+}
+
+// ContainerResponse holds identical containers of a packaging level, along with what each one of them holds
+// containers of the first level hold packages, and the ones of the next levels hold containers of the level below
+type ContainerResponse struct {
+	Level    string              `json:"level"`
+	Count    int                 `json:"count"`
+	Packs    []PackResponse      `json:"packs,omitempty"`
+	Contents []ContainerResponse `json:"contents,omitempty"`
+	Unused   int                 `json:"unused"`
+}
+
+// LevelUsageResponse holds how many containers of a packaging level a plan uses and the capacity they leave empty
+type LevelUsageResponse struct {
+	Level      string `json:"level"`
+	Capacity   int    `json:"capacity"`
+	Containers int    `json:"containers"`
+	Unused     int    `json:"unused"`
+}
+
+// PlanResponse holds information of a ranked shipping plan alternative
+type PlanResponse struct {
 	Packs      []PackResponse `json:"packs"`
 	PacksCount int            `json:"packscount"`
 	Total      int            `json:"total"`
 	Excess     int            `json:"excess"`
+	Cost       int            `json:"cost"`
 }
 
 // OrderCalculation handles the orders calculation requests
-func OrderCalculation(ctx context.Context, calculator ShippingOptimizer) http.HandlerFunc {
+// orders above the limit are rejected, and calculations are stopped once the caller goes away or the timeout expires, not being limited when it is zero
+func OrderCalculation(calculator ShippingOptimizer, limit *OrderLimit, timeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		productID, valid := validatePidVar(w, r)
 		if !valid {
 			return
 		}
 
-		orderQty, valid := validateOrderQuery(w, r)
+		orderQty, valid := validateOrderQuery(w, r, limit.Max())
+		if !valid {
+			return
+		}
+
+		objective, maxExcess, valid := validateObjectiveQuery(w, r)
 		if !valid {
 			return
 		}
 
+		alternatives, valid := validateAlternativesQuery(w, r)
+		if !valid {
+			return
+		}
+
+		version, valid := validateVersionQuery(w, r)
+		if !valid {
+			return
+		}
+
+		ctx, cancel := solveContext(r, timeout)
+		defer cancel()
+
 		sd, err := calculator.Calculate(ctx, order.Order{
-			PID: productID,
-			Qty: orderQty,
+			PID:          productID,
+			Qty:          orderQty,
+			Objective:    objective,
+			MaxExcess:    maxExcess,
+			Alternatives: alternatives,
+			Version:      version,
 		})
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			writeServiceError(w, r, err)
 			return
 		}
 
-		packs := make([]PackResponse, 0, len(sd.Packs))
-		for _, pack := range sd.Packs {
-			if pack.Quantity > 0 {
-				packs = append(packs, PackResponse{
-					PackSize: pack.PackSize,
-					Quantity: pack.Quantity,
-				})
-			}
+		var plans []PlanResponse
+		for _, alternative := range sd.Alternatives {
+			plans = append(plans, PlanResponse{
+				Packs:      packsResponse(alternative.Packs),
+				PacksCount: alternative.PacksCount,
+				Total:      alternative.Total,
+				Excess:     alternative.Excess,
+				Cost:       alternative.Cost,
+			})
 		}
 
 		err = json.NewEncoder(w).Encode(ShippingCalculationResponse{
-			Order:      sd.Order,
-			Packs:      packs,
-			PacksCount: sd.PacksCount,
-			Total:      sd.Total,
-			Excess:     sd.Excess,
+			Version:      sd.Version,
+			Order:        sd.Order,
+			Packs:        packsResponse(sd.Packs),
+			PacksCount:   sd.PacksCount,
+			Total:        sd.Total,
+			Excess:       sd.Excess,
+			Cost:         sd.Cost,
+			Alternatives: plans,
+			Containers:   containersResponse(sd.Containers),
+			Levels:       levelsResponse(sd.Levels),
 		})
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			writeInternalError(w, r)
 		}
 	}
 }
+
+// solveContext returns the request context limited by a solve timeout, if any
+func solveContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+func packsResponse(packs []order.Pack) []PackResponse {
+	res := make([]PackResponse, 0, len(packs))
+	for _, pack := range packs {
+		if pack.Quantity > 0 {
+			res = append(res, PackResponse{
+				PackSize: pack.PackSize,
+				Quantity: pack.Quantity,
+			})
+		}
+	}
+
+	return res
+}
+
+func containersResponse(containers []order.Container) []ContainerResponse {
+	var res []ContainerResponse
+	for _, container := range containers {
+		res = append(res, ContainerResponse{
+			Level:    container.Level,
+			Count:    container.Count,
+			Packs:    packsResponse(container.Packs),
+			Contents: containersResponse(container.Contents),
+			Unused:   container.Unused,
+		})
+	}
+
+	return res
+}
+
+func levelsResponse(levels []order.LevelUsage) []LevelUsageResponse {
+	var res []LevelUsageResponse
+	for _, level := range levels {
+		res = append(res, LevelUsageResponse{
+			Level:      level.Level,
+			Capacity:   level.Capacity,
+			Containers: level.Containers,
+			Unused:     level.Unused,
+		})
+	}
+
+	return res
+}
@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
@@ -30,7 +33,6 @@ func TestShippingCalculation(t *testing.T) {
 		requestedCalculation bool
 		requestedOrder       order.Order
 	)
-	ctx := context.Background()
 
 	testCases := []struct {
 		desc                string
@@ -50,7 +52,7 @@ func TestShippingCalculation(t *testing.T) {
 			expectedCalculation: false,
 			expectedOrder:       order.Order{},
 			expectedCode:        http.StatusBadRequest,
-			expectedBody:        "product id not valid\n",
+			expectedBody:        errorBody(CodeInvalidRequest, "product id not valid"),
 		},
 		{
 			desc:                "missing order quantity",
@@ -60,7 +62,7 @@ func TestShippingCalculation(t *testing.T) {
 			expectedCalculation: false,
 			expectedOrder:       order.Order{},
 			expectedCode:        http.StatusBadRequest,
-			expectedBody:        "order query parameter must be specified\n",
+			expectedBody:        errorBody(CodeInvalidRequest, "order query parameter must be specified"),
 		},
 		{
 			desc:                "invalid order quantity",
@@ -70,17 +72,96 @@ func TestShippingCalculation(t *testing.T) {
 			expectedCalculation: false,
 			expectedOrder:       order.Order{},
 			expectedCode:        http.StatusBadRequest,
-			expectedBody:        "order query parameter not valid\n",
+			expectedBody:        errorBody(CodeInvalidRequest, "order query parameter not valid"),
 		},
 		{
 			desc:                "maximum order quantity exceeded",
 			calculator:          mockShippingCalculator{},
-			url:                 "/product/1/shipping-calculation?order=10000001",
+			url:                 "/product/1/shipping-calculation?order=10000000001",
 			pid:                 "1",
 			expectedCalculation: false,
 			expectedOrder:       order.Order{},
 			expectedCode:        http.StatusBadRequest,
-			expectedBody:        "order too large: maximum 10000000\n",
+			expectedBody:        errorBody(CodeInvalidRequest, "order too large: maximum 10000000000"),
+		},
+		{
+			desc:                "invalid objective",
+			calculator:          mockShippingCalculator{},
+			url:                 "/product/1/shipping-calculation?order=21&objective=abc",
+			pid:                 "1",
+			expectedCalculation: false,
+			expectedOrder:       order.Order{},
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "objective query parameter not valid"),
+		},
+		{
+			desc:                "missing maximum excess",
+			calculator:          mockShippingCalculator{},
+			url:                 "/product/1/shipping-calculation?order=21&objective=min-cost-capped",
+			pid:                 "1",
+			expectedCalculation: false,
+			expectedOrder:       order.Order{},
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "maxexcess query parameter must be specified"),
+		},
+		{
+			desc:                "invalid maximum excess",
+			calculator:          mockShippingCalculator{},
+			url:                 "/product/1/shipping-calculation?order=21&objective=min-cost-capped&maxexcess=-1",
+			pid:                 "1",
+			expectedCalculation: false,
+			expectedOrder:       order.Order{},
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "maxexcess query parameter not valid"),
+		},
+		{
+			desc:                "invalid alternatives",
+			calculator:          mockShippingCalculator{},
+			url:                 "/product/1/shipping-calculation?order=21&alternatives=0",
+			pid:                 "1",
+			expectedCalculation: false,
+			expectedOrder:       order.Order{},
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "alternatives query parameter not valid"),
+		},
+		{
+			desc:                "too many alternatives",
+			calculator:          mockShippingCalculator{},
+			url:                 "/product/1/shipping-calculation?order=21&alternatives=11",
+			pid:                 "1",
+			expectedCalculation: false,
+			expectedOrder:       order.Order{},
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "too many alternatives: maximum 10"),
+		},
+		{
+			desc:                "invalid version",
+			calculator:          mockShippingCalculator{},
+			url:                 "/product/1/shipping-calculation?order=21&version=0",
+			pid:                 "1",
+			expectedCalculation: false,
+			expectedOrder:       order.Order{},
+			expectedCode:        http.StatusBadRequest,
+			expectedBody:        errorBody(CodeInvalidRequest, "version query parameter not valid"),
+		},
+		{
+			desc: "version not found",
+			calculator: mockShippingCalculator{
+				called:   &requestedCalculation,
+				order:    &requestedOrder,
+				response: order.Shipping{},
+				err:      product.ErrVersionNotFound,
+			},
+			url:                 "/product/1/shipping-calculation?order=21&version=3",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID:     1,
+				Qty:     21,
+				Version: 3,
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: errorBody(CodeVersionNotFound, "version not found"),
 		},
 		{
 			desc: "calculation error",
@@ -98,7 +179,43 @@ func TestShippingCalculation(t *testing.T) {
 				Qty: 21,
 			},
 			expectedCode: http.StatusInternalServerError,
-			expectedBody: "internal error\n",
+			expectedBody: errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "insufficient stock",
+			calculator: mockShippingCalculator{
+				called:   &requestedCalculation,
+				order:    &requestedOrder,
+				response: order.Shipping{},
+				err:      product.ErrInsufficientStock,
+			},
+			url:                 "/product/1/shipping-calculation?order=21",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID: 1,
+				Qty: 21,
+			},
+			expectedCode: http.StatusConflict,
+			expectedBody: errorBody(CodeInsufficientStock, "insufficient stock"),
+		},
+		{
+			desc: "order too large for the available stock",
+			calculator: mockShippingCalculator{
+				called:   &requestedCalculation,
+				order:    &requestedOrder,
+				response: order.Shipping{},
+				err:      order.ErrOrderTooLarge,
+			},
+			url:                 "/product/1/shipping-calculation?order=2000000",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID: 1,
+				Qty: 2000000,
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: errorBody(CodeOrderTooLarge, "order too large for the available stock"),
 		},
 		{
 			desc: "calculation success",
@@ -132,7 +249,154 @@ func TestShippingCalculation(t *testing.T) {
 				Qty: 21,
 			},
 			expectedCode: http.StatusOK,
-			expectedBody: "{\"order\":21,\"packs\":[{\"packsize\":10,\"quantity\":1},{\"packsize\":12,\"quantity\":1}],\"packscount\":2,\"total\":22,\"excess\":1}\n",
+			expectedBody: "{\"version\":0,\"order\":21,\"packs\":[{\"packsize\":10,\"quantity\":1},{\"packsize\":12,\"quantity\":1}],\"packscount\":2,\"total\":22,\"excess\":1,\"cost\":0}\n",
+		},
+		{
+			desc: "cost calculation success",
+			calculator: mockShippingCalculator{
+				called: &requestedCalculation,
+				order:  &requestedOrder,
+				response: order.Shipping{
+					PID:   1,
+					Order: 21,
+					Packs: []order.Pack{
+						{
+							PackSize: 5,
+							Quantity: 5,
+						},
+					},
+					PacksCount: 5,
+					Total:      25,
+					Excess:     4,
+					Cost:       35,
+				},
+				err: nil,
+			},
+			url:                 "/product/1/shipping-calculation?order=21&objective=min-cost-capped&maxexcess=5",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID:       1,
+				Qty:       21,
+				Objective: order.MinCostCappedExcess,
+				MaxExcess: 5,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"version\":0,\"order\":21,\"packs\":[{\"packsize\":5,\"quantity\":5}],\"packscount\":5,\"total\":25,\"excess\":4,\"cost\":35}\n",
+		},
+		{
+			desc: "alternatives calculation success",
+			calculator: mockShippingCalculator{
+				called: &requestedCalculation,
+				order:  &requestedOrder,
+				response: order.Shipping{
+					PID:        1,
+					Order:      21,
+					Packs:      []order.Pack{{PackSize: 10, Quantity: 1}, {PackSize: 12, Quantity: 1}},
+					PacksCount: 2,
+					Total:      22,
+					Excess:     1,
+					Alternatives: []order.Plan{
+						{
+							Packs:      []order.Pack{{PackSize: 10, Quantity: 1}, {PackSize: 12, Quantity: 1}},
+							PacksCount: 2,
+							Total:      22,
+							Excess:     1,
+						},
+						{
+							Packs:      []order.Pack{{PackSize: 5, Quantity: 2}, {PackSize: 12, Quantity: 1}},
+							PacksCount: 3,
+							Total:      22,
+							Excess:     1,
+						},
+					},
+				},
+				err: nil,
+			},
+			url:                 "/product/1/shipping-calculation?order=21&alternatives=2",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID:          1,
+				Qty:          21,
+				Alternatives: 2,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"version\":0,\"order\":21,\"packs\":[{\"packsize\":10,\"quantity\":1},{\"packsize\":12,\"quantity\":1}],\"packscount\":2,\"total\":22,\"excess\":1,\"cost\":0," +
+				"\"alternatives\":[{\"packs\":[{\"packsize\":10,\"quantity\":1},{\"packsize\":12,\"quantity\":1}],\"packscount\":2,\"total\":22,\"excess\":1,\"cost\":0}," +
+				"{\"packs\":[{\"packsize\":5,\"quantity\":2},{\"packsize\":12,\"quantity\":1}],\"packscount\":3,\"total\":22,\"excess\":1,\"cost\":0}]}\n",
+		},
+		{
+			desc: "nested containers calculation success",
+			calculator: mockShippingCalculator{
+				called: &requestedCalculation,
+				order:  &requestedOrder,
+				response: order.Shipping{
+					PID:        1,
+					Order:      21,
+					Packs:      []order.Pack{{PackSize: 10, Quantity: 1}, {PackSize: 12, Quantity: 1}},
+					PacksCount: 2,
+					Total:      22,
+					Excess:     1,
+					Containers: []order.Container{
+						{Level: "pallet", Count: 1, Unused: 3, Contents: []order.Container{
+							{Level: "carton", Count: 1, Packs: []order.Pack{{PackSize: 12, Quantity: 1}, {PackSize: 10, Quantity: 1}}, Unused: 2},
+						}},
+					},
+					Levels: []order.LevelUsage{
+						{Level: "carton", Capacity: 4, Containers: 1, Unused: 2},
+						{Level: "pallet", Capacity: 4, Containers: 1, Unused: 3},
+					},
+				},
+				err: nil,
+			},
+			url:                 "/product/1/shipping-calculation?order=21",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID: 1,
+				Qty: 21,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"version\":0,\"order\":21,\"packs\":[{\"packsize\":10,\"quantity\":1},{\"packsize\":12,\"quantity\":1}],\"packscount\":2,\"total\":22,\"excess\":1,\"cost\":0," +
+				"\"containers\":[{\"level\":\"pallet\",\"count\":1,\"contents\":[{\"level\":\"carton\",\"count\":1,\"packs\":[{\"packsize\":12,\"quantity\":1},{\"packsize\":10,\"quantity\":1}],\"unused\":2}],\"unused\":3}]," +
+				"\"levels\":[{\"level\":\"carton\",\"capacity\":4,\"containers\":1,\"unused\":2},{\"level\":\"pallet\",\"capacity\":4,\"containers\":1,\"unused\":3}]}\n",
+		},
+		{
+			desc: "versioned calculation success",
+			calculator: mockShippingCalculator{
+				called: &requestedCalculation,
+				order:  &requestedOrder,
+				response: order.Shipping{
+					PID:     1,
+					Version: 2,
+					Order:   21,
+					Packs: []order.Pack{
+						{
+							PackSize: 5,
+							Quantity: 1,
+						},
+						{
+							PackSize: 10,
+							Quantity: 2,
+						},
+					},
+					PacksCount: 3,
+					Total:      25,
+					Excess:     4,
+				},
+				err: nil,
+			},
+			url:                 "/product/1/shipping-calculation?order=21&version=2",
+			pid:                 "1",
+			expectedCalculation: true,
+			expectedOrder: order.Order{
+				PID:     1,
+				Qty:     21,
+				Version: 2,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"version\":2,\"order\":21,\"packs\":[{\"packsize\":5,\"quantity\":1},{\"packsize\":10,\"quantity\":2}],\"packscount\":3,\"total\":25,\"excess\":4,\"cost\":0}\n",
 		},
 	}
 
@@ -145,7 +409,7 @@ func TestShippingCalculation(t *testing.T) {
 			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
 			rec := httptest.NewRecorder()
 
-			OrderCalculation(ctx, tC.calculator)(rec, req)
+			OrderCalculation(tC.calculator, NewOrderLimit(config.MaxOrderLimit), 0)(rec, req)
 
 			assert.Equal(t, tC.expectedCode, rec.Code)
 			assert.Equal(t, tC.expectedBody, rec.Body.String())
@@ -155,3 +419,50 @@ func TestShippingCalculation(t *testing.T) {
 		})
 	}
 }
+
+type blockingCalculator struct{}
+
+func (m blockingCalculator) Calculate(ctx context.Context, req order.Order) (order.Shipping, error) {
+	<-ctx.Done()
+	return order.Shipping{}, ctx.Err()
+}
+
+func TestShippingCalculationTimeout(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/product/1/shipping-calculation?order=21", nil)
+	req = mux.SetURLVars(req, map[string]string{"pid": "1"})
+	rec := httptest.NewRecorder()
+
+	OrderCalculation(blockingCalculator{}, NewOrderLimit(config.MaxOrderLimit), time.Millisecond)(rec, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, errorBody(CodeTimeout, "calculation took longer than allowed"), rec.Body.String())
+}
+
+func TestShippingCalculationOrderLimit(t *testing.T) {
+	var (
+		requestedCalculation bool
+		requestedOrder       order.Order
+	)
+	limit := NewOrderLimit(1000)
+	handler := OrderCalculation(mockShippingCalculator{called: &requestedCalculation, order: &requestedOrder}, limit, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/product/1/shipping-calculation?order=1001", nil)
+	req = mux.SetURLVars(req, map[string]string{"pid": "1"})
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errorBody(CodeInvalidRequest, "order too large: maximum 1000"), rec.Body.String())
+	assert.False(t, requestedCalculation)
+
+	limit.Set(2000)
+	assert.Equal(t, 2000, limit.Max())
+
+	req = httptest.NewRequest(http.MethodGet, "/product/1/shipping-calculation?order=1001", nil)
+	req = mux.SetURLVars(req, map[string]string{"pid": "1"})
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1001, requestedOrder.Qty)
+}
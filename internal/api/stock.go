@@ -0,0 +1,123 @@
+// Package api handles the api requests and definitions
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+)
+
+// Stock provides the product packages stock management service
+type Stock interface {
+	Stock(context.Context, int) (product.Stock, error)
+	Set(context.Context, product.Stock)
+	Decrement(context.Context, product.Stock) (product.Stock, error)
+}
+
+// StockLevel holds the available quantity of a package size
+type StockLevel struct {
+	PackSize int `json:"packsize"`
+	Quantity int `json:"quantity"`
+}
+
+// ProductStockResponse holds the product packages stock response
+type ProductStockResponse struct {
+	PID   int          `json:"pid"`
+	Stock []StockLevel `json:"stock"`
+}
+
+// ProductStockRequest holds the product packages stock update request
+type ProductStockRequest struct {
+	Stock []StockLevel `json:"stock"`
+}
+
+// ProductStock handles the product packages stock retrieval requests
+func ProductStock(retriever Stock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		stk, err := retriever.Stock(r.Context(), productID)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		writeProductStock(w, r, stk)
+	}
+}
+
+// SetProductStock handles the product packages stock replacement requests
+func SetProductStock(updater Stock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		levels, valid := validateStockRequest(w, r)
+		if !valid {
+			return
+		}
+
+		stk := product.Stock{
+			PID:    productID,
+			Levels: levels,
+		}
+		updater.Set(r.Context(), stk)
+
+		writeProductStock(w, r, stk)
+	}
+}
+
+// DecrementProductStock handles the product packages stock decrement requests
+func DecrementProductStock(updater Stock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, valid := validatePidVar(w, r)
+		if !valid {
+			return
+		}
+
+		levels, valid := validateStockRequest(w, r)
+		if !valid {
+			return
+		}
+
+		stk, err := updater.Decrement(r.Context(), product.Stock{
+			PID:    productID,
+			Levels: levels,
+		})
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		writeProductStock(w, r, stk)
+	}
+}
+
+func writeProductStock(w http.ResponseWriter, r *http.Request, stk product.Stock) {
+	levels := make([]StockLevel, 0, len(stk.Levels))
+	for size, qty := range stk.Levels {
+		levels = append(levels, StockLevel{
+			PackSize: size,
+			Quantity: qty,
+		})
+	}
+	slices.SortFunc(levels, func(a, b StockLevel) int {
+		return a.PackSize - b.PackSize
+	})
+
+	err := json.NewEncoder(w).Encode(ProductStockResponse{
+		PID:   stk.PID,
+		Stock: levels,
+	})
+	if err != nil {
+		writeInternalError(w, r)
+	}
+}
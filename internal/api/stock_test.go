@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockStock struct {
+	calledStock     *bool
+	calledSet       *bool
+	calledDecrement *bool
+	stock           *product.Stock
+	response        product.Stock
+	err             error
+}
+
+func (m mockStock) Stock(ctx context.Context, pid int) (product.Stock, error) {
+	*m.calledStock = true
+	*m.stock = product.Stock{PID: pid}
+	return m.response, m.err
+}
+
+func (m mockStock) Set(ctx context.Context, stk product.Stock) {
+	*m.calledSet = true
+	*m.stock = stk
+}
+
+func (m mockStock) Decrement(ctx context.Context, stk product.Stock) (product.Stock, error) {
+	*m.calledDecrement = true
+	*m.stock = stk
+	return m.response, m.err
+}
+
+func TestProductStock(t *testing.T) {
+	var (
+		requestedStock bool
+		requested      product.Stock
+	)
+
+	testCases := []struct {
+		desc           string
+		stock          mockStock
+		pid            string
+		expectedCalled bool
+		expectedStock  product.Stock
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			desc:           "invalid product id",
+			stock:          mockStock{},
+			pid:            "abc",
+			expectedCalled: false,
+			expectedStock:  product.Stock{},
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc: "stock retrieval error",
+			stock: mockStock{
+				calledStock: &requestedStock,
+				stock:       &requested,
+				err:         errors.New("error"),
+			},
+			pid:            "1",
+			expectedCalled: true,
+			expectedStock:  product.Stock{PID: 1},
+			expectedCode:   http.StatusInternalServerError,
+			expectedBody:   errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "stock retrieval success",
+			stock: mockStock{
+				calledStock: &requestedStock,
+				stock:       &requested,
+				response: product.Stock{
+					PID:    1,
+					Levels: map[int]int{12: 3, 5: 10},
+				},
+			},
+			pid:            "1",
+			expectedCalled: true,
+			expectedStock:  product.Stock{PID: 1},
+			expectedCode:   http.StatusOK,
+			expectedBody:   "{\"pid\":1,\"stock\":[{\"packsize\":5,\"quantity\":10},{\"packsize\":12,\"quantity\":3}]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedStock = false
+			requested = product.Stock{}
+
+			req := httptest.NewRequest(http.MethodGet, "/product/"+tC.pid+"/stock", nil)
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			ProductStock(tC.stock)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedCalled, requestedStock)
+			assert.Equal(t, tC.expectedStock, requested)
+		})
+	}
+}
+
+func TestSetProductStock(t *testing.T) {
+	var (
+		requestedSet bool
+		requested    product.Stock
+	)
+
+	testCases := []struct {
+		desc           string
+		stock          mockStock
+		pid            string
+		body           string
+		expectedCalled bool
+		expectedStock  product.Stock
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			desc:           "invalid product id",
+			stock:          mockStock{},
+			pid:            "abc",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":10}]}",
+			expectedCalled: false,
+			expectedStock:  product.Stock{},
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc:           "invalid request json payload",
+			stock:          mockStock{},
+			pid:            "1",
+			body:           "invalid",
+			expectedCalled: false,
+			expectedStock:  product.Stock{},
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "invalid request payload"),
+		},
+		{
+			desc:           "negative stock quantity",
+			stock:          mockStock{},
+			pid:            "1",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":-1}]}",
+			expectedCalled: false,
+			expectedStock:  product.Stock{},
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "stock quantities must be non negative integers"),
+		},
+		{
+			desc:           "repeated pack size",
+			stock:          mockStock{},
+			pid:            "1",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":1},{\"packsize\":5,\"quantity\":2}]}",
+			expectedCalled: false,
+			expectedStock:  product.Stock{},
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "pack sizes must not be repeated"),
+		},
+		{
+			desc: "stock set success",
+			stock: mockStock{
+				calledSet: &requestedSet,
+				stock:     &requested,
+			},
+			pid:            "1",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":10}]}",
+			expectedCalled: true,
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 10},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"pid\":1,\"stock\":[{\"packsize\":5,\"quantity\":10}]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedSet = false
+			requested = product.Stock{}
+
+			req := httptest.NewRequest(http.MethodPut, "/product/"+tC.pid+"/stock", bytes.NewReader([]byte(tC.body)))
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			SetProductStock(tC.stock)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedCalled, requestedSet)
+			assert.Equal(t, tC.expectedStock, requested)
+		})
+	}
+}
+
+func TestDecrementProductStock(t *testing.T) {
+	var (
+		requestedDecrement bool
+		requested          product.Stock
+	)
+
+	testCases := []struct {
+		desc           string
+		stock          mockStock
+		pid            string
+		body           string
+		expectedCalled bool
+		expectedStock  product.Stock
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			desc:           "invalid product id",
+			stock:          mockStock{},
+			pid:            "abc",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":1}]}",
+			expectedCalled: false,
+			expectedStock:  product.Stock{},
+			expectedCode:   http.StatusBadRequest,
+			expectedBody:   errorBody(CodeInvalidRequest, "product id not valid"),
+		},
+		{
+			desc: "insufficient stock",
+			stock: mockStock{
+				calledDecrement: &requestedDecrement,
+				stock:           &requested,
+				err:             product.ErrInsufficientStock,
+			},
+			pid:            "1",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":11}]}",
+			expectedCalled: true,
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 11},
+			},
+			expectedCode: http.StatusConflict,
+			expectedBody: errorBody(CodeInsufficientStock, "insufficient stock"),
+		},
+		{
+			desc: "decrement error",
+			stock: mockStock{
+				calledDecrement: &requestedDecrement,
+				stock:           &requested,
+				err:             errors.New("error"),
+			},
+			pid:            "1",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":1}]}",
+			expectedCalled: true,
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 1},
+			},
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: errorBody(CodeInternalError, "internal error"),
+		},
+		{
+			desc: "decrement success",
+			stock: mockStock{
+				calledDecrement: &requestedDecrement,
+				stock:           &requested,
+				response: product.Stock{
+					PID:    1,
+					Levels: map[int]int{5: 9},
+				},
+			},
+			pid:            "1",
+			body:           "{\"stock\":[{\"packsize\":5,\"quantity\":1}]}",
+			expectedCalled: true,
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 1},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "{\"pid\":1,\"stock\":[{\"packsize\":5,\"quantity\":9}]}\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedDecrement = false
+			requested = product.Stock{}
+
+			req := httptest.NewRequest(http.MethodPost, "/product/"+tC.pid+"/stock/decrement", bytes.NewReader([]byte(tC.body)))
+			req = mux.SetURLVars(req, map[string]string{"pid": tC.pid})
+			rec := httptest.NewRecorder()
+
+			DecrementProductStock(tC.stock)(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Equal(t, tC.expectedBody, rec.Body.String())
+
+			assert.Equal(t, tC.expectedCalled, requestedDecrement)
+			assert.Equal(t, tC.expectedStock, requested)
+		})
+	}
+}
@@ -3,60 +3,590 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
 	"github.com/gorilla/mux"
 )
 
-const maxOrder = 10000000
+const (
+	maxAlternatives = 10
+	maxOrderLines   = 100
+	maxRangeOrders  = 1000000
+)
+
+// maxContainerLevels is the highest amount of packaging levels of a product
+const maxContainerLevels = 5
+
+// maxPackSize is the largest package size of a product, as the solver tables grow with it
+const maxPackSize = 100000
+
+// recommendations are searched by solving every expected order with many sets, so their inputs are kept smaller
+const (
+	maxDemandEntries       = 1000
+	maxDemandOrder         = 1000000
+	maxRecommendSizes      = 5
+	maxRecommendSize       = 100000
+	maxRecommendResults    = 10
+	defaultRecommendResult = 3
+)
+
+// comparisons solve every order with two configurations, so their orders and proposed sizes are limited as the recommendation ones
+const (
+	maxCompareOrders   = 1000
+	maxCompareOrder    = 1000000
+	maxComparePackSize = maxRecommendSize
+)
+
+// keyIDPattern restricts api key ids to short names safe to be logged and used in paths
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+var objectivesMap = map[string]order.Objective{
+	"min-excess":      order.MinExcess,
+	"min-cost":        order.MinCost,
+	"min-cost-capped": order.MinCostCappedExcess,
+}
 
 func validatePidVar(w http.ResponseWriter, r *http.Request) (int, bool) {
 	pidVar := mux.Vars(r)["pid"]
 	convertedPid, err := strconv.Atoi(pidVar)
 	if err != nil || convertedPid <= 0 {
-		http.Error(w, "product id not valid", http.StatusBadRequest)
+		writeInvalidRequest(w, r, "product id not valid")
 		return 0, false
 	}
 
 	return convertedPid, true
 }
 
-func validateOrderQuery(w http.ResponseWriter, r *http.Request) (int, bool) {
+func validateVersionVar(w http.ResponseWriter, r *http.Request) (int, bool) {
+	versionVar := mux.Vars(r)["version"]
+	convertedVersion, err := strconv.Atoi(versionVar)
+	if err != nil || convertedVersion <= 0 {
+		writeInvalidRequest(w, r, "version not valid")
+		return 0, false
+	}
+
+	return convertedVersion, true
+}
+
+func validateOrderQuery(w http.ResponseWriter, r *http.Request, maxOrder int) (int, bool) {
 	orders := r.URL.Query()["order"]
 	if len(orders) == 0 {
-		http.Error(w, "order query parameter must be specified", http.StatusBadRequest)
+		writeInvalidRequest(w, r, "order query parameter must be specified")
 		return 0, false
 	}
 
 	convertedOrder, err := strconv.Atoi(orders[0])
 	if err != nil || convertedOrder <= 0 {
-		http.Error(w, "order query parameter not valid", http.StatusBadRequest)
+		writeInvalidRequest(w, r, "order query parameter not valid")
 		return 0, false
 	}
 	if convertedOrder > maxOrder {
-		http.Error(w, fmt.Sprintf("order too large: maximum %d", maxOrder), http.StatusBadRequest)
+		writeInvalidRequest(w, r, fmt.Sprintf("order too large: maximum %d", maxOrder))
 		return 0, false
 	}
 
 	return convertedOrder, true
 }
 
-func validatePackSizesRequest(w http.ResponseWriter, r *http.Request) ([]int, bool) {
+func validateRangeQuery(w http.ResponseWriter, r *http.Request, maxOrder int) (int, int, bool) {
+	from := 1
+	froms := r.URL.Query()["from"]
+	if len(froms) > 0 {
+		convertedFrom, err := strconv.Atoi(froms[0])
+		if err != nil || convertedFrom <= 0 {
+			writeInvalidRequest(w, r, "from query parameter not valid")
+			return 0, 0, false
+		}
+		from = convertedFrom
+	}
+
+	tos := r.URL.Query()["to"]
+	if len(tos) == 0 {
+		writeInvalidRequest(w, r, "to query parameter must be specified")
+		return 0, 0, false
+	}
+
+	to, err := strconv.Atoi(tos[0])
+	if err != nil || to < from {
+		writeInvalidRequest(w, r, "to query parameter not valid")
+		return 0, 0, false
+	}
+	if to > maxOrder {
+		writeInvalidRequest(w, r, fmt.Sprintf("order too large: maximum %d", maxOrder))
+		return 0, 0, false
+	}
+	if to-from >= maxRangeOrders {
+		writeInvalidRequest(w, r, fmt.Sprintf("too many orders: maximum %d", maxRangeOrders))
+		return 0, 0, false
+	}
+
+	return from, to, true
+}
+
+func validateRangeAccept(w http.ResponseWriter, r *http.Request) (string, bool) {
+	contentType, found := rangeContentType(r.Header.Get("Accept"))
+	if !found {
+		writeError(w, r, http.StatusNotAcceptable, CodeNotAcceptable, "accept header must allow "+NDJSONContentType+" or "+CSVContentType)
+		return "", false
+	}
+
+	return contentType, true
+}
+
+func validateCatalogueAccept(w http.ResponseWriter, r *http.Request) (string, bool) {
+	contentType, found := catalogueContentType(r.Header.Get("Accept"))
+	if !found {
+		writeError(w, r, http.StatusNotAcceptable, CodeNotAcceptable, "accept header must allow "+JSONContentType+" or "+CSVContentType)
+		return "", false
+	}
+
+	return contentType, true
+}
+
+func validateListQuery(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	query := r.URL.Query()
+
+	cursor := 0
+	if cursors := query["cursor"]; len(cursors) > 0 && cursors[0] != "" {
+		convertedCursor, err := strconv.Atoi(cursors[0])
+		if err != nil || convertedCursor < 0 {
+			writeInvalidRequest(w, r, "cursor query parameter not valid")
+			return 0, 0, false
+		}
+		cursor = convertedCursor
+	}
+
+	limit := defaultListLimit
+	if limits := query["limit"]; len(limits) > 0 {
+		convertedLimit, err := strconv.Atoi(limits[0])
+		if err != nil || convertedLimit <= 0 {
+			writeInvalidRequest(w, r, "limit query parameter not valid")
+			return 0, 0, false
+		}
+		if convertedLimit > maxListLimit {
+			writeInvalidRequest(w, r, fmt.Sprintf("too many products: maximum %d", maxListLimit))
+			return 0, 0, false
+		}
+		limit = convertedLimit
+	}
+
+	return cursor, limit, true
+}
+
+func validateDryRunQuery(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	values := r.URL.Query()["dryrun"]
+	if len(values) == 0 {
+		return false, true
+	}
+
+	dryRun, err := strconv.ParseBool(values[0])
+	if err != nil {
+		writeInvalidRequest(w, r, "dryrun query parameter not valid")
+		return false, false
+	}
+
+	return dryRun, true
+}
+
+func validateCatalogueRequest(w http.ResponseWriter, r *http.Request) ([]catalogueRow, bool) {
+	var (
+		rows []catalogueRow
+		err  error
+	)
+	body := http.MaxBytesReader(w, r.Body, maxCatalogueSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == CSVContentType {
+		rows, err = readCatalogueCSV(body)
+	} else {
+		rows, err = readCatalogueJSON(body)
+	}
+	if errors.Is(err, errCatalogueTooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeInvalidRequest(w, r, err.Error())
+		return nil, false
+	}
+
+	if len(rows) == 0 {
+		writeInvalidRequest(w, r, "products must be specified")
+		return nil, false
+	}
+	if len(rows) > maxCatalogueProducts {
+		writeInvalidRequest(w, r, fmt.Sprintf("too many products: maximum %d", maxCatalogueProducts))
+		return nil, false
+	}
+
+	return rows, true
+}
+
+func validateObjectiveQuery(w http.ResponseWriter, r *http.Request) (order.Objective, int, bool) {
+	objectives := r.URL.Query()["objective"]
+	if len(objectives) == 0 {
+		return order.MinExcess, 0, true
+	}
+
+	objective, found := objectivesMap[objectives[0]]
+	if !found {
+		writeInvalidRequest(w, r, "objective query parameter not valid")
+		return 0, 0, false
+	}
+	if objective != order.MinCostCappedExcess {
+		return objective, 0, true
+	}
+
+	maxExcesses := r.URL.Query()["maxexcess"]
+	if len(maxExcesses) == 0 {
+		writeInvalidRequest(w, r, "maxexcess query parameter must be specified")
+		return 0, 0, false
+	}
+
+	convertedMaxExcess, err := strconv.Atoi(maxExcesses[0])
+	if err != nil || convertedMaxExcess < 0 {
+		writeInvalidRequest(w, r, "maxexcess query parameter not valid")
+		return 0, 0, false
+	}
+
+	return objective, convertedMaxExcess, true
+}
+
+func validateAlternativesQuery(w http.ResponseWriter, r *http.Request) (int, bool) {
+	alternatives := r.URL.Query()["alternatives"]
+	if len(alternatives) == 0 {
+		return 0, true
+	}
+
+	convertedAlternatives, err := strconv.Atoi(alternatives[0])
+	if err != nil || convertedAlternatives <= 0 {
+		writeInvalidRequest(w, r, "alternatives query parameter not valid")
+		return 0, false
+	}
+	if convertedAlternatives > maxAlternatives {
+		writeInvalidRequest(w, r, fmt.Sprintf("too many alternatives: maximum %d", maxAlternatives))
+		return 0, false
+	}
+
+	return convertedAlternatives, true
+}
+
+func validateVersionQuery(w http.ResponseWriter, r *http.Request) (int, bool) {
+	versions := r.URL.Query()["version"]
+	if len(versions) == 0 {
+		return 0, true
+	}
+
+	convertedVersion, err := strconv.Atoi(versions[0])
+	if err != nil || convertedVersion <= 0 {
+		writeInvalidRequest(w, r, "version query parameter not valid")
+		return 0, false
+	}
+
+	return convertedVersion, true
+}
+
+func validatePackSizesRequest(w http.ResponseWriter, r *http.Request) (product.Product, bool) {
 	var req *ProductPackSizesRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req == nil {
+		writeInvalidRequest(w, r, "invalid request payload")
+		return product.Product{}, false
+	}
+
+	prd, err := packSizesProduct(*req)
 	if err != nil {
-		http.Error(w, "invalid request payload", http.StatusBadRequest)
-		return nil, false
+		writeInvalidRequest(w, r, err.Error())
+		return product.Product{}, false
 	}
 
+	return prd, true
+}
+
+// packSizesProduct converts a package sizes configuration into a product, so that the same rules apply wherever it is given
+func packSizesProduct(req ProductPackSizesRequest) (product.Product, error) {
 	for _, size := range req.Packs {
 		if size <= 0 {
-			http.Error(w, "pack sizes must be positive integers", http.StatusBadRequest)
+			return product.Product{}, errors.New("pack sizes must be positive integers")
+		}
+		if size > maxPackSize {
+			return product.Product{}, fmt.Errorf("pack size too large: maximum %d", maxPackSize)
+		}
+	}
+
+	containers, err := containerLevels(req.Containers)
+	if err != nil {
+		return product.Product{}, err
+	}
+
+	if len(req.Costs) == 0 {
+		return product.Product{Packs: req.Packs, Containers: containers}, nil
+	}
+
+	if len(req.Costs) != len(req.Packs) {
+		return product.Product{}, errors.New("pack costs must match pack sizes")
+	}
+
+	for _, cost := range req.Costs {
+		if cost < 0 {
+			return product.Product{}, errors.New("pack costs must be non negative integers")
+		}
+	}
+
+	return product.Product{Packs: req.Packs, Costs: req.Costs, Containers: containers}, nil
+}
+
+func containerLevels(levels []ContainerLevel) ([]product.ContainerLevel, error) {
+	if len(levels) > maxContainerLevels {
+		return nil, fmt.Errorf("too many container levels: maximum %d", maxContainerLevels)
+	}
+
+	var containers []product.ContainerLevel
+	for _, level := range levels {
+		if level.Name == "" {
+			return nil, errors.New("container names must be specified")
+		}
+		if level.Capacity <= 0 {
+			return nil, errors.New("container capacities must be positive integers")
+		}
+		if slices.ContainsFunc(containers, func(c product.ContainerLevel) bool { return c.Name == level.Name }) {
+			return nil, errors.New("container names must not be repeated")
+		}
+
+		containers = append(containers, product.ContainerLevel{Name: level.Name, Capacity: level.Capacity})
+	}
+
+	return containers, nil
+}
+
+func validateStockRequest(w http.ResponseWriter, r *http.Request) (map[int]int, bool) {
+	var req *ProductStockRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req == nil {
+		writeInvalidRequest(w, r, "invalid request payload")
+		return nil, false
+	}
+
+	levels := make(map[int]int, len(req.Stock))
+	for _, level := range req.Stock {
+		if level.PackSize <= 0 {
+			writeInvalidRequest(w, r, "pack sizes must be positive integers")
+			return nil, false
+		}
+		if level.Quantity < 0 {
+			writeInvalidRequest(w, r, "stock quantities must be non negative integers")
 			return nil, false
 		}
+		if _, found := levels[level.PackSize]; found {
+			writeInvalidRequest(w, r, "pack sizes must not be repeated")
+			return nil, false
+		}
+
+		levels[level.PackSize] = level.Quantity
+	}
+
+	return levels, true
+}
+
+func validateOrderLinesRequest(w http.ResponseWriter, r *http.Request, maxOrder int) ([]order.Order, bool) {
+	var req []OrderLineRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeInvalidRequest(w, r, "invalid request payload")
+		return nil, false
+	}
+
+	if len(req) == 0 {
+		writeInvalidRequest(w, r, "order lines must be specified")
+		return nil, false
+	}
+	if len(req) > maxOrderLines {
+		writeInvalidRequest(w, r, fmt.Sprintf("too many order lines: maximum %d", maxOrderLines))
+		return nil, false
+	}
+
+	lines := make([]order.Order, len(req))
+	for i, line := range req {
+		if line.PID <= 0 {
+			writeInvalidRequest(w, r, fmt.Sprintf("line %d: product id not valid", i))
+			return nil, false
+		}
+		if line.Qty <= 0 {
+			writeInvalidRequest(w, r, fmt.Sprintf("line %d: order quantity not valid", i))
+			return nil, false
+		}
+		if line.Qty > maxOrder {
+			writeInvalidRequest(w, r, fmt.Sprintf("line %d: order too large: maximum %d", i, maxOrder))
+			return nil, false
+		}
+
+		lines[i] = order.Order{
+			PID: line.PID,
+			Qty: line.Qty,
+		}
+	}
+
+	return lines, true
+}
+
+func validateAPIKeyRequest(w http.ResponseWriter, r *http.Request) (string, auth.Role, bool) {
+	var req *APIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req == nil {
+		writeInvalidRequest(w, r, "invalid request payload")
+		return "", auth.Public, false
+	}
+
+	if !keyIDPattern.MatchString(req.ID) {
+		writeInvalidRequest(w, r, "key id not valid")
+		return "", auth.Public, false
+	}
+
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		writeInvalidRequest(w, r, "role not valid")
+		return "", auth.Public, false
+	}
+
+	return req.ID, role, true
+}
+
+func validateRecommendationRequest(w http.ResponseWriter, r *http.Request, pid int) (order.RecommendationRequest, bool) {
+	var req *PackSizesRecommendationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req == nil {
+		writeInvalidRequest(w, r, "invalid request payload")
+		return order.RecommendationRequest{}, false
+	}
+
+	if len(req.Histogram) > 0 == (len(req.Sample) > 0) {
+		writeInvalidRequest(w, r, "either histogram or sample must be specified")
+		return order.RecommendationRequest{}, false
+	}
+	if len(req.Histogram) > maxDemandEntries || len(req.Sample) > maxDemandEntries {
+		writeInvalidRequest(w, r, fmt.Sprintf("too many demand entries: maximum %d", maxDemandEntries))
+		return order.RecommendationRequest{}, false
+	}
+
+	// a sample counts once each of its quantities
+	histogram := req.Histogram
+	for _, qty := range req.Sample {
+		histogram = append(histogram, DemandRequest{Qty: qty, Count: 1})
+	}
+
+	demand := make([]order.Demand, len(histogram))
+	for i, entry := range histogram {
+		if entry.Qty <= 0 || entry.Qty > maxDemandOrder {
+			writeInvalidRequest(w, r, fmt.Sprintf("demand quantities must be between 1 and %d", maxDemandOrder))
+			return order.RecommendationRequest{}, false
+		}
+		if entry.Count <= 0 {
+			writeInvalidRequest(w, r, "demand counts must be positive integers")
+			return order.RecommendationRequest{}, false
+		}
+
+		demand[i] = order.Demand{Qty: entry.Qty, Count: entry.Count}
+	}
+
+	if req.MaxSizes <= 0 || req.MaxSizes > maxRecommendSizes {
+		writeInvalidRequest(w, r, fmt.Sprintf("maxsizes must be between 1 and %d", maxRecommendSizes))
+		return order.RecommendationRequest{}, false
+	}
+	if req.MinSize <= 0 || req.MaxSize < req.MinSize || req.MaxSize > maxRecommendSize {
+		writeInvalidRequest(w, r, fmt.Sprintf("size bounds not valid: minsize must be positive and not above maxsize, at most %d", maxRecommendSize))
+		return order.RecommendationRequest{}, false
+	}
+
+	results := req.Results
+	if results == 0 {
+		results = defaultRecommendResult
+	}
+	if results < 0 || results > maxRecommendResults {
+		writeInvalidRequest(w, r, fmt.Sprintf("results must be between 1 and %d", maxRecommendResults))
+		return order.RecommendationRequest{}, false
+	}
+
+	return order.RecommendationRequest{
+		PID:      pid,
+		Demand:   demand,
+		MaxSizes: req.MaxSizes,
+		MinSize:  req.MinSize,
+		MaxSize:  req.MaxSize,
+		Results:  results,
+	}, true
+}
+
+func validateComparisonRequest(w http.ResponseWriter, r *http.Request, pid int) (order.ComparisonRequest, bool) {
+	var req *PackSizesComparisonRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req == nil {
+		writeInvalidRequest(w, r, "invalid request payload")
+		return order.ComparisonRequest{}, false
+	}
+
+	if len(req.Packs) == 0 {
+		writeInvalidRequest(w, r, "pack sizes must be specified")
+		return order.ComparisonRequest{}, false
+	}
+	for _, size := range req.Packs {
+		if size <= 0 {
+			writeInvalidRequest(w, r, "pack sizes must be positive integers")
+			return order.ComparisonRequest{}, false
+		}
+		if size > maxComparePackSize {
+			writeInvalidRequest(w, r, fmt.Sprintf("pack size too large: maximum %d", maxComparePackSize))
+			return order.ComparisonRequest{}, false
+		}
+	}
+
+	if len(req.Orders) > 0 == (req.Range != nil) {
+		writeInvalidRequest(w, r, "either orders or range must be specified")
+		return order.ComparisonRequest{}, false
+	}
+
+	quantities := req.Orders
+	if req.Range != nil {
+		step := req.Range.Step
+		if step == 0 {
+			step = 1
+		}
+		if req.Range.From <= 0 || req.Range.To < req.Range.From || step < 0 {
+			writeInvalidRequest(w, r, "range not valid: from must be positive and not above to, with a positive step")
+			return order.ComparisonRequest{}, false
+		}
+		if (req.Range.To-req.Range.From)/step >= maxCompareOrders {
+			writeInvalidRequest(w, r, fmt.Sprintf("too many orders: maximum %d", maxCompareOrders))
+			return order.ComparisonRequest{}, false
+		}
+
+		quantities = nil
+		for qty := req.Range.From; qty <= req.Range.To; qty += step {
+			quantities = append(quantities, qty)
+		}
+	}
+
+	if len(quantities) > maxCompareOrders {
+		writeInvalidRequest(w, r, fmt.Sprintf("too many orders: maximum %d", maxCompareOrders))
+		return order.ComparisonRequest{}, false
+	}
+	for _, qty := range quantities {
+		if qty <= 0 || qty > maxCompareOrder {
+			writeInvalidRequest(w, r, fmt.Sprintf("order quantities must be between 1 and %d", maxCompareOrder))
+			return order.ComparisonRequest{}, false
+		}
 	}
 
-	return req.Packs, true
+	return order.ComparisonRequest{
+		PID:        pid,
+		Packs:      req.Packs,
+		Quantities: quantities,
+	}, true
 }
@@ -2,33 +2,396 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math"
 	"os"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+const (
+	ConfigFileKey               = "CONFIG_FILE"
+	ServerAddressKey            = "SERVER_ADDRESS"
+	ServerPortKey               = "SERVER_PORT"
+	ReadTimeoutKey              = "READ_TIMEOUT"
+	WriteTimeoutKey             = "WRITE_TIMEOUT"
+	IdleTimeoutKey              = "IDLE_TIMEOUT"
+	ShutdownTimeoutKey          = "SHUTDOWN_TIMEOUT"
+	StaticDirKey                = "STATIC_DIR"
+	MaxOrderKey                 = "MAX_ORDER"
+	StorageBackendKey           = "STORAGE_BACKEND"
+	DataDirKey                  = "DATA_DIR"
+	SeedFileKey                 = "SEED_FILE"
+	LogFormatKey                = "LOG_FORMAT"
+	LogLevelKey                 = "LOG_LEVEL"
+	APIKeysKey                  = "API_KEYS"
+	APIKeysFileKey              = "API_KEYS_FILE"
+	JWTSecretKey                = "JWT_SECRET"
+	RateLimitKey                = "RATE_LIMIT"
+	RateBurstKey                = "RATE_LIMIT_BURST"
+	SolverCapacityKey           = "SOLVER_CAPACITY"
+	CacheSizeKey                = "CACHE_SIZE"
+	SolverCacheSizeKey          = "SOLVER_CACHE_SIZE"
+	CalculationTimeoutKey       = "CALCULATION_TIMEOUT"
+	OrdersCalculationTimeoutKey = "ORDERS_CALCULATION_TIMEOUT"
+	RecommendationTimeoutKey    = "RECOMMENDATION_TIMEOUT"
+)
+
+// Storage backends supported by the repositories
+const (
+	MemoryStorage = "memory"
+	FileStorage   = "file"
 )
 
+// MaxOrderLimit is the largest order quantity that can be configured, clamped to the int range of 32-bit targets
+const MaxOrderLimit = min(10000000000, math.MaxInt)
+
 const (
-	ServerAddressKey = "SERVER_ADDRESS"
-	ServerPortKey    = "SERVER_PORT"
+	defaultServerPort               = 8080
+	defaultReadTimeout              = 30 * time.Second
+	defaultWriteTimeout             = 30 * time.Second
+	defaultIdleTimeout              = 30 * time.Second
+	defaultShutdownTimeout          = 10 * time.Second
+	defaultStaticDir                = "web"
+	defaultMaxOrder                 = MaxOrderLimit
+	defaultStorageBackend           = MemoryStorage
+	defaultDataDir                  = "data"
+	defaultLogFormat                = instrumentation.TextFormat
+	defaultLogLevel                 = "info"
+	defaultRateLimit                = 20
+	defaultRateBurst                = 40
+	defaultSolverCapacity           = 50000000
+	defaultCacheSize                = 10000
+	defaultSolverCacheSize          = 10000000
+	defaultCalculationTimeout       = 10 * time.Second
+	defaultOrdersCalculationTimeout = 25 * time.Second
+	defaultRecommendationTimeout    = 25 * time.Second
 )
 
 // Config holds all configuration parameters
 type Config struct {
-	ServerAddress string
-	ServerPort    int
+	ConfigFile               string
+	PrintConfig              bool
+	ServerAddress            string
+	ServerPort               int
+	ReadTimeout              time.Duration
+	WriteTimeout             time.Duration
+	IdleTimeout              time.Duration
+	ShutdownTimeout          time.Duration
+	StaticDir                string
+	MaxOrder                 int
+	StorageBackend           string
+	DataDir                  string
+	SeedFile                 string
+	LogFormat                string
+	LogLevel                 string
+	APIKeys                  []APIKey
+	APIKeysFile              string
+	JWTSecret                string
+	RateLimit                float64
+	RateBurst                int
+	SolverCapacity           int
+	CacheSize                int
+	SolverCacheSize          int
+	CalculationTimeout       time.Duration
+	OrdersCalculationTimeout time.Duration
+	RecommendationTimeout    time.Duration
+}
+
+// APIKey holds a static api key given as an id:role:key entry
+type APIKey struct {
+	ID   string
+	Role auth.Role
+	Key  string
 }
 
-// InitConfig initializes the configurations parameters from all sources
-func InitConfig() Config {
-	serverAddress := os.Getenv(ServerAddressKey)
+// AuthEnabled method checks whether any credentials are configured, requiring callers to be authenticated
+func (c Config) AuthEnabled() bool {
+	return len(c.APIKeys) > 0 || c.APIKeysFile != "" || c.JWTSecret != ""
+}
+
+// a setting is a configuration parameter named by its environment variable
+// the same parameter is named in lower case in the config file, and in lower case with dashes as a command line flag
+// reloadable settings can be changed while the server is running, the other ones requiring a restart
+type setting struct {
+	key        string
+	usage      string
+	value      value
+	reloadable bool
+}
+
+// fileKey returns the name of a setting in the config file
+func (s setting) fileKey() string {
+	return strings.ToLower(s.key)
+}
 
-	port, err := strconv.Atoi(os.Getenv(ServerPortKey))
+// flagName returns the name of a setting as a command line flag
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.key), "_", "-")
+}
+
+// defaultConfig returns the configuration used for the settings given by no source
+func defaultConfig() Config {
+	return Config{
+		ServerPort:               defaultServerPort,
+		ReadTimeout:              defaultReadTimeout,
+		WriteTimeout:             defaultWriteTimeout,
+		IdleTimeout:              defaultIdleTimeout,
+		ShutdownTimeout:          defaultShutdownTimeout,
+		StaticDir:                defaultStaticDir,
+		MaxOrder:                 defaultMaxOrder,
+		StorageBackend:           defaultStorageBackend,
+		DataDir:                  defaultDataDir,
+		LogFormat:                defaultLogFormat,
+		LogLevel:                 defaultLogLevel,
+		RateLimit:                defaultRateLimit,
+		RateBurst:                defaultRateBurst,
+		SolverCapacity:           defaultSolverCapacity,
+		CacheSize:                defaultCacheSize,
+		SolverCacheSize:          defaultSolverCacheSize,
+		CalculationTimeout:       defaultCalculationTimeout,
+		OrdersCalculationTimeout: defaultOrdersCalculationTimeout,
+		RecommendationTimeout:    defaultRecommendationTimeout,
+	}
+}
+
+// settings method binds every configuration parameter to its field
+func (c *Config) settings() []setting {
+	return []setting{
+		{ServerAddressKey, "address the server listens on", stringValue{&c.ServerAddress}, false},
+		{ServerPortKey, "port the server listens on", intValue{&c.ServerPort}, false},
+		{ReadTimeoutKey, "longest time reading a request", durationValue{&c.ReadTimeout}, false},
+		{WriteTimeoutKey, "longest time writing a response", durationValue{&c.WriteTimeout}, false},
+		{IdleTimeoutKey, "longest time keeping an idle connection", durationValue{&c.IdleTimeout}, false},
+		{ShutdownTimeoutKey, "longest time waiting for requests on shutdown", durationValue{&c.ShutdownTimeout}, false},
+		{StaticDirKey, "directory of the static web contents, empty to serve none", stringValue{&c.StaticDir}, false},
+		{MaxOrderKey, "largest order quantity calculated", intValue{&c.MaxOrder}, true},
+		{StorageBackendKey, "storage of the package sizes, memory or file", stringValue{&c.StorageBackend}, false},
+		{DataDirKey, "directory of the file storage", stringValue{&c.DataDir}, false},
+		{SeedFileKey, "products catalogue imported on startup and on every reload, as CSV or JSON", stringValue{&c.SeedFile}, true},
+		{LogFormatKey, "log format, text or json", stringValue{&c.LogFormat}, false},
+		{LogLevelKey, "log level, debug, info, warn or error", stringValue{&c.LogLevel}, true},
+		{APIKeysKey, "comma separated id:role:key static api keys", apiKeysValue{&c.APIKeys}, false},
+		{APIKeysFileKey, "file persisting the api keys managed through the api", stringValue{&c.APIKeysFile}, false},
+		{JWTSecretKey, "secret verifying HS256 signed JWTs", secretValue{&c.JWTSecret}, false},
+		{RateLimitKey, "requests per second of each client, 0 disables it", floatValue{&c.RateLimit}, true},
+		{RateBurstKey, "requests each client can make at once", intValue{&c.RateBurst}, true},
+		{SolverCapacityKey, "solver table entries allocated concurrently, 0 disables it", intValue{&c.SolverCapacity}, false},
+		{CacheSizeKey, "shipping calculations kept in the cache, 0 disables it", intValue{&c.CacheSize}, false},
+		{SolverCacheSizeKey, "solver table entries kept in the cache, 0 keeps none", intValue{&c.SolverCacheSize}, false},
+		{CalculationTimeoutKey, "longest shipping calculation, 0 disables it", durationValue{&c.CalculationTimeout}, false},
+		{OrdersCalculationTimeoutKey, "longest orders calculation or comparison, 0 disables it", durationValue{&c.OrdersCalculationTimeout}, false},
+		{RecommendationTimeoutKey, "longest package sizes recommendation, 0 disables it", durationValue{&c.RecommendationTimeout}, false},
+	}
+}
+
+// Load reads the configuration parameters from all sources, each one overriding the previous ones
+// defaults < config file < environment variables < command line flags
+// the config file is given by the --config flag or the CONFIG_FILE environment variable
+// every invalid parameter is reported, flag.ErrHelp being returned when the usage was requested
+func Load(args []string, getenv func(string) string) (Config, error) {
+	return load(args, getenv, os.Stderr)
+}
+
+// load reads the configuration parameters as Load, writing the flags usage and errors to a given output
+func load(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	cfg := defaultConfig()
+	settings := cfg.settings()
+
+	flags := flag.NewFlagSet("shipping-optimizer", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&cfg.ConfigFile, "config", getenv(ConfigFileKey), "YAML or JSON config file")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective configuration and exit")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.key] = flags.String(s.flagName(), "", s.usage+" ("+s.key+")")
+	}
+	err := flags.Parse(args)
 	if err != nil {
-		log.Panicf("[ENV] Invalid server port: %v", err)
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
 	}
 
-	return Config{
-		ServerAddress: serverAddress,
-		ServerPort:    port,
+	var errs []error
+	if cfg.ConfigFile != "" {
+		values, err := readConfigFile(cfg.ConfigFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, applyFile(settings, values)...)
 	}
+
+	for _, s := range settings {
+		if value := getenv(s.key); value != "" {
+			errs = append(errs, set(s, "env "+s.key, value)...)
+		}
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	for _, s := range settings {
+		if setFlags[s.flagName()] {
+			errs = append(errs, set(s, "flag --"+s.flagName(), *flagValues[s.key])...)
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+
+	return cfg, nil
+}
+
+// applyFile sets the settings given by a config file, reporting the unknown ones
+func applyFile(settings []setting, values map[string]string) []error {
+	var errs []error
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.fileKey()] = true
+		if value, found := values[s.fileKey()]; found {
+			errs = append(errs, set(s, "file "+s.fileKey(), value)...)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("file %s: unknown setting", key))
+		}
+	}
+
+	return errs
+}
+
+// set assigns a value to a setting, reporting the source of an invalid one
+func set(s setting, source, value string) []error {
+	err := s.value.Set(value)
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", source, err)}
+	}
+
+	return nil
+}
+
+// validate method checks every parameter once all sources are merged
+func (c Config) validate() []error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		invalid(ServerPortKey, "%d is not between 1 and 65535", c.ServerPort)
+	}
+	if c.MaxOrder < 1 || c.MaxOrder > MaxOrderLimit {
+		invalid(MaxOrderKey, "%d is not between 1 and %d", c.MaxOrder, MaxOrderLimit)
+	}
+	if c.StorageBackend != MemoryStorage && c.StorageBackend != FileStorage {
+		invalid(StorageBackendKey, "%q is not memory or file", c.StorageBackend)
+	}
+	if c.StorageBackend == FileStorage && c.DataDir == "" {
+		invalid(DataDirKey, "the file storage requires a directory")
+	}
+	if c.LogFormat != instrumentation.TextFormat && c.LogFormat != instrumentation.JSONFormat {
+		invalid(LogFormatKey, "%q is not text or json", c.LogFormat)
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid(LogLevelKey, "%q is not debug, info, warn or error", c.LogLevel)
+	}
+	if c.RateLimit < 0 {
+		invalid(RateLimitKey, "must not be negative")
+	}
+
+	for _, value := range []struct {
+		key   string
+		value int
+	}{
+		{RateBurstKey, c.RateBurst},
+		{SolverCapacityKey, c.SolverCapacity},
+		{CacheSizeKey, c.CacheSize},
+		{SolverCacheSizeKey, c.SolverCacheSize},
+	} {
+		if value.value < 0 {
+			invalid(value.key, "must not be negative")
+		}
+	}
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{ReadTimeoutKey, c.ReadTimeout},
+		{WriteTimeoutKey, c.WriteTimeout},
+		{IdleTimeoutKey, c.IdleTimeout},
+		{ShutdownTimeoutKey, c.ShutdownTimeout},
+		{CalculationTimeoutKey, c.CalculationTimeout},
+		{OrdersCalculationTimeoutKey, c.OrdersCalculationTimeout},
+		{RecommendationTimeoutKey, c.RecommendationTimeout},
+	} {
+		if timeout.value < 0 {
+			invalid(timeout.key, "must not be negative")
+		}
+	}
+
+	return errs
+}
+
+// Changes returns the settings that differ between two configurations, split into the reloadable ones and the ones requiring a restart
+func Changes(current, next Config) (reloadable, restart []string) {
+	nextSettings := next.settings()
+	for i, s := range current.settings() {
+		if reflect.DeepEqual(s.value.get(), nextSettings[i].value.get()) {
+			continue
+		}
+
+		if s.reloadable {
+			reloadable = append(reloadable, s.key)
+		} else {
+			restart = append(restart, s.key)
+		}
+	}
+
+	return reloadable, restart
+}
+
+// Print writes the effective configuration in the config file format, hiding the secrets
+func Print(w io.Writer, cfg Config) error {
+	if cfg.ConfigFile != "" {
+		_, err := fmt.Fprintf(w, "# %s: %s\n", strings.ToLower(ConfigFileKey), cfg.ConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range cfg.settings() {
+		_, err := fmt.Fprintf(w, "%s: %s\n", s.fileKey(), fileValue(s.value.String()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileValue quotes a printed value when it would not be read back as it is
+func fileValue(value string) string {
+	if value == "" || strings.TrimSpace(value) != value || strings.ContainsAny(value, "#\"'") {
+		return strconv.Quote(value)
+	}
+
+	return value
 }
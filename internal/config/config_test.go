@@ -1,56 +1,354 @@
 package config
 
 import (
+	"bytes"
+	"flag"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestNewConfig(t *testing.T) {
+// configWith returns the default configuration changed by a given function
+func configWith(change func(*Config)) Config {
+	cfg := defaultConfig()
+	change(&cfg)
+	return cfg
+}
+
+func TestLoad(t *testing.T) {
 	testCases := []struct {
-		desc     string
-		envs     map[string]string
-		expected Config
-		panic    assert.PanicAssertionFunc
+		desc          string
+		args          []string
+		envs          map[string]string
+		file          string
+		fileContent   string
+		expected      Config
+		expectedError string
 	}{
 		{
-			desc: "sucess",
+			desc:     "defaults",
+			expected: defaultConfig(),
+		},
+		{
+			desc: "sucess with environment variables",
+			envs: map[string]string{
+				"SERVER_ADDRESS":  "localhost",
+				"SERVER_PORT":     "8000",
+				"STORAGE_BACKEND": "file",
+				"DATA_DIR":        "/var/lib/shipping-optimizer",
+				"LOG_FORMAT":      "json",
+				"LOG_LEVEL":       "debug",
+				"STATIC_DIR":      "/srv/web",
+				"MAX_ORDER":       "1000000",
+				"SEED_FILE":       "products.csv",
+			},
+			expected: configWith(func(c *Config) {
+				c.ServerAddress = "localhost"
+				c.ServerPort = 8000
+				c.StorageBackend = "file"
+				c.DataDir = "/var/lib/shipping-optimizer"
+				c.LogFormat = "json"
+				c.LogLevel = "debug"
+				c.StaticDir = "/srv/web"
+				c.MaxOrder = 1000000
+				c.SeedFile = "products.csv"
+			}),
+		},
+		{
+			desc: "sucess with authentication",
 			envs: map[string]string{
-				"SERVER_ADDRESS": "localhost",
-				"SERVER_PORT":    "8000",
+				"API_KEYS":      "ci:editor:s3cr3t, ops:admin:t0p:s3cr3t",
+				"API_KEYS_FILE": "keys.json",
+				"JWT_SECRET":    "signing-secret",
 			},
-			expected: Config{
-				ServerAddress: "localhost",
-				ServerPort:    8000,
+			expected: configWith(func(c *Config) {
+				c.APIKeys = []APIKey{
+					{ID: "ci", Role: auth.Editor, Key: "s3cr3t"},
+					{ID: "ops", Role: auth.Admin, Key: "t0p:s3cr3t"},
+				}
+				c.APIKeysFile = "keys.json"
+				c.JWTSecret = "signing-secret"
+			}),
+		},
+		{
+			desc: "sucess with limits and timeouts",
+			envs: map[string]string{
+				"RATE_LIMIT":                 "2.5",
+				"RATE_LIMIT_BURST":           "5",
+				"SOLVER_CAPACITY":            "0",
+				"CACHE_SIZE":                 "0",
+				"SOLVER_CACHE_SIZE":          "1000",
+				"CALCULATION_TIMEOUT":        "0",
+				"ORDERS_CALCULATION_TIMEOUT": "1m30s",
+				"RECOMMENDATION_TIMEOUT":     "2m",
+				"READ_TIMEOUT":               "5s",
+				"WRITE_TIMEOUT":              "1m",
+				"IDLE_TIMEOUT":               "2m",
+				"SHUTDOWN_TIMEOUT":           "20s",
 			},
-			panic: assert.NotPanics,
+			expected: configWith(func(c *Config) {
+				c.RateLimit = 2.5
+				c.RateBurst = 5
+				c.SolverCapacity = 0
+				c.CacheSize = 0
+				c.SolverCacheSize = 1000
+				c.CalculationTimeout = 0
+				c.OrdersCalculationTimeout = 90 * time.Second
+				c.RecommendationTimeout = 2 * time.Minute
+				c.ReadTimeout = 5 * time.Second
+				c.WriteTimeout = time.Minute
+				c.IdleTimeout = 2 * time.Minute
+				c.ShutdownTimeout = 20 * time.Second
+			}),
+		},
+		{
+			desc: "sucess with yaml file",
+			args: []string{"--config", "config.yaml"},
+			file: "config.yaml",
+			fileContent: "---\n" +
+				"# server\n" +
+				"server_address: localhost\n" +
+				"server_port: 9000 # public port\n" +
+				"log_level: 'warn'\n" +
+				"api_keys: \"ci:viewer:a#b\"\n" +
+				"static_dir: ~\n" +
+				"\n" +
+				"calculation_timeout: 5s\n",
+			expected: configWith(func(c *Config) {
+				c.ConfigFile = "config.yaml"
+				c.ServerAddress = "localhost"
+				c.ServerPort = 9000
+				c.LogLevel = "warn"
+				c.APIKeys = []APIKey{{ID: "ci", Role: auth.Viewer, Key: "a#b"}}
+				c.StaticDir = ""
+				c.CalculationTimeout = 5 * time.Second
+			}),
+		},
+		{
+			desc:        "sucess with json file given by environment variable",
+			envs:        map[string]string{"CONFIG_FILE": "config.json"},
+			file:        "config.json",
+			fileContent: `{"server_port": 9000, "rate_limit": 0.5, "log_format": "json", "cache_size": 0}`,
+			expected: configWith(func(c *Config) {
+				c.ConfigFile = "config.json"
+				c.ServerPort = 9000
+				c.RateLimit = 0.5
+				c.LogFormat = "json"
+				c.CacheSize = 0
+			}),
 		},
 		{
-			desc: "failure with critical invalid configurations",
+			desc: "file overridden by environment variables overridden by flags",
+			args: []string{"-config=config.yaml", "--server-port", "9002", "--max-order=500", "--print-config"},
 			envs: map[string]string{
-				"SERVER_ADDRESS": "localhost",
-				"SERVER_PORT":    "invalid",
+				"SERVER_PORT": "9001",
+				"LOG_LEVEL":   "error",
 			},
-			expected: Config{},
-			panic:    assert.Panics,
+			file:        "config.yaml",
+			fileContent: "server_port: 9000\nlog_level: debug\nmax_order: 100\nread_timeout: 1s\n",
+			expected: configWith(func(c *Config) {
+				c.ConfigFile = "config.yaml"
+				c.PrintConfig = true
+				c.ServerPort = 9002
+				c.LogLevel = "error"
+				c.MaxOrder = 500
+				c.ReadTimeout = time.Second
+			}),
+		},
+		{
+			desc: "every invalid configuration reported",
+			args: []string{"--cache-size=-5", "--calculation-timeout", "10"},
+			envs: map[string]string{
+				"SERVER_PORT":     "invalid",
+				"STORAGE_BACKEND": "invalid",
+				"LOG_FORMAT":      "xml",
+				"LOG_LEVEL":       "verbose",
+				"API_KEYS":        "ci:editor",
+				"RATE_LIMIT":      "-1",
+				"SOLVER_CAPACITY": "lots",
+				"MAX_ORDER":       "10000000001",
+			},
+			expectedError: "env SERVER_PORT: \"invalid\" is not an integer\n" +
+				"env API_KEYS: api key \"ci\" is not an id:role:key entry\n" +
+				"env SOLVER_CAPACITY: \"lots\" is not an integer\n" +
+				"flag --calculation-timeout: \"10\" is not a duration\n" +
+				"invalid MAX_ORDER: 10000000001 is not between 1 and 10000000000\n" +
+				"invalid STORAGE_BACKEND: \"invalid\" is not memory or file\n" +
+				"invalid LOG_FORMAT: \"xml\" is not text or json\n" +
+				"invalid LOG_LEVEL: \"verbose\" is not debug, info, warn or error\n" +
+				"invalid RATE_LIMIT: must not be negative\n" +
+				"invalid CACHE_SIZE: must not be negative",
+		},
+		{
+			desc:          "invalid api key role",
+			envs:          map[string]string{"API_KEYS": "ci:owner:s3cr3t"},
+			expectedError: "env API_KEYS: api key \"ci\" role: invalid role: owner",
+		},
+		{
+			desc:          "invalid server port",
+			args:          []string{"--server-port=70000"},
+			expectedError: "invalid SERVER_PORT: 70000 is not between 1 and 65535",
+		},
+		{
+			desc:          "invalid and unknown file settings",
+			args:          []string{"--config=config.json"},
+			file:          "config.json",
+			fileContent:   `{"server_port": "http", "server_host": "localhost"}`,
+			expectedError: "file server_port: \"http\" is not an integer\nfile server_host: unknown setting",
+		},
+		{
+			desc:          "nested yaml values",
+			args:          []string{"--config=config.yml"},
+			file:          "config.yml",
+			fileContent:   "server:\n  port: 8000\n",
+			expectedError: "parsing config file config.yml: line 2: nested values are not supported",
+		},
+		{
+			desc:          "missing config file",
+			args:          []string{"--config=missing.yaml"},
+			expectedError: "reading config file: open missing.yaml: no such file or directory",
+		},
+		{
+			desc:          "unknown flag",
+			args:          []string{"--port=8000"},
+			expectedError: "flag provided but not defined: -port",
+		},
+		{
+			desc:          "unexpected arguments",
+			args:          []string{"serve"},
+			expectedError: "unexpected arguments: serve",
 		},
 	}
 
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			for env, value := range tC.envs {
-				old := os.Getenv(env)
-				os.Setenv(env, value)
-				t.Cleanup(func() {
-					os.Setenv(env, old)
-				})
+			if tC.file != "" {
+				t.Chdir(t.TempDir())
+				err := os.WriteFile(filepath.Join(".", tC.file), []byte(tC.fileContent), 0o600)
+				assert.NoError(t, err)
+			}
+
+			var stderr bytes.Buffer
+			res, err := load(tC.args, func(key string) string { return tC.envs[key] }, &stderr)
+
+			assert.Equal(t, tC.expected, res)
+			if tC.expectedError == "" {
+				assert.NoError(t, err)
+				return
 			}
+			assert.EqualError(t, err, tC.expectedError)
+		})
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	var stderr bytes.Buffer
+	_, err := load([]string{"--help"}, func(string) string { return "" }, &stderr)
+
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, stderr.String(), "-max-order")
+	assert.Contains(t, stderr.String(), "largest order quantity calculated (MAX_ORDER)")
+}
+
+func TestPrint(t *testing.T) {
+	cfg := configWith(func(c *Config) {
+		c.ConfigFile = "config.yaml"
+		c.ServerAddress = "localhost"
+		c.StaticDir = ""
+		c.APIKeys = []APIKey{{ID: "ci", Role: auth.Editor, Key: "s3cr3t"}}
+		c.JWTSecret = "signing-secret"
+	})
+
+	var out bytes.Buffer
+	err := Print(&out, cfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "# config_file: config.yaml\n"+
+		"server_address: localhost\n"+
+		"server_port: 8080\n"+
+		"read_timeout: 30s\n"+
+		"write_timeout: 30s\n"+
+		"idle_timeout: 30s\n"+
+		"shutdown_timeout: 10s\n"+
+		"static_dir: \"\"\n"+
+		"max_order: 10000000000\n"+
+		"storage_backend: memory\n"+
+		"data_dir: data\n"+
+		"seed_file: \"\"\n"+
+		"log_format: text\n"+
+		"log_level: info\n"+
+		"api_keys: ci:editor:****\n"+
+		"api_keys_file: \"\"\n"+
+		"jwt_secret: ****\n"+
+		"rate_limit: 20\n"+
+		"rate_limit_burst: 40\n"+
+		"solver_capacity: 50000000\n"+
+		"cache_size: 10000\n"+
+		"solver_cache_size: 10000000\n"+
+		"calculation_timeout: 10s\n"+
+		"orders_calculation_timeout: 25s\n"+
+		"recommendation_timeout: 25s\n", out.String())
+
+	// the printed configuration is read back as the same one, apart from the hidden secrets
+	t.Chdir(t.TempDir())
+	err = os.WriteFile("printed.yaml", out.Bytes(), 0o600)
+	assert.NoError(t, err)
+
+	res, err := load([]string{"--config=printed.yaml", "--api-keys=ci:editor:s3cr3t", "--jwt-secret=signing-secret"}, func(string) string { return "" }, &out)
+	assert.NoError(t, err)
+	cfg.ConfigFile = "printed.yaml"
+	assert.Equal(t, cfg, res)
+}
+
+func TestChanges(t *testing.T) {
+	current := configWith(func(c *Config) {
+		c.APIKeys = []APIKey{{ID: "ci", Role: auth.Editor, Key: "s3cr3t"}}
+		c.JWTSecret = "signing-secret"
+	})
+
+	testCases := []struct {
+		desc               string
+		next               Config
+		expectedReloadable []string
+		expectedRestart    []string
+	}{
+		{
+			desc: "same configuration",
+			next: current,
+		},
+		{
+			desc: "reloadable and restart changes",
+			next: configWith(func(c *Config) {
+				c.APIKeys = []APIKey{{ID: "ci", Role: auth.Editor, Key: "s3cr3t"}}
+				c.JWTSecret = "signing-secret"
+				c.ServerPort = 9000
+				c.LogLevel = "debug"
+				c.RateLimit = 5
+				c.MaxOrder = 1000
+			}),
+			expectedReloadable: []string{"MAX_ORDER", "LOG_LEVEL", "RATE_LIMIT"},
+			expectedRestart:    []string{"SERVER_PORT"},
+		},
+		{
+			desc: "hidden secrets changes",
+			next: configWith(func(c *Config) {
+				c.APIKeys = []APIKey{{ID: "ci", Role: auth.Editor, Key: "n3w"}}
+				c.JWTSecret = "new-secret"
+			}),
+			expectedRestart: []string{"API_KEYS", "JWT_SECRET"},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			reloadable, restart := Changes(current, tC.next)
 
-			tC.panic(t, func() {
-				res := InitConfig()
-				assert.Equal(t, tC.expected, res)
-			})
+			assert.Equal(t, tC.expectedReloadable, reloadable)
+			assert.Equal(t, tC.expectedRestart, restart)
 		})
 	}
 }
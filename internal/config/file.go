@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readConfigFile reads the settings of a config file, keyed by their config file names
+// files with a .json extension hold a JSON object, any other one a YAML mapping
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var values map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		values, err = parseJSON(data)
+	} else {
+		values, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// parseJSON reads a JSON object of strings, numbers and booleans
+func parseJSON(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]any
+	err := decoder.Decode(&object)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(object))
+	for key, value := range object {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case json.Number:
+			values[key] = v.String()
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("%s: only strings, numbers and booleans are supported", key)
+		}
+	}
+
+	return values, nil
+}
+
+// parseYAML reads a flat YAML mapping of scalars, the only form the settings take
+// values can be plain or quoted, and comments and document markers are ignored
+func parseYAML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if text[0] == ' ' || text[0] == '\t' || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("line %d: nested values are not supported", line)
+		}
+
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: key: value expected", line)
+		}
+
+		scalar, err := yamlScalar(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		values[strings.TrimSpace(key)] = scalar
+	}
+
+	return values, scanner.Err()
+}
+
+// yamlScalar unquotes a YAML scalar value, dropping the comments following plain ones
+func yamlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := strings.LastIndex(value, `"`)
+		if end == 0 || !yamlComment(value[end+1:]) {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strconv.Unquote(value[:end+1])
+
+	case strings.HasPrefix(value, "'"):
+		end := strings.LastIndex(value, "'")
+		if end == 0 || !yamlComment(value[end+1:]) {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strings.ReplaceAll(value[1:end], "''", "'"), nil
+
+	case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{"):
+		return "", fmt.Errorf("nested values are not supported")
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	if value == "~" || value == "null" {
+		return "", nil
+	}
+
+	return value, nil
+}
+
+// yamlComment checks whether what follows a quoted value is only an optional comment
+func yamlComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+)
+
+// a value binds a setting from every source to its Config field
+type value interface {
+	flag.Value
+	// get returns the field, so that configurations can be compared without the secrets being hidden
+	get() any
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) Set(value string) error {
+	*v.p = value
+	return nil
+}
+
+func (v stringValue) String() string {
+	return *v.p
+}
+
+func (v stringValue) get() any {
+	return *v.p
+}
+
+// secretValue is a string never printed
+type secretValue struct{ p *string }
+
+func (v secretValue) Set(value string) error {
+	*v.p = value
+	return nil
+}
+
+func (v secretValue) String() string {
+	if *v.p == "" {
+		return ""
+	}
+
+	return "****"
+}
+
+func (v secretValue) get() any {
+	return *v.p
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) Set(value string) error {
+	converted, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", value)
+	}
+
+	*v.p = converted
+	return nil
+}
+
+func (v intValue) String() string {
+	return strconv.Itoa(*v.p)
+}
+
+func (v intValue) get() any {
+	return *v.p
+}
+
+type floatValue struct{ p *float64 }
+
+func (v floatValue) Set(value string) error {
+	converted, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", value)
+	}
+
+	*v.p = converted
+	return nil
+}
+
+func (v floatValue) String() string {
+	return strconv.FormatFloat(*v.p, 'g', -1, 64)
+}
+
+func (v floatValue) get() any {
+	return *v.p
+}
+
+// durationValue is given as a Go duration, such as 1m30s, or 0
+type durationValue struct{ p *time.Duration }
+
+func (v durationValue) Set(value string) error {
+	converted, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration", value)
+	}
+
+	*v.p = converted
+	return nil
+}
+
+func (v durationValue) String() string {
+	return v.p.String()
+}
+
+func (v durationValue) get() any {
+	return *v.p
+}
+
+// apiKeysValue is a comma separated list of id:role:key entries, printed without the keys
+type apiKeysValue struct{ p *[]APIKey }
+
+func (v apiKeysValue) Set(value string) error {
+	var keys []APIKey
+	for entry := range strings.SplitSeq(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		// the key itself is never reported
+		fields := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(fields) != 3 || fields[0] == "" || fields[2] == "" {
+			return fmt.Errorf("api key %q is not an id:role:key entry", fields[0])
+		}
+		role, err := auth.ParseRole(fields[1])
+		if err != nil {
+			return fmt.Errorf("api key %q role: %w", fields[0], err)
+		}
+
+		keys = append(keys, APIKey{ID: fields[0], Role: role, Key: fields[2]})
+	}
+
+	*v.p = keys
+	return nil
+}
+
+func (v apiKeysValue) String() string {
+	entries := make([]string, len(*v.p))
+	for i, key := range *v.p {
+		entries[i] = key.ID + ":" + key.Role.String() + ":****"
+	}
+
+	return strings.Join(entries, ",")
+}
+
+func (v apiKeysValue) get() any {
+	return *v.p
+}
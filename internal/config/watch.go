@@ -0,0 +1,34 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WatchFile checks a file every interval, calling changed when its modification time or size changes, until ctx is done
+// a missing file is not reported as changed, as editors often replace files by renaming new ones over them
+func WatchFile(ctx context.Context, path string, interval time.Duration, changed func()) {
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+
+		last = info
+		changed()
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("log_level: info\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	stopped := make(chan struct{})
+	go func() {
+		WatchFile(ctx, path, time.Millisecond, func() { changes <- struct{}{} })
+		close(stopped)
+	}()
+
+	// an unchanged file is not reported
+	select {
+	case <-changes:
+		t.Fatal("unchanged file reported")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("log_level: debug\n"), 0o600))
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("changed file not reported")
+	}
+
+	// a removed file is only reported once it is back
+	assert.NoError(t, os.Remove(path))
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, changes)
+	assert.NoError(t, os.WriteFile(path, []byte("log_level: warn\n"), 0o600))
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("recreated file not reported")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("watch not stopped")
+	}
+}
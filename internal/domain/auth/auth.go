@@ -0,0 +1,87 @@
+// Package auth holds the api authentication and authorization domain
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role defines what a caller is allowed to do, each role including the permissions of the previous ones
+type Role int
+
+const (
+	// Public routes are served without credentials
+	Public Role = iota
+	// Viewer calculates shipping plans and reads configurations
+	Viewer
+	// Editor also changes package sizes and stock
+	Editor
+	// Admin also manages the api keys
+	Admin
+)
+
+var roleNames = map[Role]string{
+	Public: "public",
+	Viewer: "viewer",
+	Editor: "editor",
+	Admin:  "admin",
+}
+
+var (
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrKeyNotFound        = errors.New("api key not found")
+	ErrKeyExists          = errors.New("api key already exists")
+	ErrStaticKey          = errors.New("api key loaded from configuration")
+)
+
+// ParseRole converts a role name into a Role, public being only assigned to routes
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if role != Public && roleName == name {
+			return role, nil
+		}
+	}
+
+	return Public, fmt.Errorf("%w: %s", ErrInvalidRole, name)
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// MarshalText method encodes a Role as its name
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText method decodes a Role from its name
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = role
+	return nil
+}
+
+// Allows method checks whether a role has the permissions of a required one
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// Key holds an api key without its secret
+// static keys are loaded from the configuration and can't be changed through the api
+type Key struct {
+	ID     string
+	Role   Role
+	Static bool
+}
+
+// Identity holds who is calling the api and its role
+type Identity struct {
+	Subject string
+	Role    Role
+}
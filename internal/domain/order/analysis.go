@@ -0,0 +1,18 @@
+package order
+
+// Analysis holds how well a package sizes configuration serves every possible order quantity
+// Frobenius is the largest quantity that can't be shipped exactly and Unreachable counts all of them,
+// both being nil when there are infinitely many, as happens whenever GCD is above one
+// Frobenius is also nil when every quantity is reachable
+// Redundant holds the sizes that are combinations of the other ones
+// WorstExcess is the largest excess shipped by the least excess plan of any order
+type Analysis struct {
+	PID         int
+	Version     int
+	Sizes       []int
+	GCD         int
+	Frobenius   *int
+	Unreachable *int
+	Redundant   []int
+	WorstExcess int
+}
@@ -0,0 +1,32 @@
+package order
+
+// ComparisonRequest holds a proposed package sizes configuration of a product and the order quantities to compare it on
+type ComparisonRequest struct {
+	PID        int
+	Packs      []int
+	Quantities []int
+}
+
+// QtyComparison holds the least excess plans of an order quantity under the stored and the proposed configurations
+type QtyComparison struct {
+	Qty      int
+	Current  Plan
+	Proposed Plan
+}
+
+// Comparison holds the plans of every compared order quantity and their totals under both configurations
+// an order gets better when the proposed plan has less excess, or the same excess with fewer packages
+type Comparison struct {
+	PID            int
+	Version        int
+	Current        []int
+	Proposed       []int
+	Orders         []QtyComparison
+	CurrentExcess  int
+	ProposedExcess int
+	CurrentPacks   int
+	ProposedPacks  int
+	Better         int
+	Worse          int
+	Unchanged      int
+}
@@ -0,0 +1,35 @@
+package order
+
+// Demand holds how many orders of a given quantity are expected
+type Demand struct {
+	Qty   int
+	Count int
+}
+
+// RecommendationRequest holds the expected orders of a product and the bounds of the package sizes sets to recommend
+// sets hold up to MaxSizes distinct sizes between MinSize and MaxSize, and up to Results sets are recommended
+type RecommendationRequest struct {
+	PID      int
+	Demand   []Demand
+	MaxSizes int
+	MinSize  int
+	MaxSize  int
+	Results  int
+}
+
+// PackSetMetrics holds the average excess and amount of packages of the least excess plans of a package sizes set
+// averages are weighted by the expected count of each order quantity
+type PackSetMetrics struct {
+	Packs          []int
+	ExpectedExcess float64
+	ExpectedPacks  float64
+}
+
+// Recommendation holds the best package sizes sets for an expected demand
+// Current holds the metrics of the stored configuration of the product, being nil when it has none
+type Recommendation struct {
+	PID     int
+	Version int
+	Current *PackSetMetrics
+	Sets    []PackSetMetrics
+}
@@ -1,10 +1,52 @@
 // Package order holds logic and representation of orders data
 package order
 
+import "errors"
+
+var (
+	// ErrEmptyOrder is returned when an order has no quantity to ship
+	ErrEmptyOrder = errors.New("empty order")
+	// ErrUnservableOrder is returned when no shipping plan serves an order under the given constraints
+	ErrUnservableOrder = errors.New("no shipping plan within the maximum excess")
+	// ErrOrderTooLarge is returned when an order exceeds the quantity that can be planned under the given constraints
+	ErrOrderTooLarge = errors.New("order too large")
+	// ErrOverloaded is returned when there is no solver capacity left to calculate an order
+	ErrOverloaded = errors.New("solver capacity exhausted")
+	// ErrCalculationTooLarge is returned when a calculation would allocate more than the whole solver capacity
+	ErrCalculationTooLarge = errors.New("calculation exceeds the solver capacity")
+)
+
+// Objective identifies the criteria used to choose the best shipping plan
+type Objective int
+
+const (
+	// MinExcess minimizes the shipped excess first and the amount of packages second
+	MinExcess Objective = iota
+	// MinCost minimizes the total packages cost, then the excess and the amount of packages
+	MinCost
+	// MinCostCappedExcess minimizes the total packages cost among plans not exceeding MaxExcess
+	MinCostCappedExcess
+)
+
 // Order holds data of a given order
+// Alternatives sets how many ranked shipping plans are required, starting with the best one, none when zero
+// Version selects the product package sizes version to ship with, the latest one when zero
 type Order struct {
-	PID int
-	Qty int
+	PID          int
+	Qty          int
+	Objective    Objective
+	MaxExcess    int
+	Alternatives int
+	Version      int
+}
+
+// RangeOrder holds the orders of every quantity from From to To, both included
+// Version selects the product package sizes version to ship with, the latest one when zero
+type RangeOrder struct {
+	PID     int
+	From    int
+	To      int
+	Version int
 }
 
 // Pack holds data of a given package size quantity
@@ -15,12 +57,52 @@ type Pack struct {
 }
 
 // Shipping holds data of an optimized shipping plan
+// Containers and Levels are only set for products with packaging levels
 
 type Shipping struct {
-	PID        int
-	Order      int
+	PID          int
+	Version      int
+	Order        int
+	Packs        []Pack
+	PacksCount   int
+	Total        int
+	Excess       int
+	Cost         int
+	Alternatives []Plan
+	Containers   []Container
+	Levels       []LevelUsage
+}
+
+// Container holds identical containers of a packaging level, along with what each one of them holds
+// containers of the first level hold packages, and the ones of the next levels hold containers of the level below
+// Unused is the capacity left empty in each one of them
+type Container struct {
+	Level    string
+	Count    int
+	Packs    []Pack
+	Contents []Container
+	Unused   int
+}
+
+// LevelUsage holds how many containers of a packaging level a plan uses and the capacity they leave empty
+type LevelUsage struct {
+	Level      string
+	Capacity   int
+	Containers int
+	Unused     int
+}
+
+// Plan holds data of a ranked shipping plan alternative
+type Plan struct {
 	Packs      []Pack
 	PacksCount int
 	Total      int
 	Excess     int
+	Cost       int
+}
+
+// LineShipping holds the shipping plan of a multi product order line, or the error that prevented it
+type LineShipping struct {
+	Shipping Shipping
+	Err      error
 }
@@ -0,0 +1,21 @@
+package product
+
+// ImportStatus tells what importing a product configuration into the catalogue did
+type ImportStatus string
+
+const (
+	// ImportStored configurations are stored as a new version of the product
+	ImportStored ImportStatus = "stored"
+	// ImportUnchanged configurations are the same as the latest version of the product, so nothing is stored
+	ImportUnchanged ImportStatus = "unchanged"
+	// ImportFailed configurations couldn't be stored, Err telling why
+	ImportFailed ImportStatus = "failed"
+)
+
+// ImportResult holds what importing a product configuration did and the version the product is left with
+type ImportResult struct {
+	PID     int
+	Status  ImportStatus
+	Version int
+	Err     error
+}
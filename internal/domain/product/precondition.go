@@ -0,0 +1,19 @@
+package product
+
+import "slices"
+
+// Precondition holds the latest configuration generations of a product a change requires, as given by an If-Match header
+// Any requires the product to be configured at any generation
+type Precondition struct {
+	Any         bool
+	Generations []int
+}
+
+// Matches method checks whether a product latest configuration generation, 0 when it isn't configured, satisfies the precondition
+func (p Precondition) Matches(generation int) bool {
+	if generation == 0 {
+		return false
+	}
+
+	return p.Any || slices.Contains(p.Generations, generation)
+}
@@ -1,8 +1,81 @@
 // Package product holds logic and representation of product data
 package product
 
+import (
+	"errors"
+	"time"
+)
+
 // Product holds data of a given product
+// Costs are optional and hold the cost of each package size in Packs
+// Containers are optional and hold the packaging levels packages are shipped in, from the innermost one
+// Version numbers each stored package sizes configuration of the product, starting at 1
+// Generation identifies each stored configuration among those of every product, never being reused even once a product is deleted and configured again
 type Product struct {
-	PID   int
-	Packs []int
+	PID        int
+	Packs      []int
+	Costs      []int
+	Containers []ContainerLevel
+	Version    int
+	Generation int
+}
+
+// ContainerLevel holds a packaging level, each of its containers holding up to Capacity items of the level below
+// the first level holds packages, and every next one holds containers of the previous level
+type ContainerLevel struct {
+	Name     string
+	Capacity int
+}
+
+var (
+	// ErrProductNotFound is returned when a product has no package sizes configuration stored
+	ErrProductNotFound = errors.New("product not found")
+	// ErrVersionNotFound is returned when a product has no package sizes configuration with a given version
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrVersionConflict is returned when a product package sizes configuration isn't at the generation a change requires
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrStorageUnavailable is returned when a package sizes change can't be persisted, leaving the stored products unchanged
+	ErrStorageUnavailable = errors.New("storage unavailable")
+	// ErrNoPackSizes is returned when a product configuration has no package sizes to ship with
+	ErrNoPackSizes = errors.New("no pack sizes found for product")
+	// ErrNoPackCosts is returned when a product configuration has no package costs to optimize
+	ErrNoPackCosts = errors.New("no pack costs found for product")
+)
+
+// Revision holds a stored package sizes configuration version along with when and by whom it was stored
+type Revision struct {
+	Product   Product
+	Timestamp time.Time
+	Caller    string
+}
+
+// PackCosts method maps each package size to its cost, keeping the cheapest one for repeated sizes
+// It returns nil when the product has no costs defined
+func (p Product) PackCosts() map[int]int {
+	if len(p.Costs) == 0 {
+		return nil
+	}
+
+	costs := make(map[int]int, len(p.Packs))
+	for i, size := range p.Packs {
+		cost, found := costs[size]
+		if !found || p.Costs[i] < cost {
+			costs[size] = p.Costs[i]
+		}
+	}
+
+	return costs
+}
+
+var (
+	// ErrStockNotFound is returned when a product has no stock tracked
+	ErrStockNotFound = errors.New("stock not found")
+	// ErrInsufficientStock is returned when the available stock can't serve a request
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// Stock holds the amount of available packages of each size for a given product
+type Stock struct {
+	PID    int
+	Levels map[int]int
 }
@@ -0,0 +1,27 @@
+package instrumentation
+
+import (
+	"strconv"
+	"time"
+)
+
+// CalculationMetrics records the shipping calculations solved for each product
+type CalculationMetrics struct {
+	duration  Histogram
+	orderSize Histogram
+}
+
+// NewCalculationMetrics registers the shipping calculations metrics
+func NewCalculationMetrics(m *Metrics) CalculationMetrics {
+	return CalculationMetrics{
+		duration:  m.NewHistogram("shipping_optimizer_solve_duration_seconds", "Duration of the shipping calculations.", DurationBuckets, "pid"),
+		orderSize: m.NewHistogram("shipping_optimizer_order_size_units", "Ordered quantities of the shipping calculations.", OrderSizeBuckets, "pid"),
+	}
+}
+
+// ObserveCalculation method records a shipping calculation of a product order
+func (c CalculationMetrics) ObserveCalculation(pid, qty int, duration time.Duration) {
+	label := strconv.Itoa(pid)
+	c.duration.Observe(duration.Seconds(), label)
+	c.orderSize.Observe(float64(qty), label)
+}
@@ -1,38 +1,107 @@
-// Package instrumentation handles logging
+// Package instrumentation handles logging and metrics
 package instrumentation
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"os"
 )
 
-// Logger provides logging methods
+// Log formats supported by the Logger
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// Logger provides leveled structured logging methods
+// the zero Logger logs through the default slog logger
 type Logger struct {
-	infoLog    *log.Logger
-	warningLog *log.Logger
-	errorLog   *log.Logger
+	logger *slog.Logger
+	level  *slog.LevelVar
+}
+
+// LoggerConfig wraps all configuration to initialize a new Logger
+// it defaults to text events of info level and above written to stdout
+type LoggerConfig struct {
+	Format string
+	Level  string
+	Output io.Writer
 }
 
 // NewLogger initializes a Logger
-func NewLogger() Logger {
-	return Logger{
-		infoLog:    log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime),
-		warningLog: log.New(os.Stdout, "[WARNING] ", log.Ldate|log.Ltime),
-		errorLog:   log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime),
+func NewLogger(lc LoggerConfig) Logger {
+	output := lc.Output
+	if output == nil {
+		output = os.Stdout
 	}
+
+	level := &slog.LevelVar{}
+	if lc.Level != "" {
+		// invalid levels are rejected by the configuration so they just keep the default one
+		level.UnmarshalText([]byte(lc.Level))
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	if lc.Format == JSONFormat {
+		return Logger{logger: slog.New(slog.NewJSONHandler(output, options)), level: level}
+	}
+
+	return Logger{logger: slog.New(slog.NewTextHandler(output, options)), level: level}
+}
+
+// With method returns a Logger adding the given key value pairs to every event
+func (l Logger) With(args ...any) Logger {
+	return Logger{logger: l.slog().With(args...), level: l.level}
 }
 
-// Info method logs an info event
-func (l Logger) Info(msg string) {
-	l.infoLog.Println(msg)
+// SetLevel method changes the lowest level logged, by this Logger and every other one sharing its output
+// the zero Logger level is the one of the default slog logger, which is not changed
+func (l Logger) SetLevel(level string) error {
+	if l.level == nil {
+		return errors.New("logger without level")
+	}
+
+	return l.level.UnmarshalText([]byte(level))
 }
 
-// Warning method logs a warning event
-func (l Logger) Warning(msg string) {
-	l.warningLog.Println(msg)
+// Debug method logs a debug event with optional key value pairs
+func (l Logger) Debug(msg string, args ...any) {
+	l.slog().Debug(msg, args...)
+}
+
+// Info method logs an info event with optional key value pairs
+func (l Logger) Info(msg string, args ...any) {
+	l.slog().Info(msg, args...)
+}
+
+// Warning method logs a warning event with optional key value pairs
+func (l Logger) Warning(msg string, args ...any) {
+	l.slog().Warn(msg, args...)
+}
+
+// Error method logs an error event with optional key value pairs
+func (l Logger) Error(msg string, args ...any) {
+	l.slog().Error(msg, args...)
+}
+
+func (l Logger) slog() *slog.Logger {
+	if l.logger == nil {
+		return slog.Default()
+	}
+	return l.logger
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying a request scoped Logger
+func WithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
-// Error method logs an error event
-func (l Logger) Error(msg string) {
-	l.errorLog.Println(msg)
+// ContextLogger returns the Logger carried by ctx, or the zero Logger when there is none
+func ContextLogger(ctx context.Context) Logger {
+	logger, _ := ctx.Value(loggerKey{}).(Logger)
+	return logger
 }
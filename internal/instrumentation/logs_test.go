@@ -2,8 +2,7 @@ package instrumentation
 
 import (
 	"bytes"
-	"io"
-	"os"
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,66 +12,85 @@ func TestLoggerMethods(t *testing.T) {
 	msg := "test message"
 
 	testCases := []struct {
-		desc           string
-		logFunc        func(Logger, string)
-		expectedStdout string
-		expectedStderr string
+		desc     string
+		config   LoggerConfig
+		logFunc  func(Logger, string, ...any)
+		expected string
 	}{
 		{
-			desc:           "info log",
-			logFunc:        Logger.Info,
-			expectedStdout: "^\\[INFO\\] \\d{4}/\\d{2}/\\d{2} \\d{2}:\\d{2}:\\d{2} test message\n$",
-			expectedStderr: "",
+			desc:     "info text log",
+			logFunc:  Logger.Info,
+			expected: "^time=\\S+ level=INFO msg=\"test message\" pid=4\n$",
 		},
 		{
-			desc:           "warning log",
-			logFunc:        Logger.Warning,
-			expectedStdout: "^\\[WARNING\\] \\d{4}/\\d{2}/\\d{2} \\d{2}:\\d{2}:\\d{2} test message\n$",
-			expectedStderr: "",
+			desc:     "warning text log",
+			logFunc:  Logger.Warning,
+			expected: "^time=\\S+ level=WARN msg=\"test message\" pid=4\n$",
 		},
 		{
-			desc:           "error log",
-			logFunc:        Logger.Error,
-			expectedStdout: "",
-			expectedStderr: "^\\[ERROR\\] \\d{4}/\\d{2}/\\d{2} \\d{2}:\\d{2}:\\d{2} test message\n$",
+			desc:     "error json log",
+			config:   LoggerConfig{Format: JSONFormat},
+			logFunc:  Logger.Error,
+			expected: "^{\"time\":\"\\S+\",\"level\":\"ERROR\",\"msg\":\"test message\",\"pid\":4}\n$",
+		},
+		{
+			desc:     "debug log below default level",
+			logFunc:  Logger.Debug,
+			expected: "^$",
+		},
+		{
+			desc:     "debug log with debug level",
+			config:   LoggerConfig{Level: "debug"},
+			logFunc:  Logger.Debug,
+			expected: "^time=\\S+ level=DEBUG msg=\"test message\" pid=4\n$",
+		},
+		{
+			desc:     "info log below configured level",
+			config:   LoggerConfig{Level: "warn"},
+			logFunc:  Logger.Info,
+			expected: "^$",
 		},
 	}
 
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			originalStdout := os.Stdout
-			originalStderr := os.Stderr
-			t.Cleanup(func() {
-				os.Stdout = originalStdout
-				os.Stderr = originalStderr
-			})
+			var buf bytes.Buffer
+			tC.config.Output = &buf
+
+			logger := NewLogger(tC.config)
+			tC.logFunc(logger, msg, "pid", 4)
+
+			assert.Regexp(t, tC.expected, buf.String())
+		})
+	}
+}
+
+func TestLoggerSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(LoggerConfig{Output: &buf})
+	requestLogger := logger.With("request_id", "4f2a9c61d0b3e875")
 
-			readStdout, writeStdout, err := os.Pipe()
-			assert.NoError(t, err)
-			os.Stdout = writeStdout
+	requestLogger.Debug("hidden message")
+	assert.Empty(t, buf.String())
 
-			readStderr, writeStderr, err := os.Pipe()
-			assert.NoError(t, err)
-			os.Stderr = writeStderr
+	// the level is shared by the loggers derived from the changed one
+	assert.NoError(t, logger.SetLevel("debug"))
+	requestLogger.Debug("test message")
+	assert.Contains(t, buf.String(), "level=DEBUG msg=\"test message\" request_id=4f2a9c61d0b3e875")
 
-			logger := NewLogger()
-			tC.logFunc(logger, msg)
+	assert.Error(t, logger.SetLevel("verbose"))
+	assert.Error(t, Logger{}.SetLevel("debug"))
+}
 
-			writeStdout.Close()
-			var bufStdout bytes.Buffer
-			io.Copy(&bufStdout, readStdout)
-			if tC.expectedStdout == "" {
-				assert.Empty(t, bufStdout.String())
-			}
-			assert.Regexp(t, tC.expectedStdout, bufStdout.String())
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(LoggerConfig{Format: JSONFormat, Output: &buf}).With("request_id", "4f2a9c61d0b3e875")
 
-			writeStderr.Close()
-			var bufStderr bytes.Buffer
-			io.Copy(&bufStderr, readStderr)
-			if tC.expectedStderr == "" {
-				assert.Empty(t, bufStderr.String())
-			}
-			assert.Regexp(t, tC.expectedStderr, bufStderr.String())
-		})
-	}
+	ctx := WithLogger(context.Background(), logger)
+	ContextLogger(ctx).Info("test message")
+	assert.Contains(t, buf.String(), `"msg":"test message","request_id":"4f2a9c61d0b3e875"`)
+
+	// a context without logger falls back to the default one
+	assert.Equal(t, Logger{}, ContextLogger(context.Background()))
+	assert.NotPanics(t, func() { ContextLogger(context.Background()).Debug("test message") })
 }
@@ -0,0 +1,272 @@
+package instrumentation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the histogram upper bounds, in seconds, used for durations
+var DurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// OrderSizeBuckets are the histogram upper bounds, in units, used for ordered quantities
+var OrderSizeBuckets = []float64{1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10}
+
+// Metrics holds a set of metrics exposed in the Prometheus text format
+// counters and histograms hold one series per combination of label values
+type Metrics struct {
+	m        sync.Mutex
+	families map[string]*family
+}
+
+// a family holds every series of a metric
+// function families have no series, their single value being read when exposed
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	value   func() float64
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewMetrics initializes an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		families: make(map[string]*family),
+	}
+}
+
+// Counter holds a metric that only increases
+type Counter struct {
+	metrics *Metrics
+	family  *family
+}
+
+// Histogram holds a metric counting observations in buckets of increasing upper bounds
+type Histogram struct {
+	metrics *Metrics
+	family  *family
+}
+
+// NewCounter method registers a new counter with the given label names
+func (m *Metrics) NewCounter(name, help string, labels ...string) Counter {
+	return Counter{
+		metrics: m,
+		family:  m.register(&family{name: name, help: help, kind: "counter", labels: labels}),
+	}
+}
+
+// NewHistogram method registers a new histogram with the given bucket upper bounds and label names
+func (m *Metrics) NewHistogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return Histogram{
+		metrics: m,
+		family:  m.register(&family{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets}),
+	}
+}
+
+// NewGaugeFunc method registers a new gauge whose value is read from a given function when exposed
+func (m *Metrics) NewGaugeFunc(name, help string, value func() float64) {
+	m.register(&family{name: name, help: help, kind: "gauge", value: value})
+}
+
+// NewCounterFunc method registers a new counter whose value is read from a given function when exposed
+func (m *Metrics) NewCounterFunc(name, help string, value func() float64) {
+	m.register(&family{name: name, help: help, kind: "counter", value: value})
+}
+
+// register adds a new family, panicking when its name is already registered as it can only be a programming error
+func (m *Metrics) register(f *family) *family {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if _, found := m.families[f.name]; found {
+		panic("metric already registered: " + f.name)
+	}
+	f.series = make(map[string]*series)
+	m.families[f.name] = f
+
+	return f
+}
+
+// Add method increases the counter series of the given label values
+func (c Counter) Add(v float64, labelValues ...string) {
+	c.metrics.m.Lock()
+	defer c.metrics.m.Unlock()
+
+	c.family.get(labelValues).value += v
+}
+
+// Observe method adds an observation to the histogram series of the given label values
+func (h Histogram) Observe(v float64, labelValues ...string) {
+	h.metrics.m.Lock()
+	defer h.metrics.m.Unlock()
+
+	s := h.family.get(labelValues)
+	for i, bound := range h.family.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// get returns the series of the given label values, creating it when missing
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, found := f.series[key]
+	if !found {
+		s = &series{
+			labelValues: slices.Clone(labelValues),
+			counts:      make([]uint64, len(f.buckets)),
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// WriteText method writes all metrics, followed by the Go runtime ones, in the Prometheus text exposition format
+// metrics and their series are sorted so that the output is stable
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.m.Lock()
+	families := slices.Collect(maps.Values(m.families))
+	m.m.Unlock()
+	slices.SortFunc(families, func(a, b *family) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	buf := bufio.NewWriter(w)
+	for _, f := range families {
+		// value functions may take their own locks so they are read outside the metrics one
+		if f.value != nil {
+			writeHeader(buf, f.name, f.help, f.kind)
+			writeSample(buf, f.name, "", f.value())
+			continue
+		}
+
+		m.m.Lock()
+		f.writeText(buf)
+		m.m.Unlock()
+	}
+	writeRuntime(buf)
+
+	return buf.Flush()
+}
+
+// Handler method returns an http handler exposing all metrics
+func (m *Metrics) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteText(w)
+	}
+}
+
+func (f *family) writeText(w *bufio.Writer) {
+	writeHeader(w, f.name, f.help, f.kind)
+
+	for _, key := range slices.Sorted(maps.Keys(f.series)) {
+		s := f.series[key]
+		labels := formatLabels(f.labels, s.labelValues)
+
+		if f.kind != "histogram" {
+			writeSample(w, f.name, labels, s.value)
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			writeSample(w, f.name+"_bucket", joinLabels(labels, `le="`+formatValue(bound)+`"`), float64(s.counts[i]))
+		}
+		writeSample(w, f.name+"_bucket", joinLabels(labels, `le="+Inf"`), float64(s.count))
+		writeSample(w, f.name+"_sum", labels, s.sum)
+		writeSample(w, f.name+"_count", labels, float64(s.count))
+	}
+}
+
+// writeRuntime writes the Go runtime metrics from a single memory statistics read
+func writeRuntime(w *bufio.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	for _, metric := range []struct {
+		name  string
+		help  string
+		kind  string
+		value float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_gc_cycles_total", "Number of completed garbage collection cycles.", "counter", float64(stats.NumGC)},
+		{"go_gc_pause_seconds_total", "Total time spent in garbage collection pauses.", "counter", time.Duration(stats.PauseTotalNs).Seconds()},
+		{"go_memstats_alloc_bytes", "Number of heap bytes allocated and still in use.", "gauge", float64(stats.Alloc)},
+		{"go_memstats_alloc_bytes_total", "Total number of heap bytes allocated, even if freed.", "counter", float64(stats.TotalAlloc)},
+		{"go_memstats_heap_objects", "Number of allocated heap objects.", "gauge", float64(stats.HeapObjects)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from the system.", "gauge", float64(stats.Sys)},
+		{"go_threads", "Number of OS threads created.", "gauge", float64(pprof.Lookup("threadcreate").Count())},
+	} {
+		writeHeader(w, metric.name, metric.help, metric.kind)
+		writeSample(w, metric.name, "", metric.value)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help), name, kind)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatValue(value))
+}
+
+// formatLabels formats label pairs escaping their values
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, name := range names {
+		pairs[i] = name + `="` + replacer.Replace(values[i]) + `"`
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
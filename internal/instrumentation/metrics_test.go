@@ -0,0 +1,113 @@
+package instrumentation
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsWriteText(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		register func(*Metrics)
+		expected string
+	}{
+		{
+			desc: "counter",
+			register: func(m *Metrics) {
+				c := m.NewCounter("test_total", "Test counter.", "route", "status")
+				c.Add(1, "/b", "200")
+				c.Add(2, "/a", "404")
+				c.Add(1, "/b", "200")
+			},
+			expected: "# HELP test_total Test counter.\n" +
+				"# TYPE test_total counter\n" +
+				"test_total{route=\"/a\",status=\"404\"} 2\n" +
+				"test_total{route=\"/b\",status=\"200\"} 2\n",
+		},
+		{
+			desc: "histogram",
+			register: func(m *Metrics) {
+				h := m.NewHistogram("test_seconds", "Test histogram.", []float64{0.1, 1}, "pid")
+				h.Observe(0.05, "1")
+				h.Observe(0.5, "1")
+				h.Observe(5, "1")
+			},
+			expected: "# HELP test_seconds Test histogram.\n" +
+				"# TYPE test_seconds histogram\n" +
+				"test_seconds_bucket{pid=\"1\",le=\"0.1\"} 1\n" +
+				"test_seconds_bucket{pid=\"1\",le=\"1\"} 2\n" +
+				"test_seconds_bucket{pid=\"1\",le=\"+Inf\"} 3\n" +
+				"test_seconds_sum{pid=\"1\"} 5.55\n" +
+				"test_seconds_count{pid=\"1\"} 3\n",
+		},
+		{
+			desc: "gauge function",
+			register: func(m *Metrics) {
+				m.NewGaugeFunc("test_products", "Test gauge.", func() float64 { return 7 })
+			},
+			expected: "# HELP test_products Test gauge.\n" +
+				"# TYPE test_products gauge\n" +
+				"test_products 7\n",
+		},
+		{
+			desc: "counter function",
+			register: func(m *Metrics) {
+				m.NewCounterFunc("test_hits_total", "Test counter function.", func() float64 { return 12 })
+			},
+			expected: "# HELP test_hits_total Test counter function.\n" +
+				"# TYPE test_hits_total counter\n" +
+				"test_hits_total 12\n",
+		},
+		{
+			desc: "escaped label values",
+			register: func(m *Metrics) {
+				m.NewCounter("test_total", "Test counter.", "route").Add(1, "a\"b\\c\nd")
+			},
+			expected: "# HELP test_total Test counter.\n" +
+				"# TYPE test_total counter\n" +
+				"test_total{route=\"a\\\"b\\\\c\\nd\"} 1\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			m := NewMetrics()
+			tC.register(m)
+
+			var buf bytes.Buffer
+			assert.NoError(t, m.WriteText(&buf))
+
+			// the runtime metrics always follow the registered ones
+			output := buf.String()
+			assert.Contains(t, output, "\n# TYPE go_goroutines gauge\n")
+			assert.Equal(t, tC.expected, output[:len(tC.expected)])
+		})
+	}
+}
+
+func TestMetricsRegistration(t *testing.T) {
+	m := NewMetrics()
+	c := m.NewCounter("test_total", "Test counter.", "route")
+
+	assert.Panics(t, func() { m.NewGaugeFunc("test_total", "Duplicated.", func() float64 { return 0 }) })
+	assert.Panics(t, func() { c.Add(1) })
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m := NewMetrics()
+	NewCalculationMetrics(m).ObserveCalculation(4, 250, 20*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.Handler()(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "shipping_optimizer_solve_duration_seconds_bucket{pid=\"4\",le=\"0.025\"} 1\n")
+	assert.Contains(t, rec.Body.String(), "shipping_optimizer_order_size_units_bucket{pid=\"4\",le=\"100\"} 0\n")
+	assert.Contains(t, rec.Body.String(), "shipping_optimizer_order_size_units_sum{pid=\"4\"} 250\n")
+}
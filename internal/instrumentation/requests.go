@@ -0,0 +1,16 @@
+package instrumentation
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the identifier of the request being served
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the identifier of the request carried by ctx, empty when there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
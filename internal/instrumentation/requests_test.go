@@ -0,0 +1,33 @@
+package instrumentation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			desc:     "context without request id",
+			ctx:      context.Background(),
+			expected: "",
+		},
+		{
+			desc:     "context with request id",
+			ctx:      WithRequestID(context.Background(), "4f2a9c61d0b3e875"),
+			expected: "4f2a9c61d0b3e875",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, RequestID(tC.ctx))
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Package ratelimit handles requests rate limiting and load shedding
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the buckets of idle clients are dropped
+const sweepInterval = time.Minute
+
+// Buckets limits the requests rate of each client through a token bucket
+// every client starts with a full bucket of burst tokens, refilled at rate tokens per second, a zero rate not limiting them
+type Buckets struct {
+	m       sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewBuckets initializes a Buckets with a given rate per second and burst
+func NewBuckets(rate float64, burst int) *Buckets {
+	return &Buckets{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetRate method changes the rate per second and burst of every client
+// buckets fuller than the new burst are reduced to it, and a zero rate stops limiting the clients
+func (b *Buckets) SetRate(rate float64, burst int) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.rate = rate
+	b.burst = float64(max(burst, 1))
+	if rate <= 0 {
+		clear(b.buckets)
+	}
+}
+
+// Allow method takes a token from the bucket of a client
+// when the bucket is empty it returns how long until the next token is available
+func (b *Buckets) Allow(client string) (bool, time.Duration) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.rate <= 0 {
+		return true, 0
+	}
+
+	now := b.now()
+	b.sweep(now)
+
+	bkt, found := b.buckets[client]
+	if !found {
+		bkt = &bucket{tokens: b.burst, updated: now}
+		b.buckets[client] = bkt
+	}
+
+	bkt.tokens = min(b.burst, bkt.tokens+now.Sub(bkt.updated).Seconds()*b.rate)
+	bkt.updated = now
+	if bkt.tokens >= 1 {
+		bkt.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bkt.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops the buckets that would already be full, as they are the same as new ones
+func (b *Buckets) sweep(now time.Time) {
+	if now.Sub(b.swept) < sweepInterval {
+		return
+	}
+	b.swept = now
+
+	for client, bkt := range b.buckets {
+		if bkt.tokens+now.Sub(bkt.updated).Seconds()*b.rate >= b.burst {
+			delete(b.buckets, client)
+		}
+	}
+}
+
+// RetryAfter converts a wait duration into the whole seconds of a Retry-After header, being at least one
+func RetryAfter(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// Semaphore limits the total weight of the work done concurrently
+type Semaphore struct {
+	m        sync.Mutex
+	capacity int
+	used     int
+}
+
+// NewSemaphore initializes a Semaphore with a given capacity
+func NewSemaphore(capacity int) *Semaphore {
+	return &Semaphore{
+		capacity: capacity,
+	}
+}
+
+// TryAcquire method acquires a given weight without waiting, returning the function that releases it
+// weights above the capacity are never acquired, as they could exhaust the memory even running alone
+func (s *Semaphore) TryAcquire(weight int) (func(), bool) {
+	weight = max(weight, 1)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.used+weight > s.capacity {
+		return nil, false
+	}
+	s.used += weight
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.m.Lock()
+			defer s.m.Unlock()
+			s.used -= weight
+		})
+	}, true
+}
+
+// Capacity method returns the highest weight that can be acquired
+func (s *Semaphore) Capacity() int {
+	return s.capacity
+}
+
+// InUse method returns the weight currently acquired
+func (s *Semaphore) InUse() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.used
+}
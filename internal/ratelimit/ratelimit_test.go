@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketsAllow(t *testing.T) {
+	now := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+	b := NewBuckets(2, 3)
+	b.now = func() time.Time { return now }
+
+	// the burst is served at once
+	for range 3 {
+		allowed, _ := b.Allow("ci")
+		assert.True(t, allowed)
+	}
+
+	allowed, wait := b.Allow("ci")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other clients have their own buckets
+	allowed, _ = b.Allow("planner")
+	assert.True(t, allowed)
+
+	// tokens are refilled over time
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = b.Allow("ci")
+	assert.True(t, allowed)
+	allowed, _ = b.Allow("ci")
+	assert.False(t, allowed)
+
+	// idle clients are dropped once their buckets are full again
+	now = now.Add(2 * time.Minute)
+	allowed, _ = b.Allow("ci")
+	assert.True(t, allowed)
+	assert.Len(t, b.buckets, 1)
+}
+
+func TestBucketsSetRate(t *testing.T) {
+	now := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+	b := NewBuckets(2, 3)
+	b.now = func() time.Time { return now }
+
+	// a smaller burst applies to the buckets already filled
+	b.Allow("ci")
+	b.SetRate(1, 1)
+	allowed, _ := b.Allow("ci")
+	assert.True(t, allowed)
+	allowed, wait := b.Allow("ci")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, wait)
+
+	// a zero rate stops limiting the clients
+	b.SetRate(0, 1)
+	for range 5 {
+		allowed, _ = b.Allow("ci")
+		assert.True(t, allowed)
+	}
+	assert.Empty(t, b.buckets)
+
+	// clients start with full buckets once limited again
+	b.SetRate(1, 2)
+	allowed, _ = b.Allow("ci")
+	assert.True(t, allowed)
+	allowed, _ = b.Allow("ci")
+	assert.True(t, allowed)
+	allowed, _ = b.Allow("ci")
+	assert.False(t, allowed)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 1, RetryAfter(0))
+	assert.Equal(t, 1, RetryAfter(500*time.Millisecond))
+	assert.Equal(t, 2, RetryAfter(1500*time.Millisecond))
+}
+
+func TestSemaphoreTryAcquire(t *testing.T) {
+	s := NewSemaphore(100)
+
+	releaseLarge, ok := s.TryAcquire(70)
+	assert.True(t, ok)
+
+	_, ok = s.TryAcquire(40)
+	assert.False(t, ok)
+
+	releaseSmall, ok := s.TryAcquire(30)
+	assert.True(t, ok)
+	assert.Equal(t, 100, s.InUse())
+
+	releaseLarge()
+	releaseLarge()
+	assert.Equal(t, 30, s.InUse())
+
+	releaseSmall()
+	assert.Equal(t, 0, s.InUse())
+
+	// weights above the capacity are never acquired, even with nothing else running
+	_, ok = s.TryAcquire(1000)
+	assert.False(t, ok)
+	assert.Equal(t, 0, s.InUse())
+	assert.Equal(t, 100, s.Capacity())
+}
@@ -0,0 +1,528 @@
+// Package packsizes handles file backed package sizes storage
+package packsizes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+const (
+	logFile      = "packsizes.log"
+	snapshotFile = "packsizes.snapshot"
+
+	// snapshotInterval is the amount of logged changes after which a new snapshot replaces the log
+	snapshotInterval = 1000
+)
+
+// PackSizes provides file backed storage for products package sizes
+// every stored configuration is kept as a new version of the product, with the next generation of all products
+// every change is appended to a write ahead log before being applied, and the log is periodically compacted into a snapshot
+type PackSizes struct {
+	m          sync.RWMutex
+	revisions  map[int][]product.Revision
+	generation int
+
+	dir      string
+	logger   instrumentation.Logger
+	log      *os.File
+	size     int64
+	logged   int
+	interval int
+}
+
+// a record holds a stored product revision as persisted in the log and snapshot files
+// deleted records are only logged, removing every revision of their product and taking a generation so that it is never reused
+type record struct {
+	PID        int               `json:"pid"`
+	Packs      []int             `json:"packs"`
+	Costs      []int             `json:"costs,omitempty"`
+	Containers []containerRecord `json:"containers,omitempty"`
+	Version    int               `json:"version"`
+	Generation int               `json:"generation"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Caller     string            `json:"caller"`
+	Deleted    bool              `json:"deleted,omitempty"`
+}
+
+// a containerRecord holds a packaging level of a stored product revision
+type containerRecord struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+}
+
+func newRecord(rev product.Revision) record {
+	rec := record{
+		PID:        rev.Product.PID,
+		Packs:      rev.Product.Packs,
+		Costs:      rev.Product.Costs,
+		Version:    rev.Product.Version,
+		Generation: rev.Product.Generation,
+		Timestamp:  rev.Timestamp,
+		Caller:     rev.Caller,
+	}
+	for _, level := range rev.Product.Containers {
+		rec.Containers = append(rec.Containers, containerRecord{Name: level.Name, Capacity: level.Capacity})
+	}
+
+	return rec
+}
+
+func (r record) revision() product.Revision {
+	rev := product.Revision{
+		Product: product.Product{
+			PID:        r.PID,
+			Packs:      r.Packs,
+			Costs:      r.Costs,
+			Version:    r.Version,
+			Generation: r.Generation,
+		},
+		Timestamp: r.Timestamp,
+		Caller:    r.Caller,
+	}
+	for _, level := range r.Containers {
+		rev.Product.Containers = append(rev.Product.Containers, product.ContainerLevel{Name: level.Name, Capacity: level.Capacity})
+	}
+
+	return rev
+}
+
+// NewPackSizes initializes a new PackSizes persisted in the given data directory
+// the stored products are recovered from the latest snapshot and the changes logged after it
+// a log tail left incomplete by a crash is discarded
+func NewPackSizes(dir string) (*PackSizes, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+
+	p := &PackSizes{
+		revisions: make(map[int][]product.Revision),
+		dir:       dir,
+		interval:  snapshotInterval,
+	}
+
+	err = p.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.replayLog()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// WithLogger method sets the Logger reporting the storage failures that don't fail any change
+func (p *PackSizes) WithLogger(logger instrumentation.Logger) *PackSizes {
+	p.logger = logger
+	return p
+}
+
+// Store method stores a new package sizes set version for a given product
+// it returns the stored revision with its assigned version and generation numbers
+// it fails with product.ErrStorageUnavailable when the change can't be persisted, leaving the stored products unchanged
+func (p *PackSizes) Store(rev product.Revision) (product.Revision, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.store(rev)
+}
+
+// CompareAndStore method stores a new package sizes set version for a given product only when its latest generation is still the given one
+// a product without any version is given as generation 0, and any other latest generation fails with product.ErrVersionConflict
+// it fails with product.ErrStorageUnavailable when the change can't be persisted, leaving the stored products unchanged
+func (p *PackSizes) CompareAndStore(rev product.Revision, generation int) (product.Revision, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	revisions := p.revisions[rev.Product.PID]
+	latest := 0
+	if len(revisions) > 0 {
+		latest = revisions[len(revisions)-1].Product.Generation
+	}
+	if latest != generation {
+		return product.Revision{}, product.ErrVersionConflict
+	}
+
+	return p.store(rev)
+}
+
+// store persists and stores a new version of a product, the lock being held
+func (p *PackSizes) store(rev product.Revision) (product.Revision, error) {
+	pid := rev.Product.PID
+	rev.Product.Version = len(p.revisions[pid]) + 1
+	rev.Product.Generation = p.generation + 1
+
+	err := p.append(newRecord(rev))
+	if err != nil {
+		return product.Revision{}, fmt.Errorf("%w: persisting product %d package sizes: %w", product.ErrStorageUnavailable, pid, err)
+	}
+
+	p.revisions[pid] = append(p.revisions[pid], rev)
+	p.generation = rev.Product.Generation
+	p.compact()
+
+	return rev, nil
+}
+
+// Delete method removes all package sizes set versions of a given product
+// it fails with product.ErrStorageUnavailable when the change can't be persisted, leaving the stored products unchanged
+func (p *PackSizes) Delete(pid int) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if len(p.revisions[pid]) == 0 {
+		return product.ErrProductNotFound
+	}
+
+	err := p.append(record{PID: pid, Generation: p.generation + 1, Deleted: true})
+	if err != nil {
+		return fmt.Errorf("%w: persisting product %d package sizes deletion: %w", product.ErrStorageUnavailable, pid, err)
+	}
+
+	delete(p.revisions, pid)
+	p.generation++
+	p.compact()
+
+	return nil
+}
+
+// Product method retrieves the latest package sizes set of a given product
+func (p *PackSizes) Product(pid int) (product.Product, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	revisions := p.revisions[pid]
+	if len(revisions) == 0 {
+		return product.Product{}, product.ErrProductNotFound
+	}
+
+	return revisions[len(revisions)-1].Product, nil
+}
+
+// Revision method retrieves a given package sizes set version of a product
+func (p *PackSizes) Revision(pid, version int) (product.Revision, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	revisions := p.revisions[pid]
+	if version <= 0 || version > len(revisions) {
+		return product.Revision{}, product.ErrVersionNotFound
+	}
+
+	return revisions[version-1], nil
+}
+
+// Count method returns the number of products with stored package sizes
+func (p *PackSizes) Count() int {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return len(p.revisions)
+}
+
+// Products method retrieves the latest package sizes set of every stored product, in product id order
+func (p *PackSizes) Products() []product.Product {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	products := make([]product.Product, 0, len(p.revisions))
+	for _, pid := range slices.Sorted(maps.Keys(p.revisions)) {
+		revisions := p.revisions[pid]
+		products = append(products, revisions[len(revisions)-1].Product)
+	}
+
+	return products
+}
+
+// List method retrieves the latest package sizes set of up to limit stored products with a product id above after, in product id order
+// products stored or deleted while listing are only seen by the following pages
+func (p *PackSizes) List(after, limit int) []product.Product {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	products := []product.Product{}
+	for _, pid := range slices.Sorted(maps.Keys(p.revisions)) {
+		if len(products) == limit {
+			break
+		}
+		if pid <= after {
+			continue
+		}
+
+		revisions := p.revisions[pid]
+		products = append(products, revisions[len(revisions)-1].Product)
+	}
+
+	return products
+}
+
+// History method retrieves all package sizes set versions of a product, from the oldest to the latest
+func (p *PackSizes) History(pid int) []product.Revision {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return slices.Clone(p.revisions[pid])
+}
+
+// Close method closes the log file
+func (p *PackSizes) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.log.Close()
+}
+
+// append writes a record to the log as a checksummed line and syncs it to disk
+// a failed write is cut from the log so that it never hides the following changes from recovery
+func (p *PackSizes) append(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	n, err := fmt.Fprintf(p.log, "%08x %s\n", crc32.ChecksumIEEE(data), data)
+	if err == nil {
+		err = p.log.Sync()
+	}
+	if err != nil {
+		if p.log.Truncate(p.size) == nil {
+			p.log.Seek(p.size, io.SeekStart)
+		}
+		return err
+	}
+
+	p.size += int64(n)
+	p.logged++
+
+	return nil
+}
+
+// compact replaces the log with a snapshot once enough changes were logged
+// the change is already safe in the log so a failed snapshot is only logged, being attempted again on the next change
+func (p *PackSizes) compact() {
+	if p.logged < p.interval {
+		return
+	}
+
+	err := p.snapshot()
+	if err != nil {
+		p.logger.Error("Package sizes snapshot failed, keeping the log", "dir", p.dir, "logged", p.logged, "error", err)
+	}
+}
+
+// snapshot atomically replaces the snapshot file with all stored revisions and then empties the log
+// a crash before the log is emptied only replays changes already included in the snapshot
+// when the latest generation was taken by a deletion, it is kept as a deletion of no product so that it is never reused
+func (p *PackSizes) snapshot() error {
+	var (
+		records []record
+		latest  int
+	)
+	for _, revisions := range p.revisions {
+		for _, rev := range revisions {
+			records = append(records, newRecord(rev))
+			latest = max(latest, rev.Product.Generation)
+		}
+	}
+	if latest < p.generation {
+		records = append(records, record{Generation: p.generation, Deleted: true})
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileSync(filepath.Join(p.dir, snapshotFile), data)
+	if err != nil {
+		return err
+	}
+
+	err = p.log.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.log.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	p.size = 0
+	p.logged = 0
+
+	return p.log.Sync()
+}
+
+// loadSnapshot loads the stored products from the snapshot file, when there is one
+func (p *PackSizes) loadSnapshot() error {
+	path := filepath.Join(p.dir, snapshotFile)
+
+	// a temporary file is only left behind by an interrupted snapshot, which never replaced the previous one
+	err := os.Remove(path + ".tmp")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing interrupted snapshot: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var records []record
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	slices.SortFunc(records, func(a, b record) int {
+		if a.PID != b.PID {
+			return a.PID - b.PID
+		}
+		return a.Version - b.Version
+	})
+	for _, rec := range records {
+		p.apply(rec)
+	}
+
+	return nil
+}
+
+// apply adds a recovered revision unless it was already recovered, as changes replayed after a snapshot may be
+// replaying a deletion already in the snapshot is harmless, as the revisions logged after it are then replayed again
+// revisions stored before generations were recorded are given the next ones
+func (p *PackSizes) apply(rec record) {
+	if rec.Generation == 0 && !rec.Deleted {
+		rec.Generation = p.generation + 1
+	}
+	p.generation = max(p.generation, rec.Generation)
+
+	if rec.Deleted {
+		delete(p.revisions, rec.PID)
+		return
+	}
+	if rec.Version != len(p.revisions[rec.PID])+1 {
+		return
+	}
+
+	p.revisions[rec.PID] = append(p.revisions[rec.PID], rec.revision())
+}
+
+// replayLog applies every valid change in the log and truncates it after the last one
+// the log is left open for appending the next changes
+func (p *PackSizes) replayLog() error {
+	f, err := os.OpenFile(filepath.Join(p.dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log: %w", err)
+	}
+
+	var valid int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// an incomplete last line was being written when the process stopped
+			break
+		}
+
+		rec, ok := parseRecord(line)
+		if !ok {
+			break
+		}
+
+		p.apply(rec)
+		p.logged++
+		valid += int64(len(line))
+	}
+
+	err = f.Truncate(valid)
+	if err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("recovering log: %w", err)
+	}
+
+	p.log = f
+	p.size = valid
+
+	return nil
+}
+
+// parseRecord decodes a log line, checking it wasn't corrupted
+func parseRecord(line []byte) (record, bool) {
+	checksum, data, found := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !found {
+		return record{}, false
+	}
+
+	var sum uint32
+	_, err := fmt.Sscanf(string(checksum), "%08x", &sum)
+	if err != nil || sum != crc32.ChecksumIEEE(data) {
+		return record{}, false
+	}
+
+	var rec record
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		return record{}, false
+	}
+
+	return rec, true
+}
+
+// writeFileSync atomically replaces a file by writing and syncing a temporary one and renaming it
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return err
+	}
+
+	// syncing the directory persists the rename itself
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,433 @@
+package packsizes
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackSizesStore(t *testing.T) {
+	ps, err := NewPackSizes(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { ps.Close() })
+
+	testCases := []struct {
+		desc     string
+		product  product.Product
+		expected product.Product
+	}{
+		{
+			desc: "new product store",
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+			},
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10, 12},
+				Version:    1,
+				Generation: 1,
+			},
+		},
+		{
+			desc: "existing product update",
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 15, 20},
+			},
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10, 15, 20},
+				Version:    2,
+				Generation: 2,
+			},
+		},
+		{
+			desc: "existing product update with costs",
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10},
+				Costs: []int{8, 15},
+			},
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10},
+				Costs:      []int{8, 15},
+				Version:    3,
+				Generation: 3,
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			rev, err := ps.Store(product.Revision{Product: tC.product, Caller: "tester"})
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, rev.Product)
+
+			res, err := ps.Product(tC.product.PID)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, res)
+
+			ver, err := ps.Revision(tC.product.PID, tC.expected.Version)
+			assert.NoError(t, err)
+			assert.Equal(t, rev, ver)
+		})
+	}
+
+	assert.Len(t, ps.History(1), len(testCases))
+	assert.Equal(t, 1, ps.Count())
+}
+
+func TestPackSizesCompareAndStore(t *testing.T) {
+	dir := t.TempDir()
+	ps, err := NewPackSizes(dir)
+	assert.NoError(t, err)
+
+	_, err = ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{5}}}, 1)
+	assert.ErrorIs(t, err, product.ErrVersionConflict)
+
+	rev, err := ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, product.Product{PID: 1, Packs: []int{5, 10}, Version: 1, Generation: 1}, rev.Product)
+
+	_, err = ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{7}}}, 0)
+	assert.ErrorIs(t, err, product.ErrVersionConflict)
+
+	rev, err = ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{250, 500}}}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rev.Product.Version)
+	assert.NoError(t, ps.Close())
+
+	// only the stored versions were persisted
+	recovered, err := NewPackSizes(dir)
+	assert.NoError(t, err)
+	t.Cleanup(func() { recovered.Close() })
+	res, err := recovered.Product(1)
+	assert.NoError(t, err)
+	assert.Equal(t, product.Product{PID: 1, Packs: []int{250, 500}, Version: 2, Generation: 2}, res)
+}
+
+func TestPackSizesStorageFailure(t *testing.T) {
+	ps, err := NewPackSizes(t.TempDir())
+	assert.NoError(t, err)
+	_, err = ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}})
+	assert.NoError(t, err)
+
+	// a closed log fails every write, as a full or failing disk would
+	assert.NoError(t, ps.Close())
+
+	_, err = ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{7}}})
+	assert.ErrorIs(t, err, product.ErrStorageUnavailable)
+	_, err = ps.CompareAndStore(product.Revision{Product: product.Product{PID: 2, Packs: []int{7}}}, 0)
+	assert.ErrorIs(t, err, product.ErrStorageUnavailable)
+	assert.ErrorIs(t, ps.Delete(1), product.ErrStorageUnavailable)
+
+	// the failed changes left the stored products unchanged
+	assert.Equal(t, []product.Product{{PID: 1, Packs: []int{5, 10}, Version: 1, Generation: 1}}, ps.Products())
+}
+
+func TestPackSizesSnapshotFailure(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	ps, err := NewPackSizes(dir)
+	assert.NoError(t, err)
+	ps.WithLogger(instrumentation.NewLogger(instrumentation.LoggerConfig{Output: &logs}))
+	ps.interval = 1
+	t.Cleanup(func() { ps.Close() })
+
+	// a directory in place of the temporary snapshot file fails every snapshot
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, snapshotFile+".tmp"), 0o755))
+
+	rev, err := ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rev.Product.Version)
+	assert.Contains(t, logs.String(), `level=ERROR msg="Package sizes snapshot failed, keeping the log"`)
+	assert.Equal(t, 1, ps.logged)
+}
+
+func TestPackSizesProduct(t *testing.T) {
+	ps, err := NewPackSizes(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { ps.Close() })
+
+	res, err := ps.Product(1)
+	assert.Error(t, err)
+	assert.Equal(t, product.Product{}, res)
+
+	rev, err := ps.Revision(1, 1)
+	assert.ErrorIs(t, err, product.ErrVersionNotFound)
+	assert.Equal(t, product.Revision{}, rev)
+	assert.Empty(t, ps.Products())
+}
+
+func TestPackSizesProducts(t *testing.T) {
+	ps, err := NewPackSizes(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { ps.Close() })
+
+	ps.Store(product.Revision{Product: product.Product{PID: 7, Packs: []int{250}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 2, Packs: []int{5, 10}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 7, Packs: []int{250, 500}}})
+
+	assert.Equal(t, []product.Product{
+		{PID: 2, Packs: []int{5, 10}, Version: 1, Generation: 2},
+		{PID: 7, Packs: []int{250, 500}, Version: 2, Generation: 3},
+	}, ps.Products())
+}
+
+func TestPackSizesList(t *testing.T) {
+	ps, err := NewPackSizes(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() { ps.Close() })
+	assert.Empty(t, ps.List(0, 10))
+
+	for _, pid := range []int{9, 3, 5, 1} {
+		ps.Store(product.Revision{Product: product.Product{PID: pid, Packs: []int{pid}}})
+	}
+
+	assert.Equal(t, []product.Product{
+		{PID: 1, Packs: []int{1}, Version: 1, Generation: 4},
+		{PID: 3, Packs: []int{3}, Version: 1, Generation: 2},
+	}, ps.List(0, 2))
+	assert.Equal(t, []product.Product{
+		{PID: 5, Packs: []int{5}, Version: 1, Generation: 3},
+		{PID: 9, Packs: []int{9}, Version: 1, Generation: 1},
+	}, ps.List(3, 5))
+}
+
+func TestPackSizesDelete(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		interval int
+	}{
+		{
+			desc:     "recovery from log",
+			interval: snapshotInterval,
+		},
+		{
+			desc:     "recovery from snapshot and log",
+			interval: 2,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dir := t.TempDir()
+
+			ps, err := NewPackSizes(dir)
+			assert.NoError(t, err)
+			ps.interval = tC.interval
+			ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}})
+			ps.Store(product.Revision{Product: product.Product{PID: 2, Packs: []int{23}}})
+			ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{250, 500}}})
+
+			assert.NoError(t, ps.Delete(1))
+			assert.NoError(t, ps.Delete(2))
+			assert.ErrorIs(t, ps.Delete(2), product.ErrProductNotFound)
+			_, err = ps.Product(1)
+			assert.ErrorIs(t, err, product.ErrProductNotFound)
+
+			// a deleted product is stored again from its first version, with a generation never taken before
+			rev, err := ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{7}}})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, rev.Product.Version)
+			assert.Equal(t, 6, rev.Product.Generation)
+			_, err = ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{9}}}, 3)
+			assert.ErrorIs(t, err, product.ErrVersionConflict)
+			assert.NoError(t, ps.Close())
+
+			recovered, err := NewPackSizes(dir)
+			assert.NoError(t, err)
+			t.Cleanup(func() { recovered.Close() })
+			assert.Equal(t, []product.Product{{PID: 1, Packs: []int{7}, Version: 1, Generation: 6}}, recovered.Products())
+		})
+	}
+}
+
+func TestPackSizesGenerationRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	ps, err := NewPackSizes(dir)
+	assert.NoError(t, err)
+	ps.interval = 1
+	ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 2, Packs: []int{23}}})
+	assert.NoError(t, ps.Delete(2))
+	assert.NoError(t, ps.Close())
+
+	// the generation taken by the deletion is kept by the snapshot, even with no product left holding it
+	recovered, err := NewPackSizes(dir)
+	assert.NoError(t, err)
+	t.Cleanup(func() { recovered.Close() })
+	rev, err := recovered.CompareAndStore(product.Revision{Product: product.Product{PID: 2, Packs: []int{31}}}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, product.Product{PID: 2, Packs: []int{31}, Version: 1, Generation: 4}, rev.Product)
+}
+
+func TestPackSizesRecovery(t *testing.T) {
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+	products := []product.Product{
+		{
+			PID:   1,
+			Packs: []int{5, 10, 12},
+		},
+		{
+			PID:   2,
+			Packs: []int{23, 31, 53},
+			Costs: []int{3, 4, 6},
+		},
+		{
+			PID:        1,
+			Packs:      []int{250, 500},
+			Containers: []product.ContainerLevel{{Name: "carton", Capacity: 8}, {Name: "pallet", Capacity: 30}},
+		},
+	}
+
+	testCases := []struct {
+		desc     string
+		interval int
+		tamper   func(t *testing.T, dir string)
+		expected map[int][]int
+	}{
+		{
+			desc:     "recovery from log",
+			interval: snapshotInterval,
+			tamper:   func(t *testing.T, dir string) {},
+			expected: map[int][]int{
+				1: {0, 2},
+				2: {1},
+			},
+		},
+		{
+			desc:     "recovery from snapshot and log",
+			interval: 2,
+			tamper:   func(t *testing.T, dir string) {},
+			expected: map[int][]int{
+				1: {0, 2},
+				2: {1},
+			},
+		},
+		{
+			desc:     "recovery replaying changes already in snapshot",
+			interval: snapshotInterval,
+			tamper: func(t *testing.T, dir string) {
+				data, err := os.ReadFile(filepath.Join(dir, logFile))
+				assert.NoError(t, err)
+
+				var records []record
+				for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+					rec, ok := parseRecord(line)
+					if ok {
+						records = append(records, rec)
+					}
+				}
+
+				data, err = json.Marshal(records)
+				assert.NoError(t, err)
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFile), data, 0o644))
+			},
+			expected: map[int][]int{
+				1: {0, 2},
+				2: {1},
+			},
+		},
+		{
+			desc:     "recovery discarding incomplete log tail",
+			interval: snapshotInterval,
+			tamper: func(t *testing.T, dir string) {
+				f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_WRONLY|os.O_APPEND, 0o644)
+				assert.NoError(t, err)
+				_, err = f.WriteString(`1a2b3c4d {"pid":3,"pac`)
+				assert.NoError(t, err)
+				assert.NoError(t, f.Close())
+			},
+			expected: map[int][]int{
+				1: {0, 2},
+				2: {1},
+			},
+		},
+		{
+			desc:     "recovery discarding corrupted log tail",
+			interval: snapshotInterval,
+			tamper: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, logFile)
+				data, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				data[len(data)-3] = '9'
+				assert.NoError(t, os.WriteFile(path, data, 0o644))
+			},
+			expected: map[int][]int{
+				1: {0},
+				2: {1},
+			},
+		},
+		{
+			desc:     "recovery ignoring interrupted snapshot",
+			interval: snapshotInterval,
+			tamper: func(t *testing.T, dir string) {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFile+".tmp"), []byte(`[{"pid":3`), 0o644))
+			},
+			expected: map[int][]int{
+				1: {0, 2},
+				2: {1},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dir := t.TempDir()
+
+			ps, err := NewPackSizes(dir)
+			assert.NoError(t, err)
+			ps.interval = tC.interval
+			stored := make([]product.Revision, len(products))
+			for i, prd := range products {
+				stored[i], err = ps.Store(product.Revision{Product: prd, Timestamp: timestamp, Caller: "tester"})
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, ps.Close())
+
+			tC.tamper(t, dir)
+
+			recovered, err := NewPackSizes(dir)
+			assert.NoError(t, err)
+			t.Cleanup(func() { recovered.Close() })
+
+			expected := make(map[int][]product.Revision)
+			for pid, indexes := range tC.expected {
+				for _, i := range indexes {
+					expected[pid] = append(expected[pid], stored[i])
+				}
+			}
+			assert.Equal(t, expected, recovered.revisions)
+
+			// changes after the recovery are appended to the valid log
+			recovered.Store(product.Revision{Product: product.Product{PID: 3, Packs: []int{7}}})
+			assert.NoError(t, recovered.Close())
+
+			reopened, err := NewPackSizes(dir)
+			assert.NoError(t, err)
+			t.Cleanup(func() { reopened.Close() })
+			res, err := reopened.Product(3)
+			assert.NoError(t, err)
+			assert.Equal(t, []int{7}, res.Packs)
+		})
+	}
+}
+
+func TestPackSizesInvalidSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFile), []byte(`[{"pid":1`), 0o644))
+
+	_, err := NewPackSizes(dir)
+	assert.Error(t, err)
+}
@@ -2,40 +2,158 @@
 package packsizes
 
 import (
-	"errors"
+	"maps"
+	"slices"
 	"sync"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
 )
 
 // PackSizes provides in memory storage for products package sizes
+// every stored configuration is kept as a new version of the product, with the next generation of all products
 type PackSizes struct {
-	m         sync.RWMutex
-	packsizes map[int][]int
+	m          sync.RWMutex
+	revisions  map[int][]product.Revision
+	generation int
 }
 
 // NewPackSizes initializes a new PackSizes
 func NewPackSizes() *PackSizes {
 	return &PackSizes{
-		packsizes: make(map[int][]int),
+		revisions: make(map[int][]product.Revision),
 	}
 }
 
-// Store method stores a new package sizes set for a given product
-func (p *PackSizes) Store(pid int, packs []int) {
+// Store method stores a new package sizes set version for a given product
+// it returns the stored revision with its assigned version and generation numbers
+func (p *PackSizes) Store(rev product.Revision) (product.Revision, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.store(rev), nil
+}
+
+// CompareAndStore method stores a new package sizes set version for a given product only when its latest generation is still the given one
+// a product without any version is given as generation 0, and any other latest generation fails with product.ErrVersionConflict
+func (p *PackSizes) CompareAndStore(rev product.Revision, generation int) (product.Revision, error) {
 	p.m.Lock()
 	defer p.m.Unlock()
 
-	p.packsizes[pid] = packs
+	if p.latestGeneration(rev.Product.PID) != generation {
+		return product.Revision{}, product.ErrVersionConflict
+	}
+
+	return p.store(rev), nil
+}
+
+// store stores a new version of a product, the lock being held
+func (p *PackSizes) store(rev product.Revision) product.Revision {
+	pid := rev.Product.PID
+	p.generation++
+	rev.Product.Version = len(p.revisions[pid]) + 1
+	rev.Product.Generation = p.generation
+	p.revisions[pid] = append(p.revisions[pid], rev)
+
+	return rev
+}
+
+// latestGeneration returns the generation of the latest version of a product, 0 when it has none, the lock being held
+func (p *PackSizes) latestGeneration(pid int) int {
+	revisions := p.revisions[pid]
+	if len(revisions) == 0 {
+		return 0
+	}
+
+	return revisions[len(revisions)-1].Product.Generation
+}
+
+// Product method retrieves the latest package sizes set of a given product
+func (p *PackSizes) Product(pid int) (product.Product, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	revisions := p.revisions[pid]
+	if len(revisions) == 0 {
+		return product.Product{}, product.ErrProductNotFound
+	}
+
+	return revisions[len(revisions)-1].Product, nil
+}
+
+// Revision method retrieves a given package sizes set version of a product
+func (p *PackSizes) Revision(pid, version int) (product.Revision, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	revisions := p.revisions[pid]
+	if version <= 0 || version > len(revisions) {
+		return product.Revision{}, product.ErrVersionNotFound
+	}
+
+	return revisions[version-1], nil
 }
 
-// PackSizes method retrieves the package sizes set of a given product
-func (p *PackSizes) PackSizes(pid int) ([]int, error) {
+// Count method returns the number of products with stored package sizes
+func (p *PackSizes) Count() int {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return len(p.revisions)
+}
+
+// Products method retrieves the latest package sizes set of every stored product, in product id order
+func (p *PackSizes) Products() []product.Product {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	products := make([]product.Product, 0, len(p.revisions))
+	for _, pid := range slices.Sorted(maps.Keys(p.revisions)) {
+		revisions := p.revisions[pid]
+		products = append(products, revisions[len(revisions)-1].Product)
+	}
+
+	return products
+}
+
+// List method retrieves the latest package sizes set of up to limit stored products with a product id above after, in product id order
+// products stored or deleted while listing are only seen by the following pages
+func (p *PackSizes) List(after, limit int) []product.Product {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	products := []product.Product{}
+	for _, pid := range slices.Sorted(maps.Keys(p.revisions)) {
+		if len(products) == limit {
+			break
+		}
+		if pid <= after {
+			continue
+		}
+
+		revisions := p.revisions[pid]
+		products = append(products, revisions[len(revisions)-1].Product)
+	}
+
+	return products
+}
+
+// Delete method removes all package sizes set versions of a given product
+func (p *PackSizes) Delete(pid int) error {
 	p.m.Lock()
 	defer p.m.Unlock()
 
-	packs, found := p.packsizes[pid]
-	if !found {
-		return nil, errors.New("product not found")
+	if len(p.revisions[pid]) == 0 {
+		return product.ErrProductNotFound
 	}
+	delete(p.revisions, pid)
+
+	return nil
+}
+
+// History method retrieves all package sizes set versions of a product, from the oldest to the latest
+func (p *PackSizes) History(pid int) []product.Revision {
+	p.m.RLock()
+	defer p.m.RUnlock()
 
-	return packs, nil
+	return slices.Clone(p.revisions[pid])
 }
@@ -3,64 +3,353 @@ package packsizes
 import (
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestPackSizesStore(t *testing.T) {
 	ps := NewPackSizes()
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
 
 	testCases := []struct {
-		desc  string
-		pid   int
-		packs []int
+		desc     string
+		product  product.Product
+		expected product.Product
 	}{
 		{
-			desc:  "new product store",
-			pid:   1,
-			packs: []int{5, 10, 12},
+			desc: "new product store",
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+			},
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10, 12},
+				Version:    1,
+				Generation: 1,
+			},
 		},
 		{
-			desc:  "existing product update",
-			pid:   1,
-			packs: []int{5, 10, 15, 20},
+			desc: "existing product update",
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 15, 20},
+			},
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10, 15, 20},
+				Version:    2,
+				Generation: 2,
+			},
+		},
+		{
+			desc: "existing product update with costs",
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10},
+				Costs: []int{8, 15},
+			},
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10},
+				Costs:      []int{8, 15},
+				Version:    3,
+				Generation: 3,
+			},
 		},
 	}
 
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			ps.Store(tC.pid, tC.packs)
-			res, err := ps.PackSizes(tC.pid)
+			rev, err := ps.Store(product.Revision{
+				Product:   tC.product,
+				Timestamp: timestamp,
+				Caller:    "tester",
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, product.Revision{
+				Product:   tC.expected,
+				Timestamp: timestamp,
+				Caller:    "tester",
+			}, rev)
+
+			res, err := ps.Product(tC.product.PID)
 			assert.NoError(t, err)
-			assert.Equal(t, tC.packs, res)
+			assert.Equal(t, tC.expected, res)
 		})
 	}
+
+	history := ps.History(1)
+	assert.Len(t, history, len(testCases))
+	for i, rev := range history {
+		assert.Equal(t, testCases[i].expected, rev.Product)
+	}
+
+	assert.Equal(t, 1, ps.Count())
 }
 
-func TestPackSizesPackSizes(t *testing.T) {
+func TestPackSizesCompareAndStore(t *testing.T) {
+	ps := NewPackSizes()
+
+	testCases := []struct {
+		desc          string
+		packs         []int
+		generation    int
+		expected      product.Product
+		expectedError error
+	}{
+		{
+			desc:          "new product expected at a generation",
+			packs:         []int{5},
+			generation:    1,
+			expected:      product.Product{},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:          "new product store",
+			packs:         []int{5, 10},
+			generation:    0,
+			expected:      product.Product{PID: 1, Packs: []int{5, 10}, Version: 1, Generation: 1},
+			expectedError: nil,
+		},
+		{
+			desc:          "existing product expected as new",
+			packs:         []int{5},
+			generation:    0,
+			expected:      product.Product{},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:          "existing product update",
+			packs:         []int{250, 500},
+			generation:    1,
+			expected:      product.Product{PID: 1, Packs: []int{250, 500}, Version: 2, Generation: 2},
+			expectedError: nil,
+		},
+		{
+			desc:          "stale generation",
+			packs:         []int{5},
+			generation:    1,
+			expected:      product.Product{},
+			expectedError: product.ErrVersionConflict,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			rev, err := ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: tC.packs}}, tC.generation)
+			assert.ErrorIs(t, err, tC.expectedError)
+			assert.Equal(t, tC.expected, rev.Product)
+		})
+	}
+
+	assert.Len(t, ps.History(1), 2)
+}
+
+func TestPackSizesConcurrentCompareAndStore(t *testing.T) {
+	ps := NewPackSizes()
+	ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5}}})
+
+	var (
+		wg     sync.WaitGroup
+		m      sync.Mutex
+		stored int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{10}}}, 1)
+			if err == nil {
+				m.Lock()
+				stored++
+				m.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// only one of the writers expecting the same version stores it
+	assert.Equal(t, 1, stored)
+	assert.Len(t, ps.History(1), 2)
+}
+
+func TestPackSizesProduct(t *testing.T) {
 	ps := NewPackSizes()
 
 	testCases := []struct {
 		desc          string
 		pid           int
-		expected      []int
+		expected      product.Product
 		expectedError assert.ErrorAssertionFunc
 	}{
 		{
 			desc:          "non existant product",
 			pid:           1,
-			expected:      nil,
+			expected:      product.Product{},
+			expectedError: assert.Error,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := ps.Product(tC.pid)
+			tC.expectedError(t, err)
+			assert.Equal(t, tC.expected, res)
+		})
+	}
+}
+
+func TestPackSizesProducts(t *testing.T) {
+	ps := NewPackSizes()
+	assert.Empty(t, ps.Products())
+
+	ps.Store(product.Revision{Product: product.Product{PID: 7, Packs: []int{250}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 2, Packs: []int{5, 10}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 7, Packs: []int{250, 500}}})
+
+	assert.Equal(t, []product.Product{
+		{PID: 2, Packs: []int{5, 10}, Version: 1, Generation: 2},
+		{PID: 7, Packs: []int{250, 500}, Version: 2, Generation: 3},
+	}, ps.Products())
+}
+
+func TestPackSizesList(t *testing.T) {
+	ps := NewPackSizes()
+	for _, pid := range []int{9, 3, 5, 1} {
+		ps.Store(product.Revision{Product: product.Product{PID: pid, Packs: []int{pid}}})
+	}
+	ps.Store(product.Revision{Product: product.Product{PID: 5, Packs: []int{50}}})
+
+	testCases := []struct {
+		desc     string
+		after    int
+		limit    int
+		expected []product.Product
+	}{
+		{
+			desc:  "first page",
+			limit: 2,
+			expected: []product.Product{
+				{PID: 1, Packs: []int{1}, Version: 1, Generation: 4},
+				{PID: 3, Packs: []int{3}, Version: 1, Generation: 2},
+			},
+		},
+		{
+			desc:  "page after a product",
+			after: 3,
+			limit: 2,
+			expected: []product.Product{
+				{PID: 5, Packs: []int{50}, Version: 2, Generation: 5},
+				{PID: 9, Packs: []int{9}, Version: 1, Generation: 1},
+			},
+		},
+		{
+			desc:  "page after a missing product",
+			after: 6,
+			limit: 2,
+			expected: []product.Product{
+				{PID: 9, Packs: []int{9}, Version: 1, Generation: 1},
+			},
+		},
+		{
+			desc:     "page after the last product",
+			after:    9,
+			limit:    2,
+			expected: []product.Product{},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, ps.List(tC.after, tC.limit))
+		})
+	}
+}
+
+func TestPackSizesDelete(t *testing.T) {
+	ps := NewPackSizes()
+	ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{250, 500}}})
+	ps.Store(product.Revision{Product: product.Product{PID: 2, Packs: []int{23}}})
+
+	assert.NoError(t, ps.Delete(1))
+	assert.ErrorIs(t, ps.Delete(1), product.ErrProductNotFound)
+	assert.ErrorIs(t, ps.Delete(3), product.ErrProductNotFound)
+
+	_, err := ps.Product(1)
+	assert.ErrorIs(t, err, product.ErrProductNotFound)
+	assert.Empty(t, ps.History(1))
+	assert.Equal(t, 1, ps.Count())
+
+	// a deleted product is stored again from its first version, with a generation never taken before
+	rev, err := ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{7}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rev.Product.Version)
+	assert.Equal(t, 4, rev.Product.Generation)
+	_, err = ps.CompareAndStore(product.Revision{Product: product.Product{PID: 1, Packs: []int{9}}}, 2)
+	assert.ErrorIs(t, err, product.ErrVersionConflict)
+}
+
+func TestPackSizesRevision(t *testing.T) {
+	ps := NewPackSizes()
+	ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}}, Caller: "first"})
+	ps.Store(product.Revision{Product: product.Product{PID: 1, Packs: []int{250, 500}}, Caller: "second"})
+
+	testCases := []struct {
+		desc          string
+		pid           int
+		version       int
+		expected      product.Revision
+		expectedError assert.ErrorAssertionFunc
+	}{
+		{
+			desc:    "first version",
+			pid:     1,
+			version: 1,
+			expected: product.Revision{
+				Product: product.Product{PID: 1, Packs: []int{5, 10}, Version: 1, Generation: 1},
+				Caller:  "first",
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc:    "latest version",
+			pid:     1,
+			version: 2,
+			expected: product.Revision{
+				Product: product.Product{PID: 1, Packs: []int{250, 500}, Version: 2, Generation: 2},
+				Caller:  "second",
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc:          "non existant version",
+			pid:           1,
+			version:       3,
+			expected:      product.Revision{},
+			expectedError: assert.Error,
+		},
+		{
+			desc:          "non existant product",
+			pid:           2,
+			version:       1,
+			expected:      product.Revision{},
 			expectedError: assert.Error,
 		},
 	}
 
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			res, err := ps.PackSizes(tC.pid)
+			res, err := ps.Revision(tC.pid, tC.version)
 			tC.expectedError(t, err)
 			assert.Equal(t, tC.expected, res)
 		})
 	}
+
+	assert.Empty(t, ps.History(2))
 }
 
 func TestPackSizesConcurrentAccess(t *testing.T) {
@@ -71,7 +360,7 @@ func TestPackSizesConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func(pid int) {
 			defer wg.Done()
-			ps.Store(pid, []int{pid})
+			ps.Store(product.Revision{Product: product.Product{PID: pid, Packs: []int{pid}}})
 		}(i)
 	}
 
@@ -82,11 +371,50 @@ func TestPackSizesConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func(pid int) {
 			defer wg.Done()
-			val, err := ps.PackSizes(pid)
+			val, err := ps.Product(pid)
 			assert.NoError(t, err)
-			assert.Equal(t, []int{pid}, val)
+			assert.Equal(t, []int{pid}, val.Packs)
 		}(i)
 	}
 
 	wg.Wait()
 }
+
+func TestPackSizesConcurrentListAndDelete(t *testing.T) {
+	ps := NewPackSizes()
+	for pid := 1; pid <= 100; pid++ {
+		ps.Store(product.Revision{Product: product.Product{PID: pid, Packs: []int{pid}}})
+	}
+
+	wg := sync.WaitGroup{}
+	for pid := 1; pid <= 100; pid++ {
+		wg.Add(2)
+		go func(pid int) {
+			defer wg.Done()
+			assert.NoError(t, ps.Delete(pid))
+		}(pid)
+		go func(pid int) {
+			defer wg.Done()
+			ps.Store(product.Revision{Product: product.Product{PID: pid + 100, Packs: []int{pid}}})
+		}(pid)
+	}
+
+	// pages are always in product id order, whatever changes in between
+	listed := 0
+	for after := 0; ; {
+		page := ps.List(after, 7)
+		if len(page) == 0 {
+			break
+		}
+		for _, prd := range page {
+			assert.Greater(t, prd.PID, after)
+			after = prd.PID
+		}
+		listed += len(page)
+	}
+	assert.LessOrEqual(t, listed, 200)
+
+	wg.Wait()
+	assert.Len(t, ps.List(0, 1000), 100)
+	assert.Equal(t, 101, ps.List(0, 1)[0].PID)
+}
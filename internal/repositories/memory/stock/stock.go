@@ -0,0 +1,73 @@
+// Package stock handles in memory packages stock storage
+package stock
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+)
+
+// Stock provides in memory storage for products packages stock
+type Stock struct {
+	m      sync.RWMutex
+	levels map[int]map[int]int
+}
+
+// NewStock initializes a new Stock
+func NewStock() *Stock {
+	return &Stock{
+		levels: make(map[int]map[int]int),
+	}
+}
+
+// Store method replaces the packages stock of a given product
+func (s *Stock) Store(stk product.Stock) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.levels[stk.PID] = maps.Clone(stk.Levels)
+}
+
+// Stock method retrieves the packages stock of a given product
+func (s *Stock) Stock(pid int) (product.Stock, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	levels, found := s.levels[pid]
+	if !found {
+		return product.Stock{}, product.ErrStockNotFound
+	}
+
+	return product.Stock{
+		PID:    pid,
+		Levels: maps.Clone(levels),
+	}, nil
+}
+
+// Decrement method removes the given packages from the stock of a product
+// Either all packages are removed or, when any of them isn't available, none is
+func (s *Stock) Decrement(stk product.Stock) (product.Stock, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	levels, found := s.levels[stk.PID]
+	if !found {
+		return product.Stock{}, product.ErrStockNotFound
+	}
+
+	for size, qty := range stk.Levels {
+		if levels[size] < qty {
+			return product.Stock{}, product.ErrInsufficientStock
+		}
+	}
+
+	for size, qty := range stk.Levels {
+		levels[size] -= qty
+	}
+
+	return product.Stock{
+		PID:    stk.PID,
+		Levels: maps.Clone(levels),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package stock
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStockStore(t *testing.T) {
+	s := NewStock()
+
+	testCases := []struct {
+		desc  string
+		stock product.Stock
+	}{
+		{
+			desc: "new product stock store",
+			stock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 10, 10: 4},
+			},
+		},
+		{
+			desc: "existing product stock update",
+			stock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 2, 12: 1},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s.Store(tC.stock)
+			res, err := s.Stock(tC.stock.PID)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.stock, res)
+		})
+	}
+}
+
+func TestStockStock(t *testing.T) {
+	s := NewStock()
+
+	res, err := s.Stock(1)
+	assert.Error(t, err)
+	assert.Equal(t, product.Stock{}, res)
+}
+
+func TestStockDecrement(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		decrement     product.Stock
+		expected      product.Stock
+		expectedStock product.Stock
+		expectedError error
+	}{
+		{
+			desc: "untracked product",
+			decrement: product.Stock{
+				PID:    2,
+				Levels: map[int]int{5: 1},
+			},
+			expected: product.Stock{},
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 10, 10: 4},
+			},
+			expectedError: product.ErrStockNotFound,
+		},
+		{
+			desc: "insufficient stock",
+			decrement: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 1, 10: 5},
+			},
+			expected: product.Stock{},
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 10, 10: 4},
+			},
+			expectedError: product.ErrInsufficientStock,
+		},
+		{
+			desc: "decrement success",
+			decrement: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 1, 10: 4},
+			},
+			expected: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 9, 10: 0},
+			},
+			expectedStock: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 9, 10: 0},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewStock()
+			s.Store(product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 10, 10: 4},
+			})
+
+			res, err := s.Decrement(tC.decrement)
+			assert.ErrorIs(t, err, tC.expectedError)
+			assert.Equal(t, tC.expected, res)
+
+			stk, err := s.Stock(1)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expectedStock, stk)
+		})
+	}
+}
+
+func TestStockConcurrentDecrement(t *testing.T) {
+	s := NewStock()
+	s.Store(product.Stock{
+		PID:    1,
+		Levels: map[int]int{5: 100},
+	})
+
+	wg := sync.WaitGroup{}
+	for range 150 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Decrement(product.Stock{PID: 1, Levels: map[int]int{5: 1}})
+		}()
+	}
+
+	wg.Wait()
+
+	res, err := s.Stock(1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]int{5: 0}, res.Levels)
+}
@@ -2,17 +2,48 @@
 package repositories
 
 import (
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	filepacksizes "github.com/ftfmtavares/shipping-optimizer/internal/repositories/file/packsizes"
 	"github.com/ftfmtavares/shipping-optimizer/internal/repositories/memory/packsizes"
+	"github.com/ftfmtavares/shipping-optimizer/internal/repositories/memory/stock"
 )
 
+// PackSizesStorage provides storage access to products package sizes and their versions
+type PackSizesStorage interface {
+	Product(int) (product.Product, error)
+	Revision(int, int) (product.Revision, error)
+	History(int) []product.Revision
+	Products() []product.Product
+	List(int, int) []product.Product
+	Count() int
+	Store(product.Revision) (product.Revision, error)
+	CompareAndStore(product.Revision, int) (product.Revision, error)
+	Delete(int) error
+}
+
 // Repositories holds all repositories
 type Repositories struct {
-	PackSizes *packsizes.PackSizes
+	PackSizes PackSizesStorage
+	Stock     *stock.Stock
 }
 
 // NewAPIRepositories initializes a Repositories for the api application
-func NewAPIRepositories() (r Repositories) {
-	return Repositories{
-		PackSizes: packsizes.NewPackSizes(),
+// package sizes are kept in memory or persisted in the data directory according to the configured storage backend
+// the storage failures that don't fail any change are reported by the logger
+func NewAPIRepositories(cfg config.Config, logger instrumentation.Logger) (Repositories, error) {
+	var packSizes PackSizesStorage = packsizes.NewPackSizes()
+	if cfg.StorageBackend == config.FileStorage {
+		filePackSizes, err := filepacksizes.NewPackSizes(cfg.DataDir)
+		if err != nil {
+			return Repositories{}, err
+		}
+		packSizes = filePackSizes.WithLogger(logger)
 	}
+
+	return Repositories{
+		PackSizes: packSizes,
+		Stock:     stock.NewStock(),
+	}, nil
 }
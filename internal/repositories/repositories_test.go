@@ -3,10 +3,58 @@ package repositories
 import (
 	"testing"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/config"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	filepacksizes "github.com/ftfmtavares/shipping-optimizer/internal/repositories/file/packsizes"
+	"github.com/ftfmtavares/shipping-optimizer/internal/repositories/memory/packsizes"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewAPIRepositories(t *testing.T) {
-	repo := NewAPIRepositories()
-	assert.NotNil(t, repo.PackSizes)
+	testCases := []struct {
+		desc              string
+		cfg               config.Config
+		expectedPackSizes any
+		expectedErr       assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "memory storage",
+			cfg: config.Config{
+				StorageBackend: config.MemoryStorage,
+			},
+			expectedPackSizes: &packsizes.PackSizes{},
+			expectedErr:       assert.NoError,
+		},
+		{
+			desc: "file storage",
+			cfg: config.Config{
+				StorageBackend: config.FileStorage,
+				DataDir:        t.TempDir(),
+			},
+			expectedPackSizes: &filepacksizes.PackSizes{},
+			expectedErr:       assert.NoError,
+		},
+		{
+			desc: "file storage with invalid data directory",
+			cfg: config.Config{
+				StorageBackend: config.FileStorage,
+				DataDir:        "/dev/null/data",
+			},
+			expectedPackSizes: nil,
+			expectedErr:       assert.Error,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			repo, err := NewAPIRepositories(tC.cfg, instrumentation.NewLogger(instrumentation.LoggerConfig{}))
+			tC.expectedErr(t, err)
+			if err != nil {
+				return
+			}
+
+			assert.IsType(t, tC.expectedPackSizes, repo.PackSizes)
+			assert.NotNil(t, repo.Stock)
+		})
+	}
 }
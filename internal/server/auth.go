@@ -0,0 +1,322 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// APIKeyHeader carries the api key of a caller, which may also be given as a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator identifies the api callers through api keys or HMAC signed JWTs
+// api keys are kept as SHA-256 hashes, and the ones managed through the api are persisted in the keys file
+type Authenticator struct {
+	m      sync.RWMutex
+	keys   map[string]storedKey
+	file   string
+	secret []byte
+	now    func() time.Time
+}
+
+// a storedKey holds an api key along with the hash of its secret
+type storedKey struct {
+	auth.Key
+	Hash string `json:"hash"`
+}
+
+// AuthConfig wraps all configuration to initialize a new Authenticator
+// Keys are static api keys, KeysFile persists the keys managed through the api and JWTSecret verifies HS256 tokens
+type AuthConfig struct {
+	Keys      []APIKey
+	KeysFile  string
+	JWTSecret string
+}
+
+// APIKey holds a static api key and its secret
+type APIKey struct {
+	ID   string
+	Role auth.Role
+	Key  string
+}
+
+// a keyRecord holds an api key as persisted in the keys file
+type keyRecord struct {
+	ID   string    `json:"id"`
+	Role auth.Role `json:"role"`
+	Hash string    `json:"hash"`
+}
+
+// NewAuthenticator initializes an Authenticator loading the persisted keys along with the static ones
+func NewAuthenticator(ac AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		keys:   make(map[string]storedKey),
+		file:   ac.KeysFile,
+		secret: []byte(ac.JWTSecret),
+		now:    time.Now,
+	}
+
+	if a.file != "" {
+		data, err := os.ReadFile(a.file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading keys file: %w", err)
+		}
+		if err == nil {
+			var records []keyRecord
+			err = json.Unmarshal(data, &records)
+			if err != nil {
+				return nil, fmt.Errorf("decoding keys file: %w", err)
+			}
+			for _, rec := range records {
+				a.keys[rec.ID] = storedKey{Key: auth.Key{ID: rec.ID, Role: rec.Role}, Hash: rec.Hash}
+			}
+		}
+	}
+
+	for _, key := range ac.Keys {
+		if key.ID == "" || key.Key == "" || key.Role == auth.Public {
+			return nil, fmt.Errorf("invalid static api key %q", key.ID)
+		}
+		a.keys[key.ID] = storedKey{Key: auth.Key{ID: key.ID, Role: key.Role, Static: true}, Hash: hashKey(key.Key)}
+	}
+
+	return a, nil
+}
+
+// Authenticate method identifies the caller of a request
+// a bearer token with three dot separated parts is verified as a JWT, any other credential as an api key
+func (a *Authenticator) Authenticate(r *http.Request) (auth.Identity, error) {
+	credential := r.Header.Get(APIKeyHeader)
+	if credential == "" {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found {
+			return auth.Identity{}, auth.ErrMissingCredentials
+		}
+		if strings.Count(token, ".") == 2 {
+			return a.verifyToken(token)
+		}
+		credential = token
+	}
+
+	hash := hashKey(credential)
+
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	for _, key := range a.keys {
+		if hmac.Equal([]byte(key.Hash), []byte(hash)) {
+			return auth.Identity{Subject: key.ID, Role: key.Role}, nil
+		}
+	}
+
+	return auth.Identity{}, auth.ErrInvalidCredentials
+}
+
+// verifyToken checks the signature and validity period of an HS256 JWT
+// the token subject and role claims identify the caller
+func (a *Authenticator) verifyToken(token string) (auth.Identity, error) {
+	if len(a.secret) == 0 {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+
+	parts := strings.Split(token, ".")
+
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if decodeSegment(parts[0], &header) != nil || header.Alg != "HS256" {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+
+	var claims struct {
+		Sub  string    `json:"sub"`
+		Role auth.Role `json:"role"`
+		Exp  *int64    `json:"exp"`
+		Nbf  *int64    `json:"nbf"`
+	}
+	if decodeSegment(parts[1], &claims) != nil || claims.Sub == "" || claims.Role == auth.Public {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+
+	now := a.now().Unix()
+	if claims.Exp != nil && now >= *claims.Exp || claims.Nbf != nil && now < *claims.Nbf {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+
+	return auth.Identity{Subject: claims.Sub, Role: claims.Role}, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Keys method lists all api keys sorted by id
+func (a *Authenticator) Keys() []auth.Key {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	keys := make([]auth.Key, 0, len(a.keys))
+	for _, id := range slices.Sorted(maps.Keys(a.keys)) {
+		keys = append(keys, a.keys[id].Key)
+	}
+
+	return keys
+}
+
+// CreateKey method creates a new api key with a given id and role, returning its generated secret
+// the secret is only known by the caller, as just its hash is kept
+func (a *Authenticator) CreateKey(id string, role auth.Role) (string, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if _, found := a.keys[id]; found {
+		return "", auth.ErrKeyExists
+	}
+
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	key := hex.EncodeToString(secret)
+
+	a.keys[id] = storedKey{Key: auth.Key{ID: id, Role: role}, Hash: hashKey(key)}
+	err := a.persist()
+	if err != nil {
+		delete(a.keys, id)
+		return "", err
+	}
+
+	return key, nil
+}
+
+// DeleteKey method deletes an api key managed through the api
+func (a *Authenticator) DeleteKey(id string) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	key, found := a.keys[id]
+	if !found {
+		return auth.ErrKeyNotFound
+	}
+	if key.Static {
+		return auth.ErrStaticKey
+	}
+
+	delete(a.keys, id)
+	err := a.persist()
+	if err != nil {
+		a.keys[id] = key
+		return err
+	}
+
+	return nil
+}
+
+// persist atomically rewrites the keys file with the keys managed through the api
+func (a *Authenticator) persist() error {
+	if a.file == "" {
+		return nil
+	}
+
+	records := []keyRecord{}
+	for _, id := range slices.Sorted(maps.Keys(a.keys)) {
+		key := a.keys[id]
+		if !key.Static {
+			records = append(records, keyRecord{ID: key.ID, Role: key.Role, Hash: key.Hash})
+		}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := a.file + ".tmp"
+	err = os.MkdirAll(filepath.Dir(a.file), 0o755)
+	if err == nil {
+		err = os.WriteFile(tmp, data, 0o600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, a.file)
+	}
+	if err != nil {
+		return fmt.Errorf("persisting keys file: %w", err)
+	}
+
+	return nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity of the caller
+func WithIdentity(ctx context.Context, identity auth.Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// ContextIdentity returns the identity of the caller carried by ctx, if authenticated
+func ContextIdentity(ctx context.Context) (auth.Identity, bool) {
+	identity, found := ctx.Value(identityKey{}).(auth.Identity)
+	return identity, found
+}
+
+// wrapAuth rejects requests without credentials allowing the route role
+// routes are open when no Authenticator is set, and preflight requests never carry credentials
+func (s *HTTPServer) wrapAuth(role auth.Role, handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil || role == auth.Public || r.Method == http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		logger := instrumentation.ContextLogger(r.Context())
+		identity, err := s.auth.Authenticate(r)
+		if err != nil {
+			logger.Warning("Authentication failed", "error", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+
+		if !identity.Role.Allows(role) {
+			logger.Warning("Authorization failed", "caller", identity.Subject, "role", identity.Role.String(), "required_role", role.String())
+			writeError(w, r, http.StatusForbidden, "forbidden", "role "+role.String()+" required")
+			return
+		}
+
+		ctx := WithIdentity(r.Context(), identity)
+		ctx = instrumentation.WithLogger(ctx, logger.With("caller", identity.Subject))
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/stretchr/testify/assert"
+)
+
+// testToken signs a JWT with a given header and claims
+func testToken(secret, header, claims string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticatorAuthenticate(t *testing.T) {
+	now := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+
+	a, err := NewAuthenticator(AuthConfig{
+		Keys:      []APIKey{{ID: "ci", Role: auth.Editor, Key: "s3cr3t"}},
+		JWTSecret: "signing-secret",
+	})
+	assert.NoError(t, err)
+	a.now = func() time.Time { return now }
+
+	testCases := []struct {
+		desc             string
+		headers          map[string]string
+		expectedIdentity auth.Identity
+		expectedErr      error
+	}{
+		{
+			desc:        "missing credentials",
+			expectedErr: auth.ErrMissingCredentials,
+		},
+		{
+			desc:             "api key header",
+			headers:          map[string]string{"X-API-Key": "s3cr3t"},
+			expectedIdentity: auth.Identity{Subject: "ci", Role: auth.Editor},
+		},
+		{
+			desc:             "api key bearer",
+			headers:          map[string]string{"Authorization": "Bearer s3cr3t"},
+			expectedIdentity: auth.Identity{Subject: "ci", Role: auth.Editor},
+		},
+		{
+			desc:        "invalid api key",
+			headers:     map[string]string{"X-API-Key": "guess"},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			desc:        "unsupported authorization scheme",
+			headers:     map[string]string{"Authorization": "Basic Y2k6czNjcjN0"},
+			expectedErr: auth.ErrMissingCredentials,
+		},
+		{
+			desc:             "valid token",
+			headers:          map[string]string{"Authorization": "Bearer " + testToken("signing-secret", hs256, `{"sub":"planner","role":"viewer","exp":1762745200}`)},
+			expectedIdentity: auth.Identity{Subject: "planner", Role: auth.Viewer},
+		},
+		{
+			desc:        "expired token",
+			headers:     map[string]string{"Authorization": "Bearer " + testToken("signing-secret", hs256, `{"sub":"planner","role":"viewer","exp":1762741595}`)},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			desc:        "token not yet valid",
+			headers:     map[string]string{"Authorization": "Bearer " + testToken("signing-secret", hs256, `{"sub":"planner","role":"viewer","nbf":1762745200}`)},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			desc:        "token signed with another secret",
+			headers:     map[string]string{"Authorization": "Bearer " + testToken("other-secret", hs256, `{"sub":"planner","role":"admin"}`)},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			desc:        "token with another algorithm",
+			headers:     map[string]string{"Authorization": "Bearer " + testToken("signing-secret", `{"alg":"none"}`, `{"sub":"planner","role":"admin"}`)},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			desc:        "token with invalid role",
+			headers:     map[string]string{"Authorization": "Bearer " + testToken("signing-secret", hs256, `{"sub":"planner","role":"owner"}`)},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for header, value := range tC.headers {
+				req.Header.Set(header, value)
+			}
+
+			identity, err := a.Authenticate(req)
+			assert.ErrorIs(t, err, tC.expectedErr)
+			assert.Equal(t, tC.expectedIdentity, identity)
+		})
+	}
+}
+
+func TestAuthenticatorKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+
+	a, err := NewAuthenticator(AuthConfig{
+		Keys:     []APIKey{{ID: "ops", Role: auth.Admin, Key: "t0p"}},
+		KeysFile: file,
+	})
+	assert.NoError(t, err)
+
+	key, err := a.CreateKey("ci", auth.Editor)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^[0-9a-f]{64}$", key)
+
+	_, err = a.CreateKey("ci", auth.Viewer)
+	assert.ErrorIs(t, err, auth.ErrKeyExists)
+
+	assert.Equal(t, []auth.Key{
+		{ID: "ci", Role: auth.Editor},
+		{ID: "ops", Role: auth.Admin, Static: true},
+	}, a.Keys())
+
+	// only the keys managed through the api are persisted, and only as hashes
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), key)
+	assert.NotContains(t, string(data), "ops")
+
+	reloaded, err := NewAuthenticator(AuthConfig{KeysFile: file})
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-API-Key", key)
+	identity, err := reloaded.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Identity{Subject: "ci", Role: auth.Editor}, identity)
+
+	assert.ErrorIs(t, a.DeleteKey("ops"), auth.ErrStaticKey)
+	assert.ErrorIs(t, a.DeleteKey("unknown"), auth.ErrKeyNotFound)
+	assert.NoError(t, a.DeleteKey("ci"))
+
+	reloaded, err = NewAuthenticator(AuthConfig{KeysFile: file})
+	assert.NoError(t, err)
+	assert.Empty(t, reloaded.Keys())
+}
+
+func TestNewAuthenticatorErrors(t *testing.T) {
+	invalidFile := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, os.WriteFile(invalidFile, []byte(`[{"id":"ci"`), 0o600))
+
+	testCases := []struct {
+		desc   string
+		config AuthConfig
+	}{
+		{
+			desc:   "invalid keys file",
+			config: AuthConfig{KeysFile: invalidFile},
+		},
+		{
+			desc:   "static key without secret",
+			config: AuthConfig{Keys: []APIKey{{ID: "ci", Role: auth.Editor}}},
+		},
+		{
+			desc:   "static key without role",
+			config: AuthConfig{Keys: []APIKey{{ID: "ci", Key: "s3cr3t"}}},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := NewAuthenticator(tC.config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestHTTPServerAuth(t *testing.T) {
+	a, err := NewAuthenticator(AuthConfig{
+		Keys: []APIKey{
+			{ID: "planner", Role: auth.Viewer, Key: "viewer-key"},
+			{ID: "ci", Role: auth.Editor, Key: "editor-key"},
+		},
+	})
+	assert.NoError(t, err)
+
+	s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{})})
+	s.WithAuthenticator(a)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := ContextIdentity(r.Context())
+		w.Write([]byte(`{"caller":"` + identity.Subject + `"}`))
+	}
+	s.WithServiceHandler("/public", auth.Public, handler, http.MethodGet)
+	s.WithServiceHandler("/config", auth.Editor, handler, http.MethodOptions, http.MethodPost)
+
+	testCases := []struct {
+		desc         string
+		method       string
+		target       string
+		key          string
+		expectedCode int
+		expectedBody map[string]string
+	}{
+		{
+			desc:         "public route",
+			method:       http.MethodGet,
+			target:       "/public",
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]string{"caller": ""},
+		},
+		{
+			desc:         "missing credentials",
+			method:       http.MethodPost,
+			target:       "/config",
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: map[string]string{"code": "unauthorized", "message": "missing credentials"},
+		},
+		{
+			desc:         "invalid credentials",
+			method:       http.MethodPost,
+			target:       "/config",
+			key:          "guess",
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: map[string]string{"code": "unauthorized", "message": "invalid credentials"},
+		},
+		{
+			desc:         "insufficient role",
+			method:       http.MethodPost,
+			target:       "/config",
+			key:          "viewer-key",
+			expectedCode: http.StatusForbidden,
+			expectedBody: map[string]string{"code": "forbidden", "message": "role editor required"},
+		},
+		{
+			desc:         "allowed role",
+			method:       http.MethodPost,
+			target:       "/config",
+			key:          "editor-key",
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]string{"caller": "ci"},
+		},
+		{
+			desc:         "preflight request",
+			method:       http.MethodOptions,
+			target:       "/config",
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]string{"caller": ""},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tC.method, tC.target, nil)
+			if tC.key != "" {
+				req.Header.Set("X-API-Key", tC.key)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			if tC.expectedCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+			}
+
+			var responseMap map[string]string
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &responseMap))
+			delete(responseMap, "request_id")
+			assert.Equal(t, tC.expectedBody, responseMap)
+		})
+	}
+}
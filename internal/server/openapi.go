@@ -0,0 +1,398 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errBodyTooLarge is returned when a request body exceeds maxBodySize
+var errBodyTooLarge = fmt.Errorf("body too large: maximum %d bytes", maxBodySize)
+
+// openAPI holds the parts of an OpenAPI 3 document used to validate the requests
+type openAPI struct {
+	Paths      map[string]pathItem `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+		Schemas    map[string]*schema   `json:"schemas"`
+	} `json:"components"`
+}
+
+type pathItem struct {
+	Parameters []parameter `json:"parameters"`
+	Get        *operation  `json:"get"`
+	Put        *operation  `json:"put"`
+	Post       *operation  `json:"post"`
+	Delete     *operation  `json:"delete"`
+	Patch      *operation  `json:"patch"`
+}
+
+type operation struct {
+	Parameters  []parameter  `json:"parameters"`
+	RequestBody *requestBody `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+// a schema holds the supported subset of the OpenAPI schema object
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Enum       []any              `json:"enum"`
+	Minimum    *int64             `json:"minimum"`
+	Maximum    *int64             `json:"maximum"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	Items      *schema            `json:"items"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+}
+
+// parseOpenAPI parses an OpenAPI 3 document checking that all its references are defined
+func parseOpenAPI(doc []byte) (*openAPI, error) {
+	var spec openAPI
+	err := json.Unmarshal(doc, &spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, s := range spec.Components.Schemas {
+		err = spec.checkSchema(s)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for method, op := range item.operations() {
+			err = spec.checkOperation(item, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+
+	return &spec, nil
+}
+
+// checkOperation checks that all references used by an operation are defined
+func (o *openAPI) checkOperation(item pathItem, op *operation) error {
+	params, err := o.parameters(item, op)
+	if err != nil {
+		return err
+	}
+
+	for _, param := range params {
+		err = o.checkSchema(param.Schema)
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody != nil {
+		for _, content := range op.RequestBody.Content {
+			err = o.checkSchema(content.Schema)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSchema checks that all references used by a schema are defined
+func (o *openAPI) checkSchema(s *schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		_, err := o.resolve(s)
+		return err
+	}
+
+	err := o.checkSchema(s.Items)
+	if err != nil {
+		return err
+	}
+
+	for _, property := range s.Properties {
+		err = o.checkSchema(property)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// operations returns the operations of a path item by their http method
+func (p pathItem) operations() map[string]*operation {
+	ops := make(map[string]*operation)
+	for method, op := range map[string]*operation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+
+	return ops
+}
+
+// operation returns the operation of a given route path and http method, or nil when it isn't described
+func (o *openAPI) operation(path, method string) *operation {
+	return o.Paths[path].operations()[method]
+}
+
+// parameters returns all parameters of an operation, including the ones shared by its path, with their references resolved
+func (o *openAPI) parameters(item pathItem, op *operation) ([]parameter, error) {
+	var params []parameter
+	for _, param := range append(item.Parameters, op.Parameters...) {
+		if param.Ref != "" {
+			resolved, found := o.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+			if !found {
+				return nil, fmt.Errorf("undefined parameter %s", param.Ref)
+			}
+			param = resolved
+		}
+
+		params = append(params, param)
+	}
+
+	return params, nil
+}
+
+// validateRequest checks the path, query and header parameters and the body of a request against an operation
+// a valid body is restored so that it can still be read by the handler
+func (o *openAPI) validateRequest(r *http.Request, path string, op *operation) error {
+	params, err := o.parameters(o.Paths[path], op)
+	if err != nil {
+		return err
+	}
+
+	for _, param := range params {
+		var (
+			value string
+			found bool
+		)
+		switch param.In {
+		case "path":
+			value, found = mux.Vars(r)[param.Name]
+		case "query":
+			var values []string
+			values, found = r.URL.Query()[param.Name]
+			if found {
+				value = values[0]
+			}
+		case "header":
+			value = r.Header.Get(param.Name)
+			found = value != ""
+		default:
+			continue
+		}
+
+		where := param.In + " parameter " + param.Name
+		if !found {
+			if param.Required {
+				return fmt.Errorf("%s must be specified", where)
+			}
+			continue
+		}
+
+		err = o.validateParameter(param.Schema, value, where)
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	// bodies of the other media types described by the document, such as CSV ones, are left to the handlers
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if _, described := op.RequestBody.Content[mediaType]; described && mediaType != "application/json" {
+		return nil
+	}
+
+	content, found := op.RequestBody.Content["application/json"]
+	if !found {
+		return nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errBodyTooLarge
+	}
+	if err != nil {
+		return errors.New("body could not be read")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("body must be specified")
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body any
+	err = decoder.Decode(&body)
+	if err != nil || decoder.More() {
+		return errors.New("body must be valid json")
+	}
+
+	return o.validateValue(content.Schema, body, "body")
+}
+
+// validateParameter converts a parameter into the type of its schema and validates it
+func (o *openAPI) validateParameter(s *schema, value, where string) error {
+	s, err := o.resolve(s)
+	if err != nil || s == nil {
+		return err
+	}
+
+	switch s.Type {
+	case "integer":
+		return o.validateValue(s, json.Number(value), where)
+	case "boolean":
+		converted, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a boolean", where)
+		}
+		return o.validateValue(s, converted, where)
+	}
+
+	return o.validateValue(s, value, where)
+}
+
+// validateValue validates a decoded json value against a schema
+func (o *openAPI) validateValue(s *schema, value any, where string) error {
+	s, err := o.resolve(s)
+	if err != nil || s == nil {
+		return err
+	}
+
+	switch s.Type {
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", where)
+		}
+		integer, err := strconv.ParseInt(string(number), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer", where)
+		}
+		if s.Minimum != nil && integer < *s.Minimum {
+			return fmt.Errorf("%s must be at least %d", where, *s.Minimum)
+		}
+		if s.Maximum != nil && integer > *s.Maximum {
+			return fmt.Errorf("%s must be at most %d", where, *s.Maximum)
+		}
+
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", where)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", where)
+		}
+
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", where)
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			return fmt.Errorf("%s must have at least %d items", where, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return fmt.Errorf("%s must have at most %d items", where, *s.MaxItems)
+		}
+		for i, item := range items {
+			err = o.validateValue(s.Items, item, fmt.Sprintf("%s[%d]", where, i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", where)
+		}
+		for _, name := range s.Required {
+			if _, found := object[name]; !found {
+				return fmt.Errorf("%s.%s must be specified", where, name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(s.Properties)) {
+			propertyValue, found := object[name]
+			if !found {
+				continue
+			}
+			err = o.validateValue(s.Properties[name], propertyValue, where+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %v", where, s.Enum)
+	}
+
+	return nil
+}
+
+// resolve returns the schema a reference points to, or the schema itself when it isn't a reference
+func (o *openAPI) resolve(s *schema) (*schema, error) {
+	if s == nil || s.Ref == "" {
+		return s, nil
+	}
+
+	resolved, found := o.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	if !found {
+		return nil, fmt.Errorf("undefined schema %s", s.Ref)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/stretchr/testify/assert"
+)
+
+const testOpenAPI = `{
+	"openapi": "3.0.3",
+	"paths": {
+		"/item/{id}": {
+			"parameters": [{"$ref": "#/components/parameters/ID"}],
+			"get": {
+				"parameters": [
+					{"name": "qty", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1, "maximum": 100}},
+					{"name": "mode", "in": "query", "schema": {"type": "string", "enum": ["fast", "slow"]}}
+				]
+			},
+			"post": {
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {"schema": {"$ref": "#/components/schemas/Item"}},
+						"text/csv": {"schema": {"type": "string"}}
+					}
+				}
+			}
+		}
+	},
+	"components": {
+		"parameters": {
+			"ID": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}}
+		},
+		"schemas": {
+			"Item": {
+				"type": "object",
+				"required": ["sizes"],
+				"properties": {
+					"sizes": {"type": "array", "minItems": 1, "items": {"type": "integer", "minimum": 1}},
+					"label": {"type": "string"}
+				}
+			}
+		}
+	}
+}`
+
+func TestOpenAPIValidation(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		method          string
+		target          string
+		contentType     string
+		body            string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			desc:           "valid query",
+			method:         http.MethodGet,
+			target:         "/item/1?qty=5&mode=fast",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:            "invalid path parameter",
+			method:          http.MethodGet,
+			target:          "/item/abc?qty=5",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "path parameter id must be an integer",
+		},
+		{
+			desc:            "missing required query parameter",
+			method:          http.MethodGet,
+			target:          "/item/1",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "query parameter qty must be specified",
+		},
+		{
+			desc:            "query parameter above maximum",
+			method:          http.MethodGet,
+			target:          "/item/1?qty=101",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "query parameter qty must be at most 100",
+		},
+		{
+			desc:            "query parameter not in enum",
+			method:          http.MethodGet,
+			target:          "/item/1?qty=5&mode=medium",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "query parameter mode must be one of [fast slow]",
+		},
+		{
+			desc:           "valid body",
+			method:         http.MethodPost,
+			target:         "/item/1",
+			body:           `{"sizes":[5,10],"label":"box"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "body of another described media type",
+			method:         http.MethodPost,
+			target:         "/item/1",
+			contentType:    "text/csv; charset=utf-8",
+			body:           "sizes\n5\n",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:            "body of a media type not described",
+			method:          http.MethodPost,
+			target:          "/item/1",
+			contentType:     "text/plain",
+			body:            "sizes\n5\n",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "body must be valid json",
+		},
+		{
+			desc:            "missing body",
+			method:          http.MethodPost,
+			target:          "/item/1",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "body must be specified",
+		},
+		{
+			desc:            "malformed body",
+			method:          http.MethodPost,
+			target:          "/item/1",
+			body:            `{"sizes":[5,`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "body must be valid json",
+		},
+		{
+			desc:            "missing required property",
+			method:          http.MethodPost,
+			target:          "/item/1",
+			body:            `{"label":"box"}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "body.sizes must be specified",
+		},
+		{
+			desc:            "invalid array item",
+			method:          http.MethodPost,
+			target:          "/item/1",
+			body:            `{"sizes":[5,0]}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "body.sizes[1] must be at least 1",
+		},
+		{
+			desc:            "invalid property type",
+			method:          http.MethodPost,
+			target:          "/item/1",
+			body:            `{"sizes":[5],"label":3}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "body.label must be a string",
+		},
+		{
+			desc:           "method not described",
+			method:         http.MethodOptions,
+			target:         "/item/abc",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{})})
+	assert.NoError(t, s.WithOpenAPI([]byte(testOpenAPI)))
+	s.WithServiceHandler("/item/{id}", auth.Public, func(w http.ResponseWriter, r *http.Request) {
+		// the validated body is still available to the handler
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		w.Write(body)
+	}, http.MethodOptions, http.MethodGet, http.MethodPost)
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tC.method, tC.target, strings.NewReader(tC.body))
+			if tC.contentType != "" {
+				req.Header.Set("Content-Type", tC.contentType)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tC.expectedStatus, rec.Code)
+			if tC.expectedStatus == http.StatusOK {
+				assert.Equal(t, tC.body, rec.Body.String())
+				return
+			}
+
+			var responseMap map[string]string
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &responseMap))
+			assert.Equal(t, "invalid_request", responseMap["code"])
+			assert.Equal(t, tC.expectedMessage, responseMap["message"])
+			assert.Equal(t, rec.Header().Get(RequestIDHeader), responseMap["request_id"])
+		})
+	}
+}
+
+func TestOpenAPIValidationBodyTooLarge(t *testing.T) {
+	s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{})})
+	assert.NoError(t, s.WithOpenAPI([]byte(testOpenAPI)))
+	s.WithServiceHandler("/item/{id}", auth.Public, func(w http.ResponseWriter, r *http.Request) {}, http.MethodPost)
+
+	body := `{"sizes":[` + strings.Repeat("5,", maxBodySize/2) + `5]}`
+	req := httptest.NewRequest(http.MethodPost, "/item/1", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	var responseMap map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &responseMap))
+	assert.Equal(t, "body_too_large", responseMap["code"])
+	assert.Equal(t, "body too large: maximum 8388608 bytes", responseMap["message"])
+}
+
+func TestWithOpenAPI(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		doc         string
+		expectedErr bool
+	}{
+		{
+			desc: "valid document",
+			doc:  testOpenAPI,
+		},
+		{
+			desc:        "invalid json",
+			doc:         `{"paths":`,
+			expectedErr: true,
+		},
+		{
+			desc:        "undefined schema",
+			doc:         `{"paths":{"/item":{"post":{"requestBody":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/Item"}}}}}}}}`,
+			expectedErr: true,
+		},
+		{
+			desc:        "undefined parameter",
+			doc:         `{"paths":{"/item":{"get":{"parameters":[{"$ref":"#/components/parameters/ID"}]}}}}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{})})
+			err := s.WithOpenAPI([]byte(tC.doc))
+			if tC.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, tC.doc, rec.Body.String())
+		})
+	}
+}
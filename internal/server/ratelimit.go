@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/ratelimit"
+)
+
+// WithRateLimit method limits the requests rate of each client to the service routes
+// clients with valid credentials are identified by them, and the other ones by their ip address
+func (s *HTTPServer) WithRateLimit(buckets *ratelimit.Buckets) {
+	s.limits = buckets
+}
+
+func (s *HTTPServer) wrapRateLimit(handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limits == nil || r.Method == http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		client := s.clientID(r)
+		allowed, wait := s.limits.Allow(client)
+		if !allowed {
+			retryAfter := ratelimit.RetryAfter(wait)
+			instrumentation.ContextLogger(r.Context()).Warning("Rate limit exceeded", "client", client, "retry_after_s", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, r, http.StatusTooManyRequests, "rate_limited", "rate limit exceeded")
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// clientID identifies the client of a request for rate limiting purposes
+// the rate limit applies before the authentication, so requests without valid credentials are identified by their ip address
+func (s *HTTPServer) clientID(r *http.Request) string {
+	if s.auth != nil {
+		identity, err := s.auth.Authenticate(r)
+		if err == nil {
+			return "caller:" + identity.Subject
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPServerRateLimit(t *testing.T) {
+	a, err := NewAuthenticator(AuthConfig{
+		Keys: []APIKey{{ID: "ci", Role: auth.Viewer, Key: "viewer-key"}},
+	})
+	assert.NoError(t, err)
+
+	s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{})})
+	s.WithAuthenticator(a)
+	s.WithRateLimit(ratelimit.NewBuckets(0.5, 2))
+	s.WithServiceHandler("/public", auth.Public, func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet)
+	s.WithServiceHandler("/private", auth.Viewer, func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet)
+
+	serve := func(target, remoteAddr, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// unauthenticated clients are limited by ip address
+	assert.Equal(t, http.StatusOK, serve("/public", "10.0.0.1:5000", "").Code)
+	assert.Equal(t, http.StatusOK, serve("/public", "10.0.0.1:5001", "").Code)
+
+	rec := serve("/public", "10.0.0.1:5002", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	var responseMap map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &responseMap))
+	assert.Equal(t, "rate_limited", responseMap["code"])
+
+	assert.Equal(t, http.StatusOK, serve("/public", "10.0.0.2:5000", "").Code)
+
+	// authenticated clients are limited by their credentials, whatever their address
+	assert.Equal(t, http.StatusOK, serve("/private", "10.0.0.1:5003", "viewer-key").Code)
+	assert.Equal(t, http.StatusOK, serve("/private", "10.0.0.3:5000", "viewer-key").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/private", "10.0.0.4:5000", "viewer-key").Code)
+
+	// invalid credentials are limited by ip address before being rejected
+	assert.Equal(t, http.StatusUnauthorized, serve("/private", "10.0.0.5:5000", "wrong-key").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("/private", "10.0.0.5:5001", "wrong-key").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/private", "10.0.0.5:5002", "wrong-key").Code)
+}
@@ -2,25 +2,58 @@
 package server
 
 import (
+	"cmp"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
 	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/ftfmtavares/shipping-optimizer/internal/ratelimit"
 	"github.com/gorilla/mux"
 )
 
+// RequestIDHeader carries the identifier of each request, either given by the caller or generated by the server
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request identifier accepted from callers
+const maxRequestIDLength = 128
+
+// maxBodySize is the largest request body accepted by the routes described by the OpenAPI document, in bytes
+const maxBodySize = 8 << 20
+
 // HTTPServer holds the web server
 type HTTPServer struct {
-	server *http.Server
-	router *mux.Router
-	logger instrumentation.Logger
+	server          *http.Server
+	shutdownTimeout time.Duration
+	reload          func()
+	router          *mux.Router
+	logger          instrumentation.Logger
+	spec            *openAPI
+	routes          []Route
+	auth            *Authenticator
+	limits          *ratelimit.Buckets
+
+	metrics          *instrumentation.Metrics
+	requestsTotal    instrumentation.Counter
+	requestsDuration instrumentation.Histogram
+}
+
+// Route holds a path registered as a service, the role required to call it and its http methods
+type Route struct {
+	Path    string
+	Role    auth.Role
+	Methods []string
 }
 
 // HTTPServerConfig wraps all required configuration to initialize a new HTTPServer
@@ -30,12 +63,24 @@ type HTTPServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
-	Logger       instrumentation.Logger
+	// ShutdownTimeout is how long stopping waits for the requests being served, 10 seconds when missing
+	ShutdownTimeout time.Duration
+	Logger          instrumentation.Logger
+	Metrics         *instrumentation.Metrics
 }
 
+// defaultShutdownTimeout is how long stopping waits for the requests being served when not configured
+const defaultShutdownTimeout = 10 * time.Second
+
 // NewHTTPServer returns an initialized HTTPServer
+// the requests metrics are registered in the given Metrics, or in new ones when missing
 func NewHTTPServer(sc HTTPServerConfig) HTTPServer {
 	router := mux.NewRouter()
+	metrics := sc.Metrics
+	if metrics == nil {
+		metrics = instrumentation.NewMetrics()
+	}
+
 	return HTTPServer{
 		server: &http.Server{
 			Addr:         sc.Address + ":" + strconv.Itoa(sc.Port),
@@ -44,11 +89,26 @@ func NewHTTPServer(sc HTTPServerConfig) HTTPServer {
 			WriteTimeout: sc.WriteTimeout,
 			IdleTimeout:  sc.IdleTimeout,
 		},
-		router: router,
-		logger: sc.Logger,
+		shutdownTimeout: cmp.Or(sc.ShutdownTimeout, defaultShutdownTimeout),
+		router:          router,
+		logger:          sc.Logger,
+
+		metrics:          metrics,
+		requestsTotal:    metrics.NewCounter("http_requests_total", "Number of served requests.", "route", "method", "status"),
+		requestsDuration: metrics.NewHistogram("http_request_duration_seconds", "Duration of the served requests.", instrumentation.DurationBuckets, "route", "method", "status"),
 	}
 }
 
+// Metrics method returns the metrics exposed by the server, so that other metrics can be registered in them
+func (s *HTTPServer) Metrics() *instrumentation.Metrics {
+	return s.metrics
+}
+
+// WithMetrics method adds a predefined route exposing the metrics in the Prometheus text format
+func (s *HTTPServer) WithMetrics() {
+	s.router.HandleFunc("/metrics", s.metrics.Handler()).Methods(http.MethodGet)
+}
+
 // WithHealthCheck method adds a predefined route and response for health requests
 func (s *HTTPServer) WithHealthCheck() {
 	healthHandler := func(w http.ResponseWriter, r *http.Request) {
@@ -64,15 +124,49 @@ func (s *HTTPServer) WithHealthCheck() {
 	s.router.HandleFunc("/health", healthHandler).Methods("GET")
 }
 
-// WithServiceHandler method adds a given route to a response handler
-func (s *HTTPServer) WithServiceHandler(path string, handler http.HandlerFunc, methods ...string) {
+// WithOpenAPI method serves a given OpenAPI 3 document at /openapi.json
+// requests to the service routes it describes are validated against it and rejected when not conforming
+func (s *HTTPServer) WithOpenAPI(doc []byte) error {
+	spec, err := parseOpenAPI(doc)
+	if err != nil {
+		return fmt.Errorf("parsing openapi document: %w", err)
+	}
+	s.spec = spec
+
+	s.router.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}).Methods(http.MethodGet)
+
+	return nil
+}
+
+// WithAuthenticator method requires the callers of the service routes to be identified by a given Authenticator
+func (s *HTTPServer) WithAuthenticator(a *Authenticator) {
+	s.auth = a
+}
+
+// WithServiceHandler method adds a given route to a response handler, requiring callers to have a given role
+func (s *HTTPServer) WithServiceHandler(path string, role auth.Role, handler http.HandlerFunc, methods ...string) {
+	s.routes = append(s.routes, Route{Path: path, Role: role, Methods: methods})
+
+	handler = s.wrapValidation(path, handler)
+	handler = s.wrapAuth(role, handler)
+	handler = s.wrapRateLimit(handler)
 	handler = s.wrapPanicRecovery(handler)
 	handler = s.wrapJsonContentType(handler)
-	handler = s.wrapLogging(handler)
+	handler = s.wrapMetrics(path, handler)
+	handler = s.wrapLogging(path, handler)
+	handler = s.wrapRequestID(handler)
 
 	s.router.HandleFunc(path, handler).Methods(methods...)
 }
 
+// Routes method returns all routes registered as services
+func (s *HTTPServer) Routes() []Route {
+	return slices.Clone(s.routes)
+}
+
 // WithStatic method adds a given route to a folder with static web contents
 func (s *HTTPServer) WithStatic(urlPath, assetPath string) {
 	s.router.PathPrefix(urlPath).Handler(http.FileServer(http.Dir(assetPath)))
@@ -80,43 +174,152 @@ func (s *HTTPServer) WithStatic(urlPath, assetPath string) {
 
 // StartHTTPServerAsync method starts the web server asynchronously
 func (s *HTTPServer) StartHTTPServerAsync() {
-	s.logger.Info("starting api on " + s.server.Addr)
+	s.logger.Info("Starting api", "address", s.server.Addr)
 
 	go func() {
 		err := s.server.ListenAndServe()
 		if err != nil && err != http.ErrServerClosed {
-			s.logger.Error("Failed to start server")
+			s.logger.Error("Failed to start server", "error", err)
 		}
 	}()
 }
 
-// WithShutdownGracefully method stops the server when the aplication terminates
+// WithReload method calls a given function whenever the process is asked to reload, through SIGHUP, instead of stopping
+func (s *HTTPServer) WithReload(reload func()) {
+	s.reload = reload
+}
+
+// WithShutdownGracefully method stops the server when the aplication terminates, reloading it meanwhile when asked to
 func (s *HTTPServer) WithShutdownGracefully() {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	s.awaitStop(signals)
 
 	s.logger.Info("Stopping server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 
 	err := s.server.Shutdown(ctx)
 	if err != nil {
-		s.logger.Error("Server shutdown failed")
+		s.logger.Error("Server shutdown failed", "error", err)
 	}
 
 	s.logger.Info("Server stopped gracefully")
 }
 
-func (s *HTTPServer) wrapLogging(handler http.HandlerFunc) http.HandlerFunc {
+// awaitStop waits for a signal stopping the server, reloading it on every SIGHUP received before
+func (s *HTTPServer) awaitStop(signals <-chan os.Signal) {
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			return
+		}
+
+		if s.reload == nil {
+			s.logger.Warning("Reload requested but not supported, ignoring it")
+			continue
+		}
+		s.logger.Info("Reload requested")
+		s.reload()
+	}
+}
+
+func (s *HTTPServer) wrapRequestID(handler http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		s.logger.Info(r.RemoteAddr + r.Method + r.URL.String())
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
 
-		handler.ServeHTTP(w, r)
+		handler.ServeHTTP(w, r.WithContext(instrumentation.WithRequestID(r.Context(), id)))
 	})
 }
 
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// wrapLogging logs every served request and gives the handler a logger carrying the request fields
+func (s *HTTPServer) wrapLogging(path string, handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger := s.logger.With(
+			"request_id", instrumentation.RequestID(r.Context()),
+			"route", path,
+			"method", r.Method,
+		)
+		if pid, found := mux.Vars(r)["pid"]; found {
+			logger = logger.With("pid", pid)
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handler.ServeHTTP(recorder, r.WithContext(instrumentation.WithLogger(r.Context(), logger)))
+
+		log := logger.Info
+		if recorder.status >= http.StatusInternalServerError {
+			log = logger.Error
+		}
+		log("Request served",
+			"url", r.URL.String(),
+			"remote_addr", r.RemoteAddr,
+			"status", recorder.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"bytes", recorder.bytes,
+		)
+	})
+}
+
+func (s *HTTPServer) wrapMetrics(path string, handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handler.ServeHTTP(recorder, r)
+
+		status := strconv.Itoa(recorder.status)
+		s.requestsTotal.Add(1, path, r.Method, status)
+		s.requestsDuration.Observe(time.Since(start).Seconds(), path, r.Method, status)
+	})
+}
+
+// statusRecorder keeps the status code and the amount of bytes written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	wrote  bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status = status
+		r.wrote = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wrote = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap method gives access to the original response writer, as used by http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func (s *HTTPServer) wrapJsonContentType(handler http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -130,11 +333,45 @@ func (s *HTTPServer) wrapPanicRecovery(handler http.HandlerFunc) http.HandlerFun
 		defer func() {
 			err := recover()
 			if err != nil {
-				s.logger.Error(fmt.Sprintf("panic recovered: %v", err))
-				w.WriteHeader(http.StatusInternalServerError)
+				instrumentation.ContextLogger(r.Context()).Error("Panic recovered", "panic", fmt.Sprint(err))
+				writeError(w, r, http.StatusInternalServerError, "internal_error", "internal error")
 			}
 		}()
 
 		handler.ServeHTTP(w, r)
 	})
 }
+
+func (s *HTTPServer) wrapValidation(path string, handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// routes and methods not described by the document, such as preflight requests, are not validated
+		if s.spec != nil {
+			op := s.spec.operation(path, r.Method)
+			if op != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+				err := s.spec.validateRequest(r, path, op)
+				if errors.Is(err, errBodyTooLarge) {
+					writeError(w, r, http.StatusRequestEntityTooLarge, "body_too_large", err.Error())
+					return
+				}
+				if err != nil {
+					writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+					return
+				}
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// writeError writes a structured error response carrying the request identifier
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"code":       code,
+		"message":    message,
+		"request_id": instrumentation.RequestID(r.Context()),
+	})
+}
@@ -1,14 +1,21 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/auth"
 	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,7 +28,7 @@ func testRequest(t *testing.T, method, target string, body io.Reader) *http.Requ
 }
 
 func TestHTTPServer(t *testing.T) {
-	logger := instrumentation.NewLogger()
+	logger := instrumentation.NewLogger(instrumentation.LoggerConfig{})
 
 	testCases := []struct {
 		desc                string
@@ -59,7 +66,7 @@ func TestHTTPServer(t *testing.T) {
 		{
 			desc: "routed service",
 			serverConfiguration: func(server *HTTPServer) {
-				server.WithServiceHandler("/test", func(w http.ResponseWriter, r *http.Request) {
+				server.WithServiceHandler("/test", auth.Public, func(w http.ResponseWriter, r *http.Request) {
 					w.WriteHeader(http.StatusAccepted)
 					w.Write([]byte(`{"ok":"true"}`))
 				}, http.MethodGet)
@@ -98,7 +105,7 @@ func TestHTTPServer(t *testing.T) {
 		{
 			desc: "service panic",
 			serverConfiguration: func(server *HTTPServer) {
-				server.WithServiceHandler("/test", func(w http.ResponseWriter, r *http.Request) {
+				server.WithServiceHandler("/test", auth.Public, func(w http.ResponseWriter, r *http.Request) {
 					panic("something bad")
 				}, http.MethodGet)
 			},
@@ -107,6 +114,53 @@ func TestHTTPServer(t *testing.T) {
 				assert.Equal(tt, http.StatusInternalServerError, res.StatusCode)
 
 				assert.Equal(tt, "application/json", res.Header.Get("Content-Type"))
+
+				body, err := io.ReadAll(res.Body)
+				assert.NoError(tt, err)
+
+				var responseMap map[string]string
+				err = json.Unmarshal(body, &responseMap)
+				assert.NoError(tt, err)
+				assert.Equal(tt, "internal_error", responseMap["code"])
+				assert.Equal(tt, res.Header.Get("X-Request-ID"), responseMap["request_id"])
+			},
+		},
+		{
+			desc: "generated request id",
+			serverConfiguration: func(server *HTTPServer) {
+				server.WithServiceHandler("/test", auth.Public, func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"id":"` + instrumentation.RequestID(r.Context()) + `"}`))
+				}, http.MethodGet)
+			},
+			request: testRequest(t, http.MethodGet, "http://localhost:8000/test", nil),
+			expectedResponse: func(tt assert.TestingT, res *http.Response) {
+				assert.Equal(tt, http.StatusOK, res.StatusCode)
+				assert.Regexp(tt, "^[0-9a-f]{16}$", res.Header.Get("X-Request-ID"))
+
+				body, err := io.ReadAll(res.Body)
+				assert.NoError(tt, err)
+				assert.Equal(tt, `{"id":"`+res.Header.Get("X-Request-ID")+`"}`, string(body))
+			},
+		},
+		{
+			desc: "caller request id",
+			serverConfiguration: func(server *HTTPServer) {
+				server.WithServiceHandler("/test", auth.Public, func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"id":"` + instrumentation.RequestID(r.Context()) + `"}`))
+				}, http.MethodGet)
+			},
+			request: func() *http.Request {
+				req := testRequest(t, http.MethodGet, "http://localhost:8000/test", nil)
+				req.Header.Set("X-Request-ID", "caller-id")
+				return req
+			}(),
+			expectedResponse: func(tt assert.TestingT, res *http.Response) {
+				assert.Equal(tt, http.StatusOK, res.StatusCode)
+				assert.Equal(tt, "caller-id", res.Header.Get("X-Request-ID"))
+
+				body, err := io.ReadAll(res.Body)
+				assert.NoError(tt, err)
+				assert.Equal(tt, `{"id":"caller-id"}`, string(body))
 			},
 		},
 	}
@@ -142,3 +196,104 @@ func TestHTTPServer(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPServerMetrics(t *testing.T) {
+	s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{})})
+	s.WithMetrics()
+	s.WithServiceHandler("/item/{id}", auth.Public, func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "0" {
+			panic("something bad")
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}, http.MethodGet)
+
+	for _, target := range []string{"/item/1", "/item/2", "/item/0"} {
+		s.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "http_requests_total{route=\"/item/{id}\",method=\"GET\",status=\"202\"} 2\n")
+	assert.Contains(t, body, "http_requests_total{route=\"/item/{id}\",method=\"GET\",status=\"500\"} 1\n")
+	assert.Contains(t, body, "http_request_duration_seconds_count{route=\"/item/{id}\",method=\"GET\",status=\"202\"} 2\n")
+	assert.Contains(t, body, "# TYPE go_goroutines gauge\n")
+}
+
+func TestHTTPServerLogging(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewHTTPServer(HTTPServerConfig{
+		Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{Format: instrumentation.JSONFormat, Output: &buf}),
+	})
+	s.WithServiceHandler("/product/{pid}/test", auth.Public, func(w http.ResponseWriter, r *http.Request) {
+		instrumentation.ContextLogger(r.Context()).Info("Handling request")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"ok":"true"}`))
+	}, http.MethodGet)
+
+	req := httptest.NewRequest(http.MethodGet, "/product/4/test?order=250", nil)
+	req.Header.Set("X-Request-ID", "caller-id")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var handled, served map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &handled))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &served))
+
+	assert.Equal(t, "Handling request", handled["msg"])
+	assert.Equal(t, "caller-id", handled["request_id"])
+	assert.Equal(t, "4", handled["pid"])
+
+	assert.Equal(t, "Request served", served["msg"])
+	assert.Equal(t, "INFO", served["level"])
+	assert.Equal(t, "caller-id", served["request_id"])
+	assert.Equal(t, "/product/{pid}/test", served["route"])
+	assert.Equal(t, "GET", served["method"])
+	assert.Equal(t, "4", served["pid"])
+	assert.Equal(t, "/product/4/test?order=250", served["url"])
+	assert.Equal(t, float64(http.StatusAccepted), served["status"])
+	assert.Equal(t, float64(13), served["bytes"])
+	assert.Contains(t, served, "duration_ms")
+}
+
+func TestHTTPServerAwaitStop(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		withReload      bool
+		signals         []os.Signal
+		expectedReloads int
+	}{
+		{
+			desc:            "reloads before stopping",
+			withReload:      true,
+			signals:         []os.Signal{syscall.SIGHUP, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGHUP},
+			expectedReloads: 2,
+		},
+		{
+			desc:    "reload not supported",
+			signals: []os.Signal{syscall.SIGHUP, os.Interrupt},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewHTTPServer(HTTPServerConfig{Logger: instrumentation.NewLogger(instrumentation.LoggerConfig{Output: io.Discard})})
+			reloads := 0
+			if tC.withReload {
+				s.WithReload(func() { reloads++ })
+			}
+
+			signals := make(chan os.Signal, len(tC.signals))
+			for _, sig := range tC.signals {
+				signals <- sig
+			}
+			s.awaitStop(signals)
+
+			assert.Equal(t, tC.expectedReloads, reloads)
+		})
+	}
+}
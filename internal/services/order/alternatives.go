@@ -0,0 +1,290 @@
+package order
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+)
+
+// an alternative is a link of a packages combination chain
+// cost, packsCount and total accumulate the whole chain, while packSize is the size added by this link
+// prev points to the remaining chain so that every alternative can be back tracked independently
+type alternative struct {
+	cost       int
+	packsCount int
+	total      int
+	packSize   int
+	prev       *alternative
+}
+
+// packCounts goes through an alternative chain counting the number of each package size
+func (a *alternative) packCounts() map[int]int {
+	packCountsMap := make(map[int]int)
+	for link := a; link != nil; link = link.prev {
+		if link.packSize > 0 {
+			packCountsMap[link.packSize]++
+		}
+	}
+
+	return packCountsMap
+}
+
+// maxAlternativesSearch is the highest amount of alternatives searched for plans served by the available stock
+const maxAlternativesSearch = 256
+
+// rankedPlans returns up to k distinct plans, starting with best and followed by the best alternatives
+// when the stock is tracked only the alternatives it serves are kept, searching through a growing amount of them
+func rankedPlans(ctx context.Context, options []packOption, qty, maxExcess, k int, best plan, levels map[int]int, tracked bool) ([]plan, error) {
+	for search := k; ; search *= 2 {
+		alternatives, err := optimizeAlternatives(ctx, options, qty, maxExcess, search)
+		if err != nil {
+			return nil, err
+		}
+
+		plans := []plan{best}
+		for _, p := range alternatives {
+			if len(plans) == k {
+				break
+			}
+			if slices.Equal(p.packs, best.packs) || tracked && !withinStock(p.packs, levels) {
+				continue
+			}
+
+			plans = append(plans, p)
+		}
+
+		if len(plans) == k || !tracked || search >= maxAlternativesSearch {
+			return plans, nil
+		}
+	}
+}
+
+// optimizeAlternatives finds the k best distinct combinations whose totals serve qty without exceeding it by more than maxExcess
+// combinations are ranked by cost, then by total and then by amount of packages
+// options must be sorted in ascending order of size
+func optimizeAlternatives(ctx context.Context, options []packOption, qty, maxExcess, k int) ([]plan, error) {
+	limit := qty + maxExcess + 1
+
+	// small orders are solved directly through the checkpoints
+	// larger ones are reduced to the best residue chains and filled with the most efficient package
+	fill := fillOption(options)
+	var res [][]*alternative
+	direct := qty < fill.size
+	if !direct {
+		var (
+			bound int
+			err   error
+		)
+		res, bound, err = residueAlternatives(ctx, options, fill, k)
+		if err != nil {
+			return nil, err
+		}
+		direct = qty < bound
+	}
+
+	var candidates []plan
+	if direct {
+		cps, err := checkpointAlternatives(ctx, options, limit, k)
+		if err != nil {
+			return nil, err
+		}
+		for t := qty; t < limit; t++ {
+			for _, a := range cps[t] {
+				candidates = append(candidates, plan{
+					packs:      packsCombination(options, a.packCounts()),
+					total:      t,
+					packsCount: a.packsCount,
+					cost:       a.cost,
+				})
+			}
+		}
+	} else {
+		// above the bound every chain of a residue serves any total in its class
+		for t := qty; t < limit; t++ {
+			for _, a := range res[t%fill.size] {
+				n := (t - a.total) / fill.size
+				packCountsMap := a.packCounts()
+				packCountsMap[fill.size] += n
+
+				candidates = append(candidates, plan{
+					packs:      packsCombination(options, packCountsMap),
+					total:      t,
+					packsCount: a.packsCount + n,
+					cost:       a.cost + n*fill.cost,
+				})
+			}
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b plan) int {
+		if a.cost != b.cost {
+			return a.cost - b.cost
+		}
+		if a.total != b.total {
+			return a.total - b.total
+		}
+		return a.packsCount - b.packsCount
+	})
+
+	return candidates[:min(k, len(candidates))], nil
+}
+
+// checkpointAlternatives calculates the k best packages combinations for every total below limit
+// package sizes are added one at a time so that every combination is reached through a single chain
+func checkpointAlternatives(ctx context.Context, options []packOption, limit, k int) ([][]*alternative, error) {
+	cps := make([][]*alternative, limit)
+	cps[0] = []*alternative{{}}
+
+	for _, option := range options {
+		for t := option.size; t < limit; t++ {
+			err := checkCanceled(ctx, t)
+			if err != nil {
+				return nil, err
+			}
+
+			prev := cps[t-option.size]
+			if len(prev) == 0 {
+				continue
+			}
+
+			extended := make([]*alternative, len(prev))
+			for i, a := range prev {
+				extended[i] = &alternative{
+					cost:       a.cost + option.cost,
+					packsCount: a.packsCount + 1,
+					total:      t,
+					packSize:   option.size,
+					prev:       a,
+				}
+			}
+
+			cps[t] = mergeAlternatives(cps[t], extended, k)
+		}
+	}
+
+	return cps, nil
+}
+
+// mergeAlternatives merges two sorted alternatives lists keeping the k best ones
+func mergeAlternatives(a, b []*alternative, k int) []*alternative {
+	merged := make([]*alternative, 0, min(k, len(a)+len(b)))
+	for len(merged) < k && (len(a) > 0 || len(b) > 0) {
+		if len(b) == 0 || len(a) > 0 && !b[0].better(a[0]) {
+			merged = append(merged, a[0])
+			a = a[1:]
+			continue
+		}
+
+		merged = append(merged, b[0])
+		b = b[1:]
+	}
+
+	return merged
+}
+
+func (a *alternative) better(other *alternative) bool {
+	if a.cost != other.cost {
+		return a.cost < other.cost
+	}
+	return a.packsCount < other.packsCount
+}
+
+// residueAlternatives calculates the k best chains of packages other than the fill one for every residue modulo the fill package
+// chains are ranked as in shortestResidues, by how far they are from the fill package in cost and count per unit
+// it also returns the bound above which every chain is valid for any total in its residue class
+func residueAlternatives(ctx context.Context, options []packOption, fill packOption, k int) ([][]*alternative, int, error) {
+	steps := make([]packOption, 0, len(options)-1)
+	for _, option := range options {
+		if option.size != fill.size {
+			steps = append(steps, option)
+		}
+	}
+
+	// the residues graph has one layer per package size so that every combination is reached through a single chain
+	// each node is settled up to k times, by the k best chains reaching it
+	settled := make([][]int, len(steps)+1)
+	for i := range settled {
+		settled[i] = make([]int, fill.size)
+	}
+
+	res := make([][]*alternative, fill.size)
+	queue := &alternativeQueue{fill: fill}
+	heap.Push(queue, layeredAlternative{alternative: &alternative{}})
+	for step := 0; queue.Len() > 0; step++ {
+		err := checkCanceled(ctx, step)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		item := heap.Pop(queue).(layeredAlternative)
+		residue := item.total % fill.size
+		if settled[item.layer][residue] == k {
+			continue
+		}
+		settled[item.layer][residue]++
+
+		if item.layer == len(steps) {
+			res[residue] = append(res[residue], item.alternative)
+			continue
+		}
+
+		step := steps[item.layer]
+		heap.Push(queue, layeredAlternative{
+			alternative: &alternative{
+				cost:       item.cost + step.cost,
+				packsCount: item.packsCount + 1,
+				total:      item.total + step.size,
+				packSize:   step.size,
+				prev:       item.alternative,
+			},
+			layer: item.layer,
+		})
+		heap.Push(queue, layeredAlternative{
+			alternative: item.alternative,
+			layer:       item.layer + 1,
+		})
+	}
+
+	var bound int
+	for _, chains := range res {
+		for _, a := range chains {
+			bound = max(bound, a.total)
+		}
+	}
+
+	return res, bound, nil
+}
+
+type layeredAlternative struct {
+	*alternative
+	layer int
+}
+
+// alternativeQueue implements heap.Interface ordering the residue chains to be visited
+type alternativeQueue struct {
+	items []layeredAlternative
+	fill  packOption
+}
+
+func (q *alternativeQueue) Len() int      { return len(q.items) }
+func (q *alternativeQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *alternativeQueue) Push(x any)    { q.items = append(q.items, x.(layeredAlternative)) }
+func (q *alternativeQueue) Pop() any {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
+
+func (q *alternativeQueue) Less(i, j int) bool {
+	return q.node(q.items[i]).less(q.node(q.items[j]))
+}
+
+// node converts a chain into its residue node weights
+func (q *alternativeQueue) node(a layeredAlternative) residueNode {
+	return residueNode{
+		reached:     true,
+		costWeight:  q.fill.size*a.cost - a.total*q.fill.cost,
+		countWeight: q.fill.size*a.packsCount - a.total,
+		total:       a.total,
+	}
+}
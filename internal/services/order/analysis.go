@@ -0,0 +1,176 @@
+package order
+
+import (
+	"context"
+	"slices"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// Analyze method analyzes which order quantities a given package sizes version of a product ships exactly
+// the latest version is analyzed when no version is given
+func (o Optimizer) Analyze(ctx context.Context, pid, version int) (order.Analysis, error) {
+	prd, err := o.productVersion(pid, version)
+	if err != nil {
+		return order.Analysis{}, err
+	}
+
+	if len(prd.Packs) == 0 {
+		return order.Analysis{}, product.ErrNoPackSizes
+	}
+
+	options := packOptions(prd.Packs, nil, false)
+	sizes := make([]int, len(options))
+	gcd := 0
+	for i, option := range options {
+		sizes[i] = option.size
+		gcd = greatestCommonDivisor(gcd, option.size)
+	}
+	smallest := sizes[0]
+
+	release, err := acquire(o.limiter, analysisWeight(sizes))
+	if err != nil {
+		instrumentation.ContextLogger(ctx).Warning("Analysis rejected", "pid", pid, "version", prd.Version, "error", err)
+		return order.Analysis{}, err
+	}
+	defer release()
+
+	res, err := minimalTotals(ctx, sizes)
+	if err != nil {
+		return order.Analysis{}, err
+	}
+
+	analysis := order.Analysis{
+		PID:       pid,
+		Version:   prd.Version,
+		Sizes:     sizes,
+		GCD:       gcd,
+		Redundant: []int{},
+	}
+
+	// every residue is reached when the sizes are coprime, each one missing the quantities below its minimal total
+	if gcd == 1 {
+		var unreachable int
+		for r, node := range res.nodes {
+			unreachable += (node.total - r) / smallest
+		}
+		analysis.Unreachable = &unreachable
+
+		frobenius := res.bound - smallest
+		if frobenius > 0 {
+			analysis.Frobenius = &frobenius
+		}
+	}
+
+	// a size is redundant when its residue is reached by the other sizes with a total not above it
+	for i, size := range sizes {
+		others := slices.Delete(slices.Clone(sizes), i, i+1)
+		if len(others) == 0 {
+			continue
+		}
+
+		othersRes, err := minimalTotals(ctx, others)
+		if err != nil {
+			return order.Analysis{}, err
+		}
+
+		node := othersRes.nodes[size%others[0]]
+		if node.reached && node.total <= size {
+			analysis.Redundant = append(analysis.Redundant, size)
+		}
+	}
+
+	analysis.WorstExcess, err = worstExcess(ctx, res, smallest)
+	if err != nil {
+		return order.Analysis{}, err
+	}
+
+	return analysis, nil
+}
+
+// analysisWeight estimates how many residues analyzing some sorted package sizes allocates
+// the residues of the smallest package are kept while the ones of every other sizes subset are solved,
+// the largest of those being the residues of the second smallest package, once the smallest one is left out
+func analysisWeight(sizes []int) int {
+	weight := sizes[0]
+	if len(sizes) > 1 {
+		weight += sizes[1]
+	}
+
+	return weight
+}
+
+// minimalTotals calculates the least total reaching every residue modulo the smallest of some sorted package sizes
+// pricing every package by its size but the smallest one, which is free, turns the residues weights into their totals
+func minimalTotals(ctx context.Context, sizes []int) (residues, error) {
+	options := make([]packOption, len(sizes))
+	for i, size := range sizes {
+		options[i] = packOption{size: size, cost: size}
+	}
+	options[0].cost = 0
+
+	return shortestResidues(ctx, options, options[0])
+}
+
+// worstExcess calculates the largest excess of the least excess plan of any order, one less than the widest gap between reachable totals
+// a total above a reachable one by the smallest package is reachable too, so once a residue is reached it stays so
+// the gaps only change when a residue is first reached, repeating every smallest package otherwise, so those periods are skipped
+func worstExcess(ctx context.Context, res residues, smallest int) (int, error) {
+	var firsts []int
+	for _, node := range res.nodes {
+		if node.reached {
+			firsts = append(firsts, node.total)
+		}
+	}
+	slices.Sort(firsts)
+
+	reachable := func(t int) bool {
+		node := res.nodes[t%smallest]
+		return node.reached && node.total <= t
+	}
+
+	// past the bound every reached residue stays reached, so one more period covers all gaps
+	end := res.bound + smallest
+	last, gap, since, next := 0, 0, 1, 0
+	for t := 1; t <= end; t++ {
+		err := checkCanceled(ctx, t)
+		if err != nil {
+			return 0, err
+		}
+
+		for next < len(firsts) && firsts[next] <= t {
+			if firsts[next] == t {
+				since = t
+			}
+			next++
+		}
+
+		if reachable(t) {
+			gap = max(gap, t-last)
+			last = t
+		}
+
+		// a whole period was checked since the last residue was first reached, so the following ones repeat it
+		target := end
+		if next < len(firsts) {
+			target = firsts[next]
+		}
+		if periods := (target - t - 1) / smallest; t-since+1 >= smallest && periods > 0 {
+			t += periods * smallest
+			last += periods * smallest
+		}
+	}
+
+	return gap - 1, nil
+}
+
+// greatestCommonDivisor calculates the greatest common divisor of two non negative integers
+func greatestCommonDivisor(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
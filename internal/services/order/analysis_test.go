@@ -0,0 +1,164 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestShippingAnalyze(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		desc          string
+		pid           int
+		version       int
+		expected      order.Analysis
+		expectedError error
+	}{
+		{
+			desc: "coprime sizes with a redundant one",
+			pid:  1,
+			expected: order.Analysis{
+				PID:         1,
+				Sizes:       []int{5, 10, 12},
+				GCD:         1,
+				Frobenius:   intPtr(43),
+				Unreachable: intPtr(22),
+				Redundant:   []int{10},
+				WorstExcess: 4,
+			},
+		},
+		{
+			desc: "coprime sizes",
+			pid:  2,
+			expected: order.Analysis{
+				PID:         2,
+				Sizes:       []int{23, 31, 53},
+				GCD:         1,
+				Frobenius:   intPtr(326),
+				Unreachable: intPtr(168),
+				Redundant:   []int{},
+				WorstExcess: 22,
+			},
+		},
+		{
+			desc: "sizes with a common divisor",
+			pid:  4,
+			expected: order.Analysis{
+				PID:         4,
+				Sizes:       []int{250, 500, 1000},
+				GCD:         250,
+				Redundant:   []int{500, 1000},
+				WorstExcess: 249,
+			},
+		},
+		{
+			desc:    "previous version",
+			pid:     1,
+			version: 1,
+			expected: order.Analysis{
+				PID:         1,
+				Version:     1,
+				Sizes:       []int{5, 10},
+				GCD:         5,
+				Redundant:   []int{10},
+				WorstExcess: 4,
+			},
+		},
+		{
+			desc:          "no pack sizes",
+			pid:           0,
+			expectedError: product.ErrNoPackSizes,
+		},
+		{
+			desc:          "version not found",
+			pid:           1,
+			version:       2,
+			expectedError: product.ErrVersionNotFound,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			optimizer := NewOptimizer(mockStorage{}, mockStorage{})
+			res, err := optimizer.Analyze(ctx, tC.pid, tC.version)
+
+			assert.Equal(t, tC.expected, res)
+			assert.True(t, errors.Is(err, tC.expectedError))
+		})
+	}
+}
+
+func TestShippingAnalyzeLimiter(t *testing.T) {
+	var acquired []int
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithLimiter(mockLimiter{capacity: 100, acquired: &acquired})
+
+	// analyses weigh the residues of the two smallest packages
+	_, err := optimizer.Analyze(context.Background(), 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{54, -54}, acquired)
+
+	_, err = optimizer.Analyze(context.Background(), 4, 0)
+	assert.ErrorIs(t, err, order.ErrCalculationTooLarge)
+
+	busy := NewOptimizer(mockStorage{}, mockStorage{}).WithLimiter(mockLimiter{capacity: 100, used: 80, acquired: &acquired})
+	_, err = busy.Analyze(context.Background(), 2, 0)
+	assert.ErrorIs(t, err, order.ErrOverloaded)
+}
+
+func TestShippingAnalyzeBruteForce(t *testing.T) {
+	ctx := context.Background()
+	sets := [][]int{{1}, {1, 7}, {3, 5}, {4, 6, 9}, {6, 10, 15}, {7, 11, 13, 40}, {9, 12, 30}, {17, 29}, {20, 21, 22, 23}}
+
+	for _, sizes := range sets {
+		const limit = 2000
+		reachable := make([]bool, limit)
+		reachable[0] = true
+		for t := 1; t < limit; t++ {
+			for _, size := range sizes {
+				if size <= t && reachable[t-size] {
+					reachable[t] = true
+				}
+			}
+		}
+
+		frobenius, unreachable, last, worst := -1, 0, 0, 0
+		for t := 1; t < limit; t++ {
+			if !reachable[t] {
+				frobenius = t
+				unreachable++
+				continue
+			}
+			worst = max(worst, t-last-1)
+			last = t
+		}
+
+		res, err := minimalTotals(ctx, sizes)
+		assert.NoError(t, err)
+		excess, err := worstExcess(ctx, res, sizes[0])
+		assert.NoError(t, err)
+		assert.Equal(t, worst, excess, sizes)
+
+		gcd := 0
+		for _, size := range sizes {
+			gcd = greatestCommonDivisor(gcd, size)
+		}
+		if gcd == 1 {
+			assert.Equal(t, frobenius, res.bound-sizes[0], sizes)
+			total := 0
+			for r, node := range res.nodes {
+				total += (node.total - r) / sizes[0]
+			}
+			assert.Equal(t, unreachable, total, sizes)
+		}
+	}
+}
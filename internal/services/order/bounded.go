@@ -0,0 +1,155 @@
+package order
+
+import (
+	"context"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+)
+
+// maxBoundedLimit is the highest total that can be planned when the available stock restricts the solution
+const maxBoundedLimit = 1000000
+
+// withinStock checks whether a packages combination can be served by the available stock
+func withinStock(packs []order.Pack, levels map[int]int) bool {
+	for _, pack := range packs {
+		if pack.Quantity > levels[pack.PackSize] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// optimizeBounded finds the cheapest combination whose total serves qty without exceeding it by more than maxExcess
+// and without using more packages of each size than the available levels
+// ties are broken by the least total and then by the least amount of packages
+// options must be sorted in ascending order of size
+func optimizeBounded(ctx context.Context, options []packOption, levels map[int]int, qty, maxExcess int) (plan, error) {
+	limit := qty + maxExcess + 1
+
+	// only the available packages are considered, up to the amount that fits below the limit
+	type boundedOption struct {
+		packOption
+		available int
+	}
+
+	var (
+		available []boundedOption
+		capacity  int
+	)
+	for _, option := range options {
+		count := min(levels[option.size], (limit-1)/option.size)
+		if count <= 0 {
+			continue
+		}
+
+		available = append(available, boundedOption{
+			packOption: option,
+			available:  count,
+		})
+		capacity += count * option.size
+	}
+
+	if capacity < qty {
+		return plan{}, product.ErrInsufficientStock
+	}
+
+	limit = min(limit, capacity+1)
+	if limit > maxBoundedLimit {
+		return plan{}, order.ErrOrderTooLarge
+	}
+
+	// the checkpoints are calculated adding one package size at a time
+	// taken keeps how many packages of each size were added to reach every total so that it can be back tracked
+	cps := make([]checkpoint, limit)
+	for i := range cps {
+		cps[i].cost = inf
+		cps[i].packsCount = inf
+	}
+	cps[0].cost = 0
+	cps[0].packsCount = 0
+
+	taken := make([][]int32, len(available))
+	next := make([]checkpoint, limit)
+	for i, option := range available {
+		taken[i] = make([]int32, limit)
+
+		// key holds the checkpoint of a total with the cost and packages of the current size removed
+		// so that the best previous total within the available packages is kept in a monotonic queue
+		key := func(r, j int) (int, int) {
+			cp := cps[r+j*option.size]
+			return cp.cost - j*option.cost, cp.packsCount - j
+		}
+
+		// totals sharing the same residue are processed together
+		queue := make([]int, 0, limit/option.size+1)
+		for r := 0; r < option.size && r < limit; r++ {
+			queue = queue[:0]
+
+			for j, t := 0, r; t < limit; j, t = j+1, t+option.size {
+				err := checkCanceled(ctx, t)
+				if err != nil {
+					return plan{}, err
+				}
+
+				if cps[t].packsCount < inf {
+					cost, count := key(r, j)
+					for len(queue) > 0 {
+						lastCost, lastCount := key(r, queue[len(queue)-1])
+						if lastCost < cost || lastCost == cost && lastCount < count {
+							break
+						}
+						queue = queue[:len(queue)-1]
+					}
+					queue = append(queue, j)
+				}
+
+				for len(queue) > 0 && queue[0] < j-option.available {
+					queue = queue[1:]
+				}
+
+				if len(queue) == 0 {
+					next[t] = checkpoint{cost: inf, packsCount: inf}
+					continue
+				}
+
+				cost, count := key(r, queue[0])
+				next[t] = checkpoint{
+					cost:       cost + j*option.cost,
+					packsCount: count + j,
+				}
+				taken[i][t] = int32(j - queue[0])
+			}
+		}
+
+		cps, next = next, cps
+	}
+
+	// finds the best valid combination
+	// totals are checked in ascending order so only a cheaper one can replace the current best
+	best, bestCost := 0, inf
+	for t := qty; t < limit; t++ {
+		if cps[t].cost < bestCost {
+			best, bestCost = t, cps[t].cost
+		}
+	}
+	if bestCost == inf {
+		return plan{}, product.ErrInsufficientStock
+	}
+
+	// backtracks through the package sizes in reverse order counting the packages taken of each one
+	packCountsMap := make(map[int]int)
+	for i, t := len(available)-1, best; i >= 0; i-- {
+		count := int(taken[i][t])
+		packCountsMap[available[i].size] += count
+		t -= count * available[i].size
+	}
+
+	return plan{
+		packs:      packsCombination(options, packCountsMap),
+		total:      best,
+		packsCount: cps[best].packsCount,
+		cost:       bestCost,
+	}, nil
+}
@@ -0,0 +1,210 @@
+package order
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+	"sync"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+)
+
+// Cache keeps the latest shipping calculations, evicting the least recently used ones once full
+// it also keeps the solver of each product package options so that larger orders extend the tables already solved
+// solvers are bounded by the table entries they retain, as a single solver may grow as large as the orders it solved
+// products are invalidated through Invalidate whenever their package sizes change
+type Cache struct {
+	m             sync.Mutex
+	capacity      int
+	solverEntries int
+	results       *list.List
+	index         map[resultKey]*list.Element
+	solvers       *list.List
+	byPacks       map[solverKey]*list.Element
+	hits          int
+	misses        int
+}
+
+// CacheStats holds the usage counters of a Cache
+type CacheStats struct {
+	Hits    int
+	Misses  int
+	Entries int
+}
+
+// a resultKey identifies a shipping calculation of a given package sizes configuration
+type resultKey struct {
+	pid          int
+	fingerprint  uint64
+	qty          int
+	objective    order.Objective
+	maxExcess    int
+	alternatives int
+}
+
+// a solverKey identifies the package options of a given package sizes configuration
+type solverKey struct {
+	pid         int
+	fingerprint uint64
+	withCosts   bool
+}
+
+type resultEntry struct {
+	key      resultKey
+	shipping order.Shipping
+}
+
+type solverEntry struct {
+	key    solverKey
+	solver *solver
+}
+
+// NewCache initializes a Cache holding up to capacity calculations and the solvers retaining up to solverEntries table entries altogether
+func NewCache(capacity, solverEntries int) *Cache {
+	return &Cache{
+		capacity:      max(capacity, 1),
+		solverEntries: max(solverEntries, 0),
+		results:       list.New(),
+		index:         make(map[resultKey]*list.Element),
+		solvers:       list.New(),
+		byPacks:       make(map[solverKey]*list.Element),
+	}
+}
+
+// get method retrieves a cached calculation, counting the hit or miss
+func (c *Cache) get(key resultKey) (order.Shipping, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	elem, found := c.index[key]
+	if !found {
+		c.misses++
+		return order.Shipping{}, false
+	}
+
+	c.hits++
+	c.results.MoveToFront(elem)
+	return cloneShipping(elem.Value.(*resultEntry).shipping), true
+}
+
+// put method caches a calculation, evicting the least recently used one when full
+func (c *Cache) put(key resultKey, shipping order.Shipping) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if elem, found := c.index[key]; found {
+		elem.Value.(*resultEntry).shipping = cloneShipping(shipping)
+		c.results.MoveToFront(elem)
+		return
+	}
+
+	c.index[key] = c.results.PushFront(&resultEntry{key: key, shipping: cloneShipping(shipping)})
+	if c.results.Len() > c.capacity {
+		oldest := c.results.Back()
+		c.results.Remove(oldest)
+		delete(c.index, oldest.Value.(*resultEntry).key)
+	}
+}
+
+// solver method retrieves the solver of some package options, creating it when missing
+// the solver tables grow as it is used, so trimSolvers must be called once done with it
+func (c *Cache) solver(key solverKey, options []packOption) *solver {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if elem, found := c.byPacks[key]; found {
+		c.solvers.MoveToFront(elem)
+		return elem.Value.(*solverEntry).solver
+	}
+
+	s := newSolver(options)
+	c.byPacks[key] = c.solvers.PushFront(&solverEntry{key: key, solver: s})
+
+	return s
+}
+
+// trimSolvers method evicts the least recently used solvers until the table entries retained by the remaining ones are within the bound
+// a solver retaining more entries than the whole bound is evicted as well, being only kept by the calculations still using it
+func (c *Cache) trimSolvers() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	var retained int
+	for elem := c.solvers.Front(); elem != nil; elem = elem.Next() {
+		retained += elem.Value.(*solverEntry).solver.entries()
+	}
+
+	for retained > c.solverEntries {
+		oldest := c.solvers.Back()
+		entry := oldest.Value.(*solverEntry)
+		retained -= entry.solver.entries()
+		c.solvers.Remove(oldest)
+		delete(c.byPacks, entry.key)
+	}
+}
+
+// Invalidate method drops every cached calculation and solver of a product
+func (c *Cache) Invalidate(pid int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for key, elem := range c.index {
+		if key.pid == pid {
+			c.results.Remove(elem)
+			delete(c.index, key)
+		}
+	}
+	for key, elem := range c.byPacks {
+		if key.pid == pid {
+			c.solvers.Remove(elem)
+			delete(c.byPacks, key)
+		}
+	}
+}
+
+// Stats method returns the hits and misses counted so far and the number of cached calculations
+func (c *Cache) Stats() CacheStats {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.results.Len(),
+	}
+}
+
+// fingerprint hashes the package sizes and costs of a product configuration
+// versions with the same configuration share their fingerprint
+func fingerprint(prd product.Product) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 0, 8*(len(prd.Packs)+len(prd.Costs)+2))
+	buf = binary.AppendVarint(buf, int64(len(prd.Packs)))
+	for _, size := range prd.Packs {
+		buf = binary.AppendVarint(buf, int64(size))
+	}
+	buf = binary.AppendVarint(buf, int64(len(prd.Costs)))
+	for _, cost := range prd.Costs {
+		buf = binary.AppendVarint(buf, int64(cost))
+	}
+	h.Write(buf)
+
+	return h.Sum64()
+}
+
+// cloneShipping copies the packages of a calculation so that cached ones can't be changed by callers
+func cloneShipping(shipping order.Shipping) order.Shipping {
+	shipping.Packs = slices.Clone(shipping.Packs)
+	if shipping.Alternatives != nil {
+		alternatives := make([]order.Plan, len(shipping.Alternatives))
+		for i, alt := range shipping.Alternatives {
+			alt.Packs = slices.Clone(alt.Packs)
+			alternatives[i] = alt
+		}
+		shipping.Alternatives = alternatives
+	}
+
+	return shipping
+}
@@ -3,124 +3,563 @@ package order
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"math"
+	"slices"
 	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
 )
 
-// Storage provides storage retrieval access to products package sizes
+// Storage provides storage retrieval access to products package sizes and their versions
 type Storage interface {
-	PackSizes(int) ([]int, error)
+	Product(int) (product.Product, error)
+	Revision(int, int) (product.Revision, error)
+}
+
+// StockStorage provides storage retrieval access to products packages stock
+type StockStorage interface {
+	Stock(int) (product.Stock, error)
+}
+
+// Recorder records the calculations solved by the optimizer
+type Recorder interface {
+	ObserveCalculation(pid, qty int, duration time.Duration)
+}
+
+// Limiter limits the total weight of the calculations solved concurrently
+type Limiter interface {
+	TryAcquire(weight int) (func(), bool)
+	Capacity() int
 }
 
 // Optimizer provides the order packages calculation service
 type Optimizer struct {
-	storage Storage
+	storage  Storage
+	stock    StockStorage
+	recorder Recorder
+	limiter  Limiter
+	cache    *Cache
 }
 
 // NewOptimizer returns an initialized Optimizer
-func NewOptimizer(storage Storage) Optimizer {
+func NewOptimizer(storage Storage, stock StockStorage) Optimizer {
 	return Optimizer{
 		storage: storage,
+		stock:   stock,
 	}
 }
 
+// WithRecorder method returns a copy of the Optimizer recording every calculation of a configured product
+func (o Optimizer) WithRecorder(recorder Recorder) Optimizer {
+	o.recorder = recorder
+	return o
+}
+
+// WithLimiter method returns a copy of the Optimizer rejecting calculations once a limiter is exhausted
+// every calculation weighs the size of the solver tables it allocates, as given by solveWeight, and every analysis its residues
+func (o Optimizer) WithLimiter(limiter Limiter) Optimizer {
+	o.limiter = limiter
+	return o
+}
+
+// WithCache method returns a copy of the Optimizer serving repeated calculations from a cache
+// products tracking stock are never cached, as their calculations also depend on the stock levels
+func (o Optimizer) WithCache(cache *Cache) Optimizer {
+	o.cache = cache
+	return o
+}
+
 // Calculate method calculates the best packages distribution for a given order
 func (o Optimizer) Calculate(ctx context.Context, req order.Order) (order.Shipping, error) {
 	if req.Qty <= 0 {
-		return order.Shipping{}, errors.New("empty order")
+		return order.Shipping{}, order.ErrEmptyOrder
+	}
+
+	prd, err := o.productVersion(req.PID, req.Version)
+	if err != nil {
+		return order.Shipping{}, err
+	}
+
+	stk, stockErr := o.stock.Stock(req.PID)
+	tracked := stockErr == nil
+
+	// only configured products are recorded so that unknown product ids can't grow the recorded series
+	// calculations served from the cache are recorded too, while the ones rejected by the limiter are not
+	start := time.Now()
+	record := func() {
+		if o.recorder != nil {
+			o.recorder.ObserveCalculation(req.PID, req.Qty, time.Since(start))
+		}
+	}
+
+	cached := o.cache != nil && !tracked
+	var key resultKey
+	if cached {
+		key = resultKey{
+			pid:          req.PID,
+			fingerprint:  fingerprint(prd),
+			qty:          req.Qty,
+			objective:    req.Objective,
+			alternatives: req.Alternatives,
+		}
+		if req.Objective == order.MinCostCappedExcess {
+			key.maxExcess = req.MaxExcess
+		}
+
+		shipping, found := o.cache.get(key)
+		if found {
+			// versions sharing a configuration share their calculations, but not their packaging levels
+			shipping.Version = prd.Version
+			shipping.Containers, shipping.Levels = nestContainers(prd.Containers, shipping.Packs)
+			instrumentation.ContextLogger(ctx).Debug("Shipping served from cache", "pid", req.PID, "version", prd.Version, "order", req.Qty)
+			record()
+			return shipping, nil
+		}
+	}
+
+	release, err := acquire(o.limiter, solveWeight(prd.Packs, req.Qty, req.Alternatives))
+	if err != nil {
+		instrumentation.ContextLogger(ctx).Warning("Calculation rejected", "pid", req.PID, "order", req.Qty, "error", err)
+		return order.Shipping{}, err
+	}
+	defer release()
+
+	defer record()
+
+	if len(prd.Packs) == 0 {
+		return order.Shipping{}, product.ErrNoPackSizes
+	}
+
+	costs := prd.PackCosts()
+	if req.Objective != order.MinExcess && costs == nil {
+		return order.Shipping{}, product.ErrNoPackCosts
+	}
+
+	// the excess objective ignores costs, which are only reported for the chosen plan
+	options := packOptions(prd.Packs, costs, req.Objective != order.MinExcess)
+	smallest, largest := options[0].size, options[len(options)-1].size
+
+	// the best total never exceeds the order quantity by a whole package
+	// without costs it can't exceed it by the size of the smallest package
+	maxExcess := smallest - 1
+	switch req.Objective {
+	case order.MinCost:
+		maxExcess = largest - 1
+	case order.MinCostCappedExcess:
+		maxExcess = min(largest-1, req.MaxExcess)
+	}
+
+	slv := newSolver(options)
+	if cached {
+		slv = o.cache.solver(solverKey{pid: req.PID, fingerprint: key.fingerprint, withCosts: req.Objective != order.MinExcess}, options)
+		defer o.cache.trimSolvers()
+	}
+
+	best, err := slv.optimize(ctx, req.Qty, maxExcess)
+	if err != nil {
+		return order.Shipping{}, err
+	}
+
+	// products without stock tracking have unlimited packages
+	// otherwise the best plan is kept only if the stock serves it, being solved again under the stock limits
+	// bounded plans and alternatives may exceed the order quantity by less than a whole package of any size
+	boundedExcess := largest - 1
+	if req.Objective == order.MinCostCappedExcess {
+		boundedExcess = min(boundedExcess, req.MaxExcess)
+	}
+
+	if tracked && !withinStock(best.packs, stk.Levels) {
+		best, err = optimizeBounded(ctx, options, stk.Levels, req.Qty, boundedExcess)
+		if err != nil {
+			return order.Shipping{}, err
+		}
+	}
+
+	var alternatives []order.Plan
+	if req.Alternatives > 0 {
+		plans, err := rankedPlans(ctx, options, req.Qty, boundedExcess, req.Alternatives, best, stk.Levels, tracked)
+		if err != nil {
+			return order.Shipping{}, err
+		}
+
+		alternatives = make([]order.Plan, len(plans))
+		for i, p := range plans {
+			alternatives[i] = order.Plan{
+				Packs:      p.packs,
+				PacksCount: p.packsCount,
+				Total:      p.total,
+				Excess:     p.total - req.Qty,
+				Cost:       packsCost(p.packs, costs),
+			}
+		}
+	}
+
+	instrumentation.ContextLogger(ctx).Debug("Shipping calculated", "pid", req.PID, "version", prd.Version, "order", req.Qty, "total", best.total)
+
+	shipping := order.Shipping{
+		PID:          req.PID,
+		Version:      prd.Version,
+		Order:        req.Qty,
+		Packs:        best.packs,
+		PacksCount:   best.packsCount,
+		Total:        best.total,
+		Excess:       best.total - req.Qty,
+		Cost:         packsCost(best.packs, costs),
+		Alternatives: alternatives,
+	}
+	if cached {
+		o.cache.put(key, shipping)
+	}
+	shipping.Containers, shipping.Levels = nestContainers(prd.Containers, shipping.Packs)
+
+	return shipping, nil
+}
+
+// solveWeight estimates how many table entries solving an order allocates
+// the residues and the checkpoints they are reduced through grow with the largest package, while the order quantity
+// only adds the totals solved directly, roughly capped by maxBoundedLimit, and every alternative ranked keeps its own chains
+func solveWeight(packs []int, qty, alternatives int) int {
+	var largest int
+	for _, size := range packs {
+		largest = max(largest, size)
+	}
+
+	return (largest + min(qty, maxBoundedLimit)) * (alternatives + 1)
+}
+
+// acquire reserves a weight of a limiter, returning the function that releases it
+// weights above the whole capacity are rejected as too large, as they would never be acquired
+func acquire(limiter Limiter, weight int) (func(), error) {
+	if limiter == nil {
+		return func() {}, nil
+	}
+	if weight > limiter.Capacity() {
+		return nil, order.ErrCalculationTooLarge
+	}
+
+	release, acquired := limiter.TryAcquire(weight)
+	if !acquired {
+		return nil, order.ErrOverloaded
+	}
+
+	return release, nil
+}
+
+// productVersion retrieves a given package sizes version of a product, or its latest one when no version is given
+func (o Optimizer) productVersion(pid, version int) (product.Product, error) {
+	if version == 0 {
+		return o.storage.Product(pid)
+	}
+
+	rev, err := o.storage.Revision(pid, version)
+	if err != nil {
+		return product.Product{}, err
+	}
+
+	return rev.Product, nil
+}
+
+// packsCost calculates the total cost of a packages combination
+func packsCost(packs []order.Pack, costs map[int]int) int {
+	var cost int
+	for _, pack := range packs {
+		cost += pack.Quantity * costs[pack.PackSize]
+	}
+
+	return cost
+}
+
+// a packOption holds a distinct package size available to the optimizer and its cost
+type packOption struct {
+	size int
+	cost int
+}
+
+// packOptions returns the distinct package sizes sorted in ascending order along with their costs if required
+func packOptions(packSizes []int, costs map[int]int, withCosts bool) []packOption {
+	sizes := slices.Clone(packSizes)
+	sort.Ints(sizes)
+	sizes = slices.Compact(sizes)
+
+	options := make([]packOption, len(sizes))
+	for i, size := range sizes {
+		options[i].size = size
+		if withCosts {
+			options[i].cost = costs[size]
+		}
+	}
+
+	return options
+}
+
+// a plan holds an optimized packages combination and its totals
+// cost is the one used by the optimization, being zero when costs are ignored
+type plan struct {
+	packs      []order.Pack
+	total      int
+	packsCount int
+	cost       int
+}
+
+// a solver holds the tables of a package options set so that they can be reused by every order solved with it
+// the residues are solved once, and the checkpoints are extended whenever an order needs more of them
+// size counts the entries of both tables, so that they can be weighed without waiting for an extension
+type solver struct {
+	m       sync.Mutex
+	options []packOption
+	fill    packOption
+	res     *residues
+	cps     []checkpoint
+	size    atomic.Int64
+}
+
+// newSolver returns a solver for options sorted in ascending order of size
+func newSolver(options []packOption) *solver {
+	return &solver{
+		options: options,
+		fill:    fillOption(options),
+	}
+}
+
+// entries method returns the table entries retained by the solver
+func (s *solver) entries() int {
+	return int(s.size.Load())
+}
+
+// residues method returns the residues of the fill package, solving them on the first call
+func (s *solver) residues(ctx context.Context) (residues, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.res == nil {
+		res, err := shortestResidues(ctx, s.options, s.fill)
+		if err != nil {
+			return residues{}, err
+		}
+		s.res = &res
+		s.size.Add(int64(len(res.nodes)))
 	}
 
-	packsizes, err := o.storage.PackSizes(req.PID)
+	return *s.res, nil
+}
+
+// checkpoints method returns the checkpoints of every total below limit, extending the previously solved ones
+// checkpoints are never changed once solved, so the returned slice is safe to read while others extend it
+// an extension stopped by the context is discarded, keeping the previously solved checkpoints
+func (s *solver) checkpoints(ctx context.Context, limit int) ([]checkpoint, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if len(s.cps) < limit {
+		cps, err := extendCheckpoints(ctx, s.cps, s.options, limit)
+		if err != nil {
+			return nil, err
+		}
+		s.size.Add(int64(cap(cps) - cap(s.cps)))
+		s.cps = cps
+	}
+
+	return s.cps[:limit], nil
+}
+
+// optimize method finds the cheapest combination whose total serves qty without exceeding it by more than maxExcess
+// ties are broken by the least total and then by the least amount of packages
+// it fails with ErrUnservableOrder when no combination is found, or with the context error once it is done
+func (s *solver) optimize(ctx context.Context, qty, maxExcess int) (plan, error) {
+	options, fill := s.options, s.fill
+	limit := qty + maxExcess + 1
+
+	// small orders are solved directly through the checkpoints
+	// larger ones are reduced to a base total below the residues bound and filled with the most efficient package
+	var (
+		res residues
+		err error
+	)
+	direct := qty < fill.size
+	if !direct {
+		res, err = s.residues(ctx)
+		if err != nil {
+			return plan{}, err
+		}
+		direct = qty < res.bound
+	}
+
+	cpsLimit := limit
+	if !direct {
+		cpsLimit = res.bound + fill.size
+	}
+	cps, err := s.checkpoints(ctx, cpsLimit)
 	if err != nil {
-		return order.Shipping{}, errors.New("no product found")
+		return plan{}, err
 	}
 
-	if len(packsizes) == 0 {
-		return order.Shipping{}, errors.New("no pack sizes found for product")
+	// base returns the total solved by the checkpoints and the number of fill packages on top of it
+	base := func(t int) (int, int, bool) {
+		if direct {
+			return t, 0, cps[t].packsCount < inf
+		}
+
+		// above the bound a total is reachable whenever its residue is
+		node := res.nodes[t%fill.size]
+		if !node.reached {
+			return 0, 0, false
+		}
+
+		b := node.total + (t-node.total)%fill.size
+		return b, (t - b) / fill.size, true
 	}
 
-	packs, totalCount, packsCount := optimizeShipping(packsizes, req.Qty)
+	// finds the best valid combination
+	// totals are checked in ascending order so only a cheaper one can replace the current best
+	var (
+		best, bestBase, bestFill int
+		bestCost                 = inf
+	)
+	for t := qty; t < limit; t++ {
+		b, n, ok := base(t)
+		if !ok {
+			continue
+		}
 
-	return order.Shipping{
-		PID:        req.PID,
-		Order:      req.Qty,
-		Packs:      packs,
-		PacksCount: packsCount,
-		Total:      totalCount,
-		Excess:     totalCount - req.Qty,
+		cost := cps[b].cost + n*fill.cost
+		if cost < bestCost {
+			best, bestBase, bestFill, bestCost = t, b, n, cost
+		}
+	}
+	if bestCost == inf {
+		return plan{}, order.ErrUnservableOrder
+	}
+
+	packCountsMap := backtrack(cps, bestBase)
+	packCountsMap[fill.size] += bestFill
+
+	return plan{
+		packs:      packsCombination(options, packCountsMap),
+		total:      best,
+		packsCount: cps[bestBase].packsCount + bestFill,
+		cost:       bestCost,
 	}, nil
 }
 
-func optimizeShipping(packSizes []int, qty int) ([]order.Pack, int, int) {
-	const inf = math.MaxInt
+// fillOption returns the package with the least cost per unit, preferring the largest on ties
+func fillOption(options []packOption) packOption {
+	fill := options[0]
+	for _, option := range options[1:] {
+		if option.cost*fill.size <= fill.cost*option.size {
+			fill = option
+		}
+	}
+
+	return fill
+}
+
+const inf = math.MaxInt
+
+// cancelInterval is how many steps the solvers take between checks of their context
+const cancelInterval = 1 << 16
 
-	// a checkpoint holds an intermediate calculation for a given order quantity
-	// packsCount stores the least amount of packages that serves that exact quantity
-	// packSize indicates the size of the last package so that it can be back tracked
-	type checkpoint struct {
-		packsCount int
-		packSize   int
+// checkCanceled checks whether the context of a solver is done every cancelInterval steps
+// the returned error wraps the context one, so that timeouts are still reported as context.DeadlineExceeded
+func checkCanceled(ctx context.Context, step int) error {
+	if step%cancelInterval != 0 {
+		return nil
 	}
 
-	// the total items can't exceed the actual order quantity plus the size of the smallest package
-	sort.Ints(packSizes)
-	limit := qty + packSizes[0]
+	err := ctx.Err()
+	if err != nil {
+		return fmt.Errorf("solving shipping: %w", err)
+	}
+
+	return nil
+}
+
+// a checkpoint holds an intermediate calculation for a given order quantity
+// cost and packsCount store the cheapest and then least amount of packages that serves that exact quantity
+// packSize indicates the size of the last package so that it can be back tracked
+type checkpoint struct {
+	cost       int
+	packsCount int
+	packSize   int
+}
+
+// extendCheckpoints calculates the best packages combination for every total from the ones already solved up to limit
+// the solved checkpoints are final, as every total below them was already added to all packages
+func extendCheckpoints(ctx context.Context, cps []checkpoint, options []packOption, limit int) ([]checkpoint, error) {
+	solved := len(cps)
 
-	// the initial checkpoints slice starts with the highest number of packages for comparison purposes
-	cps := make([]checkpoint, limit)
-	for i := range cps {
-		cps[i].packsCount = inf
+	// the new checkpoints start with the highest cost and number of packages for comparison purposes
+	cps = slices.Grow(cps, limit-solved)[:limit]
+	for i := solved; i < limit; i++ {
+		cps[i] = checkpoint{cost: inf, packsCount: inf}
+	}
+	if solved == 0 {
+		cps[0].cost = 0
+		cps[0].packsCount = 0
 	}
-	cps[0].packsCount = 0
 
 	// each checkpoint is checked for a possible matching combination
 	// all existing packages are added on top of valid checkpoints and the best ones are kept
-	for t := range limit {
+	// solved checkpoints within reach of the new ones are added to the packages again, in the same order as before
+	largest := options[len(options)-1].size
+	for t := max(0, solved-largest); t < limit; t++ {
+		err := checkCanceled(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+
 		if cps[t].packsCount == inf {
 			continue
 		}
 
-		for _, size := range packSizes {
-			next := t + size
-			if next < limit && cps[t].packsCount+1 < cps[next].packsCount {
+		for _, option := range options {
+			next := t + option.size
+			if next < solved || next >= limit {
+				continue
+			}
+
+			cost := cps[t].cost + option.cost
+			if cost < cps[next].cost || cost == cps[next].cost && cps[t].packsCount+1 < cps[next].packsCount {
+				cps[next].cost = cost
 				cps[next].packsCount = cps[t].packsCount + 1
-				cps[next].packSize = size
+				cps[next].packSize = option.size
 			}
 		}
 	}
 
-	// finds the best valid combination
-	var best int
-	for t := qty; t < limit; t++ {
-		if cps[t].packsCount < inf {
-			best = t
-			break
-		}
-	}
+	return cps, nil
+}
 
-	// backtracks through the checkpoints counting the number of each package size
+// backtrack goes through the checkpoints counting the number of each package size
+func backtrack(cps []checkpoint, total int) map[int]int {
 	packCountsMap := make(map[int]int)
-	for t := best; t > 0; {
+	for t := total; t > 0; {
 		packCountsMap[cps[t].packSize]++
 		t -= cps[t].packSize
 	}
 
-	// prepares the package sizes combination filtering the not used ones
-	bestCounts := make([]order.Pack, 0, len(packSizes))
-	for _, size := range packSizes {
-		count := packCountsMap[size]
+	return packCountsMap
+}
+
+// packsCombination prepares the package sizes combination filtering the not used ones
+func packsCombination(options []packOption, packCountsMap map[int]int) []order.Pack {
+	bestCounts := make([]order.Pack, 0, len(options))
+	for _, option := range options {
+		count := packCountsMap[option.size]
 		if count == 0 {
 			continue
 		}
 
 		bestCounts = append(bestCounts, order.Pack{
-			PackSize: size,
+			PackSize: option.size,
 			Quantity: count,
 		})
 	}
 
-	return bestCounts, best, cps[best].packsCount
+	return bestCounts
 }
@@ -4,25 +4,50 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockStorage struct{}
 
-func (m mockStorage) PackSizes(pid int) ([]int, error) {
+func (m mockStorage) Product(pid int) (product.Product, error) {
 	switch pid {
 	case 0:
-		return []int{}, nil
+		return product.Product{PID: 0, Packs: []int{}}, nil
 	case 1:
-		return []int{5, 10, 12}, nil
+		return product.Product{PID: 1, Packs: []int{5, 10, 12}}, nil
 	case 2:
-		return []int{23, 31, 53}, nil
+		return product.Product{PID: 2, Packs: []int{23, 31, 53}}, nil
 	case 3:
-		return []int{23, 31, 53, 79, 97, 113, 137}, nil
+		return product.Product{PID: 3, Packs: []int{23, 31, 53, 79, 97, 113, 137}}, nil
+	case 4:
+		return product.Product{PID: 4, Packs: []int{250, 500, 1000}, Costs: []int{30, 45, 100}}, nil
+	case 5, 6:
+		return product.Product{PID: pid, Packs: []int{23, 31, 53}}, nil
+	case 7:
+		return product.Product{PID: 7, Packs: []int{250, 500, 1000}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}, {Name: "pallet", Capacity: 10}}}, nil
 	}
-	return nil, errors.New("error")
+	return product.Product{}, errors.New("error")
+}
+
+func (m mockStorage) Revision(pid, version int) (product.Revision, error) {
+	if pid == 1 && version == 1 {
+		return product.Revision{Product: product.Product{PID: 1, Packs: []int{5, 10}, Version: 1}}, nil
+	}
+	return product.Revision{}, product.ErrVersionNotFound
+}
+
+func (m mockStorage) Stock(pid int) (product.Stock, error) {
+	switch pid {
+	case 5:
+		return product.Stock{PID: 5, Levels: map[int]int{23: 100, 31: 100, 53: 5}}, nil
+	case 6:
+		return product.Stock{PID: 6, Levels: map[int]int{23: 1, 31: 1}}, nil
+	}
+	return product.Stock{}, errors.New("error")
 }
 
 func TestShippingCalculateShipping(t *testing.T) {
@@ -91,6 +116,45 @@ func TestShippingCalculateShipping(t *testing.T) {
 			},
 			expectedError: assert.NoError,
 		},
+		{
+			desc: "product version case",
+			pid:  1,
+			order: order.Order{
+				PID:     1,
+				Qty:     21,
+				Version: 1,
+			},
+			expected: order.Shipping{
+				PID:     1,
+				Version: 1,
+				Order:   21,
+				Packs: []order.Pack{
+					{
+						PackSize: 5,
+						Quantity: 1,
+					},
+					{
+						PackSize: 10,
+						Quantity: 2,
+					},
+				},
+				PacksCount: 3,
+				Total:      25,
+				Excess:     4,
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "product version not found",
+			pid:  1,
+			order: order.Order{
+				PID:     1,
+				Qty:     21,
+				Version: 2,
+			},
+			expected:      order.Shipping{},
+			expectedError: assert.Error,
+		},
 		{
 			desc: "target case",
 			pid:  2,
@@ -151,10 +215,327 @@ func TestShippingCalculateShipping(t *testing.T) {
 			},
 			expectedError: assert.NoError,
 		},
+		{
+			desc: "maximum order case",
+			pid:  3,
+			order: order.Order{
+				PID: 3,
+				Qty: 2000000000,
+			},
+			expected: order.Shipping{
+				PID:   3,
+				Order: 2000000000,
+				Packs: []order.Pack{
+					{
+						PackSize: 31,
+						Quantity: 1,
+					},
+					{
+						PackSize: 53,
+						Quantity: 1,
+					},
+					{
+						PackSize: 97,
+						Quantity: 1,
+					},
+					{
+						PackSize: 113,
+						Quantity: 1,
+					},
+					{
+						PackSize: 137,
+						Quantity: 14598538,
+					},
+				},
+				PacksCount: 14598542,
+				Total:      2000000000,
+				Excess:     0,
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "excess objective with costs",
+			pid:  4,
+			order: order.Order{
+				PID: 4,
+				Qty: 1200,
+			},
+			expected: order.Shipping{
+				PID:   4,
+				Order: 1200,
+				Packs: []order.Pack{
+					{
+						PackSize: 250,
+						Quantity: 1,
+					},
+					{
+						PackSize: 1000,
+						Quantity: 1,
+					},
+				},
+				PacksCount: 2,
+				Total:      1250,
+				Excess:     50,
+				Cost:       130,
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "cost objective",
+			pid:  4,
+			order: order.Order{
+				PID:       4,
+				Qty:       1200,
+				Objective: order.MinCost,
+			},
+			expected: order.Shipping{
+				PID:   4,
+				Order: 1200,
+				Packs: []order.Pack{
+					{
+						PackSize: 250,
+						Quantity: 1,
+					},
+					{
+						PackSize: 500,
+						Quantity: 2,
+					},
+				},
+				PacksCount: 3,
+				Total:      1250,
+				Excess:     50,
+				Cost:       120,
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "cost objective load case",
+			pid:  4,
+			order: order.Order{
+				PID:       4,
+				Qty:       2000000000,
+				Objective: order.MinCost,
+			},
+			expected: order.Shipping{
+				PID:   4,
+				Order: 2000000000,
+				Packs: []order.Pack{
+					{
+						PackSize: 500,
+						Quantity: 4000000,
+					},
+				},
+				PacksCount: 4000000,
+				Total:      2000000000,
+				Excess:     0,
+				Cost:       180000000,
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "capped excess objective",
+			pid:  4,
+			order: order.Order{
+				PID:       4,
+				Qty:       1200,
+				Objective: order.MinCostCappedExcess,
+				MaxExcess: 0,
+			},
+			expected:      order.Shipping{},
+			expectedError: assert.Error,
+		},
+		{
+			desc: "cost objective without costs",
+			pid:  1,
+			order: order.Order{
+				PID:       1,
+				Qty:       21,
+				Objective: order.MinCost,
+			},
+			expected:      order.Shipping{},
+			expectedError: assert.Error,
+		},
+		{
+			desc: "stock limited case",
+			pid:  5,
+			order: order.Order{
+				PID: 5,
+				Qty: 500,
+			},
+			expected: order.Shipping{
+				PID:   5,
+				Order: 500,
+				Packs: []order.Pack{
+					{
+						PackSize: 31,
+						Quantity: 11,
+					},
+					{
+						PackSize: 53,
+						Quantity: 3,
+					},
+				},
+				PacksCount: 14,
+				Total:      500,
+				Excess:     0,
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "insufficient stock",
+			pid:  6,
+			order: order.Order{
+				PID: 6,
+				Qty: 100,
+			},
+			expected:      order.Shipping{},
+			expectedError: assert.Error,
+		},
+		{
+			desc: "alternatives",
+			pid:  1,
+			order: order.Order{
+				PID:          1,
+				Qty:          21,
+				Alternatives: 3,
+			},
+			expected: order.Shipping{
+				PID:   1,
+				Order: 21,
+				Packs: []order.Pack{
+					{
+						PackSize: 10,
+						Quantity: 1,
+					},
+					{
+						PackSize: 12,
+						Quantity: 1,
+					},
+				},
+				PacksCount: 2,
+				Total:      22,
+				Excess:     1,
+				Alternatives: []order.Plan{
+					{
+						Packs:      []order.Pack{{PackSize: 10, Quantity: 1}, {PackSize: 12, Quantity: 1}},
+						PacksCount: 2,
+						Total:      22,
+						Excess:     1,
+					},
+					{
+						Packs:      []order.Pack{{PackSize: 5, Quantity: 2}, {PackSize: 12, Quantity: 1}},
+						PacksCount: 3,
+						Total:      22,
+						Excess:     1,
+					},
+					{
+						Packs:      []order.Pack{{PackSize: 12, Quantity: 2}},
+						PacksCount: 2,
+						Total:      24,
+						Excess:     3,
+					},
+				},
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "maximum order alternatives",
+			pid:  3,
+			order: order.Order{
+				PID:          3,
+				Qty:          2000000000,
+				Alternatives: 2,
+			},
+			expected: order.Shipping{
+				PID:   3,
+				Order: 2000000000,
+				Packs: []order.Pack{
+					{
+						PackSize: 31,
+						Quantity: 1,
+					},
+					{
+						PackSize: 53,
+						Quantity: 1,
+					},
+					{
+						PackSize: 97,
+						Quantity: 1,
+					},
+					{
+						PackSize: 113,
+						Quantity: 1,
+					},
+					{
+						PackSize: 137,
+						Quantity: 14598538,
+					},
+				},
+				PacksCount: 14598542,
+				Total:      2000000000,
+				Excess:     0,
+				Alternatives: []order.Plan{
+					{
+						Packs:      []order.Pack{{PackSize: 31, Quantity: 1}, {PackSize: 53, Quantity: 1}, {PackSize: 97, Quantity: 1}, {PackSize: 113, Quantity: 1}, {PackSize: 137, Quantity: 14598538}},
+						PacksCount: 14598542,
+						Total:      2000000000,
+						Excess:     0,
+					},
+					{
+						Packs:      []order.Pack{{PackSize: 23, Quantity: 1}, {PackSize: 79, Quantity: 2}, {PackSize: 113, Quantity: 1}, {PackSize: 137, Quantity: 14598538}},
+						PacksCount: 14598542,
+						Total:      2000000000,
+						Excess:     0,
+					},
+				},
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "stock limited alternatives",
+			pid:  5,
+			order: order.Order{
+				PID:          5,
+				Qty:          500,
+				Alternatives: 2,
+			},
+			expected: order.Shipping{
+				PID:   5,
+				Order: 500,
+				Packs: []order.Pack{
+					{
+						PackSize: 31,
+						Quantity: 11,
+					},
+					{
+						PackSize: 53,
+						Quantity: 3,
+					},
+				},
+				PacksCount: 14,
+				Total:      500,
+				Excess:     0,
+				Alternatives: []order.Plan{
+					{
+						Packs:      []order.Pack{{PackSize: 31, Quantity: 11}, {PackSize: 53, Quantity: 3}},
+						PacksCount: 14,
+						Total:      500,
+						Excess:     0,
+					},
+					{
+						Packs:      []order.Pack{{PackSize: 23, Quantity: 5}, {PackSize: 31, Quantity: 9}, {PackSize: 53, Quantity: 2}},
+						PacksCount: 16,
+						Total:      500,
+						Excess:     0,
+					},
+				},
+			},
+			expectedError: assert.NoError,
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			optimizer := NewOptimizer(mockStorage{})
+			optimizer := NewOptimizer(mockStorage{}, mockStorage{})
 
 			res, err := optimizer.Calculate(ctx, tC.order)
 			tC.expectedError(t, err)
@@ -162,3 +543,240 @@ func TestShippingCalculateShipping(t *testing.T) {
 		})
 	}
 }
+
+type mockRecorder struct {
+	calculations [][2]int
+}
+
+func (m *mockRecorder) ObserveCalculation(pid, qty int, duration time.Duration) {
+	m.calculations = append(m.calculations, [2]int{pid, qty})
+}
+
+func TestShippingCalculateRecorder(t *testing.T) {
+	recorder := &mockRecorder{}
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithRecorder(recorder)
+
+	_, err := optimizer.Calculate(context.Background(), order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(context.Background(), order.Order{PID: 2, Qty: 1})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(context.Background(), order.Order{PID: 99, Qty: 12})
+	assert.Error(t, err)
+	_, err = optimizer.Calculate(context.Background(), order.Order{PID: 1})
+	assert.Error(t, err)
+
+	assert.Equal(t, [][2]int{{1, 12}, {2, 1}}, recorder.calculations)
+}
+
+func TestShippingCalculateRecorderCached(t *testing.T) {
+	recorder := &mockRecorder{}
+	cache := NewCache(10, 10)
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithRecorder(recorder).WithCache(cache)
+
+	// calculations served from the cache are recorded as the solved ones
+	_, err := optimizer.Calculate(context.Background(), order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(context.Background(), order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, cache.Stats().Hits)
+	assert.Equal(t, [][2]int{{1, 12}, {1, 12}}, recorder.calculations)
+}
+
+type mockLimiter struct {
+	capacity int
+	used     int
+	acquired *[]int
+}
+
+func (m mockLimiter) TryAcquire(weight int) (func(), bool) {
+	if m.used+weight > m.capacity {
+		return nil, false
+	}
+	*m.acquired = append(*m.acquired, weight)
+	return func() { *m.acquired = append(*m.acquired, -weight) }, true
+}
+
+func (m mockLimiter) Capacity() int {
+	return m.capacity
+}
+
+func TestShippingCalculateLimiter(t *testing.T) {
+	var acquired []int
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithLimiter(mockLimiter{capacity: 100, acquired: &acquired})
+
+	// calculations weigh the largest package along with the order quantity
+	res, err := optimizer.Calculate(context.Background(), order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, 12, res.Total)
+
+	// calculations weighing more than the whole capacity are never run
+	_, err = optimizer.Calculate(context.Background(), order.Order{PID: 1, Qty: 90})
+	assert.ErrorIs(t, err, order.ErrCalculationTooLarge)
+	_, err = optimizer.Calculate(context.Background(), order.Order{PID: 1, Qty: 12, Alternatives: 4})
+	assert.ErrorIs(t, err, order.ErrCalculationTooLarge)
+
+	// the acquired weight is released once calculated
+	assert.Equal(t, []int{24, -24}, acquired)
+
+	busy := NewOptimizer(mockStorage{}, mockStorage{}).WithLimiter(mockLimiter{capacity: 100, used: 80, acquired: &acquired})
+	_, err = busy.Calculate(context.Background(), order.Order{PID: 1, Qty: 12})
+	assert.ErrorIs(t, err, order.ErrOverloaded)
+}
+
+func TestSolveWeight(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		packs        []int
+		qty          int
+		alternatives int
+		expected     int
+	}{
+		{
+			desc:     "small order",
+			packs:    []int{5, 10, 12},
+			qty:      12,
+			expected: 24,
+		},
+		{
+			desc:     "large order of small packages",
+			packs:    []int{5, 10, 12},
+			qty:      1000000000,
+			expected: 1000012,
+		},
+		{
+			desc:     "small order of large packages",
+			packs:    []int{1000000, 999999},
+			qty:      1,
+			expected: 1000001,
+		},
+		{
+			desc:         "small order with alternatives",
+			packs:        []int{5, 10, 12},
+			qty:          12,
+			alternatives: 2,
+			expected:     72,
+		},
+		{
+			desc:     "no packages",
+			packs:    []int{},
+			qty:      12,
+			expected: 12,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, solveWeight(tC.packs, tC.qty, tC.alternatives))
+		})
+	}
+}
+
+func TestShippingCalculateCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(2, 1000000)
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithCache(cache)
+
+	first, err := optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	second, err := optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Entries: 1}, cache.Stats())
+
+	// cached calculations can't be changed by callers
+	second.Packs[0].Quantity = 99
+	third, _ := optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12})
+	assert.Equal(t, first, third)
+
+	// other versions, objectives and products tracking stock are calculated again
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12, Version: 1})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12, Alternatives: 2})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 5, Qty: 100})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 5, Qty: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 3, Entries: 2}, cache.Stats())
+
+	// the least recently used calculation was evicted
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 4, Entries: 2}, cache.Stats())
+
+	cache.Invalidate(1)
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
+
+func TestShippingCalculateCacheExtension(t *testing.T) {
+	ctx := context.Background()
+	cached := NewOptimizer(mockStorage{}, mockStorage{}).WithCache(NewCache(10, 1000000))
+	uncached := NewOptimizer(mockStorage{}, mockStorage{})
+
+	// increasing orders extend the checkpoints solved for the previous ones
+	for _, pid := range []int{1, 3, 4} {
+		for qty := 1; qty < 3000; qty += 7 {
+			for _, objective := range []order.Objective{order.MinExcess, order.MinCost} {
+				req := order.Order{PID: pid, Qty: qty, Objective: objective}
+				expected, expectedErr := uncached.Calculate(ctx, req)
+				res, err := cached.Calculate(ctx, req)
+				assert.Equal(t, expectedErr, err)
+				assert.Equal(t, expected, res)
+			}
+		}
+	}
+}
+
+func TestShippingCalculateCacheSolverEntries(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(10, 250)
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithCache(cache)
+
+	cachedSolvers := func() map[int]int {
+		entries := make(map[int]int)
+		for elem := cache.solvers.Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*solverEntry)
+			entries[entry.key.pid] = entry.solver.entries()
+		}
+		return entries
+	}
+
+	_, err := optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 12})
+	assert.NoError(t, err)
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 2, Qty: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]int{1: 29, 2: 181}, cachedSolvers())
+
+	// a solver growing beyond the bound evicts the least recently used ones and then itself
+	_, err = optimizer.Calculate(ctx, order.Order{PID: 3, Qty: 500})
+	assert.NoError(t, err)
+	assert.Empty(t, cachedSolvers())
+
+	res, err := optimizer.Calculate(ctx, order.Order{PID: 1, Qty: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, 30, res.Total)
+	assert.Equal(t, map[int]int{1: 49}, cachedSolvers())
+}
+
+func TestShippingCalculateCanceled(t *testing.T) {
+	cache := NewCache(10, 1000000)
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithCache(cache)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := optimizer.Calculate(canceled, order.Order{PID: 3, Qty: 500})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = optimizer.Calculate(expired, order.Order{PID: 5, Qty: 100})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = optimizer.Calculate(expired, order.Order{PID: 1, Qty: 12, Alternatives: 2})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// stopped calculations are neither cached nor leave partial tables behind
+	assert.Equal(t, 0, cache.Stats().Entries)
+	res, err := optimizer.Calculate(context.Background(), order.Order{PID: 3, Qty: 500})
+	assert.NoError(t, err)
+	assert.Equal(t, 500, res.Total)
+}
@@ -0,0 +1,118 @@
+package order
+
+import (
+	"cmp"
+	"context"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// Comparator provides the package sizes comparison service
+type Comparator struct {
+	storage Storage
+	limiter Limiter
+}
+
+// NewComparator returns an initialized Comparator
+func NewComparator(storage Storage) Comparator {
+	return Comparator{
+		storage: storage,
+	}
+}
+
+// WithLimiter method returns a copy of the Comparator rejecting comparisons once a limiter is exhausted
+// every comparison weighs the solver tables of both configurations, as they are solved together
+func (c Comparator) WithLimiter(limiter Limiter) Comparator {
+	c.limiter = limiter
+	return c
+}
+
+// Compare method solves every order quantity with the least excess plans of the stored and the proposed configurations
+// nothing is stored, the proposed configuration being only solved
+func (c Comparator) Compare(ctx context.Context, req order.ComparisonRequest) (order.Comparison, error) {
+	prd, err := c.storage.Product(req.PID)
+	if err != nil {
+		return order.Comparison{}, err
+	}
+	if len(prd.Packs) == 0 {
+		return order.Comparison{}, product.ErrNoPackSizes
+	}
+
+	var largestQty int
+	for _, qty := range req.Quantities {
+		largestQty = max(largestQty, qty)
+	}
+	release, err := acquire(c.limiter, solveWeight(prd.Packs, largestQty, 0)+solveWeight(req.Packs, largestQty, 0))
+	if err != nil {
+		instrumentation.ContextLogger(ctx).Warning("Comparison rejected", "pid", req.PID, "error", err)
+		return order.Comparison{}, err
+	}
+	defer release()
+
+	currentOptions := packOptions(prd.Packs, nil, false)
+	proposedOptions := packOptions(req.Packs, nil, false)
+	current, proposed := newSolver(currentOptions), newSolver(proposedOptions)
+
+	res := order.Comparison{
+		PID:      req.PID,
+		Version:  prd.Version,
+		Current:  optionSizes(currentOptions),
+		Proposed: optionSizes(proposedOptions),
+		Orders:   make([]order.QtyComparison, len(req.Quantities)),
+	}
+	for i, qty := range req.Quantities {
+		currentPlan, err := current.optimize(ctx, qty, currentOptions[0].size-1)
+		if err != nil {
+			return order.Comparison{}, err
+		}
+		proposedPlan, err := proposed.optimize(ctx, qty, proposedOptions[0].size-1)
+		if err != nil {
+			return order.Comparison{}, err
+		}
+
+		res.Orders[i] = order.QtyComparison{
+			Qty:      qty,
+			Current:  comparedPlan(currentPlan, qty),
+			Proposed: comparedPlan(proposedPlan, qty),
+		}
+		res.CurrentExcess += currentPlan.total - qty
+		res.ProposedExcess += proposedPlan.total - qty
+		res.CurrentPacks += currentPlan.packsCount
+		res.ProposedPacks += proposedPlan.packsCount
+
+		switch cmp.Or(cmp.Compare(proposedPlan.total, currentPlan.total), cmp.Compare(proposedPlan.packsCount, currentPlan.packsCount)) {
+		case -1:
+			res.Better++
+		case 1:
+			res.Worse++
+		default:
+			res.Unchanged++
+		}
+	}
+
+	instrumentation.ContextLogger(ctx).Debug("Package sizes compared", "pid", req.PID, "version", prd.Version, "orders", len(req.Quantities))
+
+	return res, nil
+}
+
+// optionSizes returns the package sizes of some options
+func optionSizes(options []packOption) []int {
+	sizes := make([]int, len(options))
+	for i, option := range options {
+		sizes[i] = option.size
+	}
+
+	return sizes
+}
+
+// comparedPlan converts a plan solved for an order quantity, costs being ignored by comparisons
+func comparedPlan(p plan, qty int) order.Plan {
+	return order.Plan{
+		Packs:      p.packs,
+		PacksCount: p.packsCount,
+		Total:      p.total,
+		Excess:     p.total - qty,
+	}
+}
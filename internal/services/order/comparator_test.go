@@ -0,0 +1,102 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		req           order.ComparisonRequest
+		expected      order.Comparison
+		expectedError error
+	}{
+		{
+			desc: "orders getting better, worse and unchanged",
+			req:  order.ComparisonRequest{PID: 1, Packs: []int{10, 6, 10}, Quantities: []int{6, 12, 15, 20}},
+			expected: order.Comparison{
+				PID:      1,
+				Current:  []int{5, 10, 12},
+				Proposed: []int{6, 10},
+				Orders: []order.QtyComparison{
+					{
+						Qty:      6,
+						Current:  order.Plan{Packs: []order.Pack{{PackSize: 10, Quantity: 1}}, PacksCount: 1, Total: 10, Excess: 4},
+						Proposed: order.Plan{Packs: []order.Pack{{PackSize: 6, Quantity: 1}}, PacksCount: 1, Total: 6, Excess: 0},
+					},
+					{
+						Qty:      12,
+						Current:  order.Plan{Packs: []order.Pack{{PackSize: 12, Quantity: 1}}, PacksCount: 1, Total: 12, Excess: 0},
+						Proposed: order.Plan{Packs: []order.Pack{{PackSize: 6, Quantity: 2}}, PacksCount: 2, Total: 12, Excess: 0},
+					},
+					{
+						Qty:      15,
+						Current:  order.Plan{Packs: []order.Pack{{PackSize: 5, Quantity: 1}, {PackSize: 10, Quantity: 1}}, PacksCount: 2, Total: 15, Excess: 0},
+						Proposed: order.Plan{Packs: []order.Pack{{PackSize: 6, Quantity: 1}, {PackSize: 10, Quantity: 1}}, PacksCount: 2, Total: 16, Excess: 1},
+					},
+					{
+						Qty:      20,
+						Current:  order.Plan{Packs: []order.Pack{{PackSize: 10, Quantity: 2}}, PacksCount: 2, Total: 20, Excess: 0},
+						Proposed: order.Plan{Packs: []order.Pack{{PackSize: 10, Quantity: 2}}, PacksCount: 2, Total: 20, Excess: 0},
+					},
+				},
+				CurrentExcess:  4,
+				ProposedExcess: 1,
+				CurrentPacks:   6,
+				ProposedPacks:  7,
+				Better:         1,
+				Worse:          2,
+				Unchanged:      1,
+			},
+		},
+		{
+			desc:          "stored configuration without sizes",
+			req:           order.ComparisonRequest{PID: 0, Packs: []int{5}, Quantities: []int{10}},
+			expectedError: product.ErrNoPackSizes,
+		},
+		{
+			desc:          "storage error",
+			req:           order.ComparisonRequest{PID: 99, Packs: []int{5}, Quantities: []int{10}},
+			expectedError: errors.New("error"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := NewComparator(mockStorage{}).Compare(context.Background(), tC.req)
+
+			assert.Equal(t, tC.expected, res)
+			assert.Equal(t, tC.expectedError, err)
+		})
+	}
+}
+
+func TestCompareLimiter(t *testing.T) {
+	req := order.ComparisonRequest{PID: 1, Packs: []int{6, 9, 20}, Quantities: []int{40, 12}}
+
+	// comparisons weigh the largest package of both configurations along with the largest order
+	var acquired []int
+	_, err := NewComparator(mockStorage{}).WithLimiter(mockLimiter{capacity: 200, acquired: &acquired}).Compare(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{112, -112}, acquired)
+
+	_, err = NewComparator(mockStorage{}).WithLimiter(mockLimiter{capacity: 100, acquired: &acquired}).Compare(context.Background(), req)
+	assert.ErrorIs(t, err, order.ErrCalculationTooLarge)
+
+	_, err = NewComparator(mockStorage{}).WithLimiter(mockLimiter{capacity: 200, used: 100, acquired: &acquired}).Compare(context.Background(), req)
+	assert.ErrorIs(t, err, order.ErrOverloaded)
+}
+
+func TestCompareCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewComparator(mockStorage{}).Compare(ctx, order.ComparisonRequest{PID: 3, Packs: []int{1000003, 999983}, Quantities: []int{1000000}})
+	assert.ErrorIs(t, err, context.Canceled)
+}
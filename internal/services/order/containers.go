@@ -0,0 +1,111 @@
+package order
+
+import (
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+)
+
+// a containerPart holds how many items of a run are held by a container
+type containerPart struct {
+	run int
+	qty int
+}
+
+// a filledContainer holds the parts of identical containers and how many of them there are
+type filledContainer struct {
+	count int
+	parts []containerPart
+	used  int
+}
+
+// nestContainers packs the packages of a plan into the packaging levels of a product, from the innermost one
+// the packages are kept as planned, so only the amount of containers of each level is minimized
+// it returns the containers of the outermost level, holding the ones of the levels below, and the usage of every level
+func nestContainers(levels []product.ContainerLevel, packs []order.Pack) ([]order.Container, []order.LevelUsage) {
+	if len(levels) == 0 {
+		return nil, nil
+	}
+
+	// larger packages are packed first, so that full containers of the same packages are grouped
+	var runs []int
+	var packRuns []order.Pack
+	for i := len(packs) - 1; i >= 0; i-- {
+		if packs[i].Quantity > 0 {
+			runs = append(runs, packs[i].Quantity)
+			packRuns = append(packRuns, packs[i])
+		}
+	}
+
+	var (
+		containers []order.Container
+		usage      = make([]order.LevelUsage, len(levels))
+	)
+	for l, level := range levels {
+		filled := fillContainers(runs, level.Capacity)
+
+		nested := make([]order.Container, len(filled))
+		runs = make([]int, len(filled))
+		usage[l] = order.LevelUsage{Level: level.Name, Capacity: level.Capacity}
+		for i, fc := range filled {
+			nested[i] = order.Container{
+				Level:  level.Name,
+				Count:  fc.count,
+				Unused: level.Capacity - fc.used,
+			}
+			for _, part := range fc.parts {
+				if l == 0 {
+					nested[i].Packs = append(nested[i].Packs, order.Pack{PackSize: packRuns[part.run].PackSize, Quantity: part.qty})
+					continue
+				}
+
+				content := containers[part.run]
+				content.Count = part.qty
+				nested[i].Contents = append(nested[i].Contents, content)
+			}
+
+			runs[i] = fc.count
+			usage[l].Containers += fc.count
+			usage[l].Unused += fc.count * nested[i].Unused
+		}
+
+		containers = nested
+	}
+
+	return containers, usage
+}
+
+// fillContainers distributes runs of identical items, in order, into containers holding up to capacity items
+// whole containers of a single run are grouped together, so that large runs result in few distinct containers
+func fillContainers(runs []int, capacity int) []filledContainer {
+	var (
+		filled  []filledContainer
+		current filledContainer
+	)
+	for run, qty := range runs {
+		for qty > 0 {
+			if current.used == 0 && qty >= capacity {
+				n := qty / capacity
+				filled = append(filled, filledContainer{count: n, parts: []containerPart{{run: run, qty: capacity}}, used: capacity})
+				qty -= n * capacity
+				continue
+			}
+
+			take := min(qty, capacity-current.used)
+			current.parts = append(current.parts, containerPart{run: run, qty: take})
+			current.used += take
+			qty -= take
+
+			if current.used == capacity {
+				current.count = 1
+				filled = append(filled, current)
+				current = filledContainer{}
+			}
+		}
+	}
+	if current.used > 0 {
+		current.count = 1
+		filled = append(filled, current)
+	}
+
+	return filled
+}
@@ -0,0 +1,104 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNestContainers(t *testing.T) {
+	cartons := product.ContainerLevel{Name: "carton", Capacity: 10}
+	pallets := product.ContainerLevel{Name: "pallet", Capacity: 2}
+	fullCarton := order.Container{Level: "carton", Count: 2, Packs: []order.Pack{{PackSize: 12, Quantity: 10}}}
+	mixedCarton := order.Container{Level: "carton", Count: 1, Packs: []order.Pack{{PackSize: 12, Quantity: 3}, {PackSize: 10, Quantity: 5}}, Unused: 2}
+
+	testCases := []struct {
+		desc               string
+		levels             []product.ContainerLevel
+		packs              []order.Pack
+		expectedContainers []order.Container
+		expectedUsage      []order.LevelUsage
+	}{
+		{
+			desc:  "no packaging levels",
+			packs: []order.Pack{{PackSize: 12, Quantity: 23}},
+		},
+		{
+			desc:   "single level",
+			levels: []product.ContainerLevel{cartons},
+			packs:  []order.Pack{{PackSize: 5, Quantity: 0}, {PackSize: 10, Quantity: 5}, {PackSize: 12, Quantity: 23}},
+			expectedContainers: []order.Container{
+				fullCarton,
+				mixedCarton,
+			},
+			expectedUsage: []order.LevelUsage{
+				{Level: "carton", Capacity: 10, Containers: 3, Unused: 2},
+			},
+		},
+		{
+			desc:   "nested levels",
+			levels: []product.ContainerLevel{cartons, pallets},
+			packs:  []order.Pack{{PackSize: 10, Quantity: 5}, {PackSize: 12, Quantity: 23}},
+			expectedContainers: []order.Container{
+				{Level: "pallet", Count: 1, Contents: []order.Container{fullCarton}},
+				{Level: "pallet", Count: 1, Contents: []order.Container{mixedCarton}, Unused: 1},
+			},
+			expectedUsage: []order.LevelUsage{
+				{Level: "carton", Capacity: 10, Containers: 3, Unused: 2},
+				{Level: "pallet", Capacity: 2, Containers: 2, Unused: 1},
+			},
+		},
+		{
+			desc:   "containers of different contents sharing a container",
+			levels: []product.ContainerLevel{{Name: "carton", Capacity: 2}, {Name: "pallet", Capacity: 4}},
+			packs:  []order.Pack{{PackSize: 250, Quantity: 1}, {PackSize: 500, Quantity: 2}},
+			expectedContainers: []order.Container{
+				{Level: "pallet", Count: 1, Unused: 2, Contents: []order.Container{
+					{Level: "carton", Count: 1, Packs: []order.Pack{{PackSize: 500, Quantity: 2}}},
+					{Level: "carton", Count: 1, Packs: []order.Pack{{PackSize: 250, Quantity: 1}}, Unused: 1},
+				}},
+			},
+			expectedUsage: []order.LevelUsage{
+				{Level: "carton", Capacity: 2, Containers: 2, Unused: 1},
+				{Level: "pallet", Capacity: 4, Containers: 1, Unused: 2},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			containers, usage := nestContainers(tC.levels, tC.packs)
+
+			assert.Equal(t, tC.expectedContainers, containers)
+			assert.Equal(t, tC.expectedUsage, usage)
+		})
+	}
+}
+
+func TestShippingCalculateContainers(t *testing.T) {
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithCache(NewCache(10, 1000000))
+
+	expectedContainers := []order.Container{
+		{Level: "pallet", Count: 1, Unused: 6, Contents: []order.Container{
+			{Level: "carton", Count: 3, Packs: []order.Pack{{PackSize: 1000, Quantity: 4}}},
+			{Level: "carton", Count: 1, Packs: []order.Pack{{PackSize: 250, Quantity: 1}}, Unused: 3},
+		}},
+	}
+	expectedLevels := []order.LevelUsage{
+		{Level: "carton", Capacity: 4, Containers: 4, Unused: 3},
+		{Level: "pallet", Capacity: 10, Containers: 1, Unused: 6},
+	}
+
+	// the unit level plan stays the least excess one, and cached calculations are nested as well
+	for range 2 {
+		res, err := optimizer.Calculate(context.Background(), order.Order{PID: 7, Qty: 12001})
+		assert.NoError(t, err)
+		assert.Equal(t, 12250, res.Total)
+		assert.Equal(t, 13, res.PacksCount)
+		assert.Equal(t, expectedContainers, res.Containers)
+		assert.Equal(t, expectedLevels, res.Levels)
+	}
+}
@@ -0,0 +1,41 @@
+package order
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+)
+
+// CalculateLines method calculates the best packages distribution for every line of a multi product order
+// Lines are calculated concurrently by a bounded amount of workers
+// Once the context is done the lines still not calculated fail with the context error
+func (o Optimizer) CalculateLines(ctx context.Context, lines []order.Order) []order.LineShipping {
+	results := make([]order.LineShipping, len(lines))
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(runtime.GOMAXPROCS(0), len(lines)) {
+		wg.Go(func() {
+			for i := range indexes {
+				err := ctx.Err()
+				if err != nil {
+					results[i].Err = err
+					continue
+				}
+
+				results[i].Shipping, results[i].Err = o.Calculate(ctx, lines[i])
+			}
+		})
+	}
+
+	for i := range lines {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,101 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShippingCalculateLines(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	lines := []order.Order{
+		{
+			PID: 1,
+			Qty: 21,
+		},
+		{
+			PID: -1,
+			Qty: 21,
+		},
+		{
+			PID: 2,
+			Qty: 500000,
+		},
+	}
+
+	testCases := []struct {
+		desc           string
+		ctx            context.Context
+		expected       []order.Shipping
+		expectedErrors []assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "lines calculation",
+			ctx:  context.Background(),
+			expected: []order.Shipping{
+				{
+					PID:   1,
+					Order: 21,
+					Packs: []order.Pack{
+						{
+							PackSize: 10,
+							Quantity: 1,
+						},
+						{
+							PackSize: 12,
+							Quantity: 1,
+						},
+					},
+					PacksCount: 2,
+					Total:      22,
+					Excess:     1,
+				},
+				{},
+				{
+					PID:   2,
+					Order: 500000,
+					Packs: []order.Pack{
+						{
+							PackSize: 23,
+							Quantity: 2,
+						},
+						{
+							PackSize: 31,
+							Quantity: 7,
+						},
+						{
+							PackSize: 53,
+							Quantity: 9429,
+						},
+					},
+					PacksCount: 9438,
+					Total:      500000,
+					Excess:     0,
+				},
+			},
+			expectedErrors: []assert.ErrorAssertionFunc{assert.NoError, assert.Error, assert.NoError},
+		},
+		{
+			desc:           "cancelled context",
+			ctx:            cancelled,
+			expected:       []order.Shipping{{}, {}, {}},
+			expectedErrors: []assert.ErrorAssertionFunc{assert.Error, assert.Error, assert.Error},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			optimizer := NewOptimizer(mockStorage{}, mockStorage{})
+
+			res := optimizer.CalculateLines(tC.ctx, lines)
+			assert.Len(t, res, len(lines))
+			for i, line := range res {
+				tC.expectedErrors[i](t, line.Err)
+				assert.Equal(t, tC.expected[i], line.Shipping)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package order
+
+import (
+	"context"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// CalculateRange method calculates the least excess shipping of every order of a range, giving each one to emit in ascending order
+// the package options are solved once and every order is backtracked from the same tables
+// stock levels are ignored, as range plans are prepared ahead of the orders
+// calculations stop at the first error returned by emit or once the context is done
+func (o Optimizer) CalculateRange(ctx context.Context, req order.RangeOrder, emit func(order.Shipping) error) error {
+	if req.From <= 0 || req.To < req.From {
+		return order.ErrEmptyOrder
+	}
+
+	prd, err := o.productVersion(req.PID, req.Version)
+	if err != nil {
+		return err
+	}
+	if len(prd.Packs) == 0 {
+		return product.ErrNoPackSizes
+	}
+
+	release, err := acquire(o.limiter, solveWeight(prd.Packs, req.To, 0))
+	if err != nil {
+		instrumentation.ContextLogger(ctx).Warning("Range calculation rejected", "pid", req.PID, "from", req.From, "to", req.To, "error", err)
+		return err
+	}
+	defer release()
+
+	costs := prd.PackCosts()
+	options := packOptions(prd.Packs, costs, false)
+	maxExcess := options[0].size - 1
+
+	slv := newSolver(options)
+	if o.cache != nil {
+		slv = o.cache.solver(solverKey{pid: req.PID, fingerprint: fingerprint(prd)}, options)
+		defer o.cache.trimSolvers()
+	}
+
+	for qty := req.From; qty <= req.To; qty++ {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		best, err := slv.optimize(ctx, qty, maxExcess)
+		if err != nil {
+			return err
+		}
+
+		err = emit(order.Shipping{
+			PID:        req.PID,
+			Version:    prd.Version,
+			Order:      qty,
+			Packs:      best.packs,
+			PacksCount: best.packsCount,
+			Total:      best.total,
+			Excess:     best.total - qty,
+			Cost:       packsCost(best.packs, costs),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	instrumentation.ContextLogger(ctx).Debug("Shipping range calculated", "pid", req.PID, "version", prd.Version, "from", req.From, "to", req.To)
+
+	return nil
+}
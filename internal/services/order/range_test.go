@@ -0,0 +1,121 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShippingCalculateRange(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		req           order.RangeOrder
+		expected      []order.Shipping
+		expectedError error
+	}{
+		{
+			desc: "every order of the range",
+			req:  order.RangeOrder{PID: 1, From: 11, To: 13},
+			expected: []order.Shipping{
+				{PID: 1, Order: 11, Packs: []order.Pack{{PackSize: 12, Quantity: 1}}, PacksCount: 1, Total: 12, Excess: 1},
+				{PID: 1, Order: 12, Packs: []order.Pack{{PackSize: 12, Quantity: 1}}, PacksCount: 1, Total: 12, Excess: 0},
+				{PID: 1, Order: 13, Packs: []order.Pack{{PackSize: 5, Quantity: 1}, {PackSize: 10, Quantity: 1}}, PacksCount: 2, Total: 15, Excess: 2},
+			},
+		},
+		{
+			desc: "given version",
+			req:  order.RangeOrder{PID: 1, From: 12, To: 12, Version: 1},
+			expected: []order.Shipping{
+				{PID: 1, Version: 1, Order: 12, Packs: []order.Pack{{PackSize: 5, Quantity: 1}, {PackSize: 10, Quantity: 1}}, PacksCount: 2, Total: 15, Excess: 3},
+			},
+		},
+		{
+			desc:          "empty range",
+			req:           order.RangeOrder{PID: 1, From: 12, To: 11},
+			expectedError: order.ErrEmptyOrder,
+		},
+		{
+			desc:          "version not found",
+			req:           order.RangeOrder{PID: 1, From: 1, To: 10, Version: 2},
+			expectedError: product.ErrVersionNotFound,
+		},
+		{
+			desc:          "configuration without sizes",
+			req:           order.RangeOrder{PID: 0, From: 1, To: 10},
+			expectedError: product.ErrNoPackSizes,
+		},
+		{
+			desc:          "storage error",
+			req:           order.RangeOrder{PID: 99, From: 1, To: 10},
+			expectedError: errors.New("error"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var res []order.Shipping
+			err := NewOptimizer(mockStorage{}, mockStorage{}).CalculateRange(context.Background(), tC.req, func(shipping order.Shipping) error {
+				res = append(res, shipping)
+				return nil
+			})
+
+			assert.Equal(t, tC.expectedError, err)
+			assert.Equal(t, tC.expected, res)
+		})
+	}
+}
+
+func TestShippingCalculateRangeMatchesCalculate(t *testing.T) {
+	ctx := context.Background()
+	optimizer := NewOptimizer(mockStorage{}, mockStorage{}).WithCache(NewCache(10, 1000000))
+
+	var res []order.Shipping
+	err := optimizer.CalculateRange(ctx, order.RangeOrder{PID: 3, From: 1, To: 2000}, func(shipping order.Shipping) error {
+		res = append(res, shipping)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 2000)
+
+	for _, shipping := range res {
+		expected, err := NewOptimizer(mockStorage{}, mockStorage{}).Calculate(ctx, order.Order{PID: 3, Qty: shipping.Order})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, shipping)
+	}
+}
+
+func TestShippingCalculateRangeStopped(t *testing.T) {
+	emitErr := errors.New("client gone")
+	var emitted int
+	err := NewOptimizer(mockStorage{}, mockStorage{}).CalculateRange(context.Background(), order.RangeOrder{PID: 1, From: 1, To: 100}, func(order.Shipping) error {
+		emitted++
+		if emitted == 3 {
+			return emitErr
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, emitErr)
+	assert.Equal(t, 3, emitted)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = NewOptimizer(mockStorage{}, mockStorage{}).CalculateRange(ctx, order.RangeOrder{PID: 1, From: 1, To: 100}, func(order.Shipping) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var acquired []int
+	err = NewOptimizer(mockStorage{}, mockStorage{}).WithLimiter(mockLimiter{capacity: 50, acquired: &acquired}).CalculateRange(context.Background(), order.RangeOrder{PID: 1, From: 1, To: 100}, func(order.Shipping) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, order.ErrCalculationTooLarge)
+
+	err = NewOptimizer(mockStorage{}, mockStorage{}).WithLimiter(mockLimiter{capacity: 500, used: 400, acquired: &acquired}).CalculateRange(context.Background(), order.RangeOrder{PID: 1, From: 1, To: 100}, func(order.Shipping) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, order.ErrOverloaded)
+}
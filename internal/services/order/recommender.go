@@ -0,0 +1,180 @@
+package order
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// maxRecommendCandidates is the highest amount of candidate sizes searched, evenly spread between the size bounds
+const maxRecommendCandidates = 100
+
+// recommendBeamWidth is how many of the best sets of each amount of sizes are extended with one more size
+const recommendBeamWidth = 8
+
+// Recommender provides the package sizes recommendation service
+type Recommender struct {
+	storage Storage
+	limiter Limiter
+}
+
+// NewRecommender returns an initialized Recommender
+func NewRecommender(storage Storage) Recommender {
+	return Recommender{
+		storage: storage,
+	}
+}
+
+// WithLimiter method returns a copy of the Recommender rejecting recommendations once a limiter is exhausted
+// every recommendation weighs the solver tables of its largest set, the sets being solved one at a time
+func (rc Recommender) WithLimiter(limiter Limiter) Recommender {
+	rc.limiter = limiter
+	return rc
+}
+
+// Recommend method searches the package sizes sets minimizing the expected excess and then packages of the least excess plans
+// sets are grown one size at a time from the best ones found with one size less, and compared to the stored configuration if any
+func (rc Recommender) Recommend(ctx context.Context, req order.RecommendationRequest) (order.Recommendation, error) {
+	// orders are solved in ascending quantity so that every set extends its checkpoints instead of solving them again
+	demand := slices.SortedFunc(slices.Values(req.Demand), func(a, b order.Demand) int {
+		return cmp.Compare(a.Qty, b.Qty)
+	})
+
+	res := order.Recommendation{
+		PID:  req.PID,
+		Sets: []order.PackSetMetrics{},
+	}
+
+	prd, err := rc.storage.Product(req.PID)
+	if err != nil && !errors.Is(err, product.ErrProductNotFound) {
+		return order.Recommendation{}, err
+	}
+
+	// no set has a package larger than the stored ones or the upper size bound, nor solves orders past the largest one
+	var largestQty int
+	if len(demand) > 0 {
+		largestQty = demand[len(demand)-1].Qty
+	}
+	release, err := acquire(rc.limiter, solveWeight(append(slices.Clone(prd.Packs), req.MaxSize), largestQty, 0))
+	if err != nil {
+		instrumentation.ContextLogger(ctx).Warning("Recommendation rejected", "pid", req.PID, "error", err)
+		return order.Recommendation{}, err
+	}
+	defer release()
+
+	if len(prd.Packs) > 0 {
+		current, err := evaluatePackSet(ctx, prd.Packs, demand)
+		if err != nil {
+			return order.Recommendation{}, err
+		}
+		res.Version = prd.Version
+		res.Current = &current
+	}
+
+	candidates := candidateSizes(req.MinSize, req.MaxSize)
+	evaluated := make(map[string]bool)
+	beam := [][]int{{}}
+	for range req.MaxSizes {
+		var grown []order.PackSetMetrics
+		for _, set := range beam {
+			for _, size := range candidates {
+				if slices.Contains(set, size) {
+					continue
+				}
+
+				packs := append(slices.Clone(set), size)
+				slices.Sort(packs)
+				key := fmt.Sprint(packs)
+				if evaluated[key] {
+					continue
+				}
+				evaluated[key] = true
+
+				metrics, err := evaluatePackSet(ctx, packs, demand)
+				if err != nil {
+					return order.Recommendation{}, err
+				}
+				grown = append(grown, metrics)
+			}
+		}
+		if len(grown) == 0 {
+			break
+		}
+
+		slices.SortStableFunc(grown, comparePackSets)
+		beam = beam[:0]
+		for _, metrics := range grown[:min(recommendBeamWidth, len(grown))] {
+			beam = append(beam, metrics.Packs)
+		}
+
+		res.Sets = append(res.Sets, grown[:min(req.Results, len(grown))]...)
+		slices.SortStableFunc(res.Sets, comparePackSets)
+		res.Sets = res.Sets[:min(req.Results, len(res.Sets))]
+	}
+
+	instrumentation.ContextLogger(ctx).Debug("Package sizes recommended", "pid", req.PID, "sets", len(evaluated))
+
+	return res, nil
+}
+
+// comparePackSets ranks sets by expected excess, then by expected packages and then by the least amount of sizes
+func comparePackSets(a, b order.PackSetMetrics) int {
+	return cmp.Or(
+		cmp.Compare(a.ExpectedExcess, b.ExpectedExcess),
+		cmp.Compare(a.ExpectedPacks, b.ExpectedPacks),
+		cmp.Compare(len(a.Packs), len(b.Packs)),
+	)
+}
+
+// candidateSizes returns the sizes searched between the bounds, spreading them evenly when there are too many
+func candidateSizes(minSize, maxSize int) []int {
+	count := maxSize - minSize + 1
+	if count <= maxRecommendCandidates {
+		sizes := make([]int, count)
+		for i := range sizes {
+			sizes[i] = minSize + i
+		}
+		return sizes
+	}
+
+	sizes := make([]int, maxRecommendCandidates)
+	for i := range sizes {
+		sizes[i] = minSize + i*(maxSize-minSize)/(maxRecommendCandidates-1)
+	}
+
+	return slices.Compact(sizes)
+}
+
+// evaluatePackSet calculates the metrics of the least excess plans of a package sizes set for an expected demand sorted by quantity
+func evaluatePackSet(ctx context.Context, sizes []int, demand []order.Demand) (order.PackSetMetrics, error) {
+	options := packOptions(sizes, nil, false)
+	slv := newSolver(options)
+
+	var excess, packs, orders int
+	for _, d := range demand {
+		best, err := slv.optimize(ctx, d.Qty, options[0].size-1)
+		if err != nil {
+			return order.PackSetMetrics{}, err
+		}
+
+		excess += (best.total - d.Qty) * d.Count
+		packs += best.packsCount * d.Count
+		orders += d.Count
+	}
+
+	metrics := order.PackSetMetrics{
+		Packs: optionSizes(options),
+	}
+	if orders > 0 {
+		metrics.ExpectedExcess = float64(excess) / float64(orders)
+		metrics.ExpectedPacks = float64(packs) / float64(orders)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,117 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/order"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommend(t *testing.T) {
+	demand := []order.Demand{{Qty: 20, Count: 1}, {Qty: 10, Count: 3}}
+
+	testCases := []struct {
+		desc          string
+		req           order.RecommendationRequest
+		expected      order.Recommendation
+		expectedError error
+	}{
+		{
+			desc: "single size sets compared to the stored configuration",
+			req:  order.RecommendationRequest{PID: 1, Demand: demand, MaxSizes: 1, MinSize: 5, MaxSize: 12, Results: 2},
+			expected: order.Recommendation{
+				PID:     1,
+				Current: &order.PackSetMetrics{Packs: []int{5, 10, 12}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+				Sets: []order.PackSetMetrics{
+					{Packs: []int{10}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+					{Packs: []int{5}, ExpectedExcess: 0, ExpectedPacks: 2.5},
+				},
+			},
+		},
+		{
+			desc: "smaller sets ranked first on ties",
+			req:  order.RecommendationRequest{PID: 1, Demand: demand, MaxSizes: 2, MinSize: 5, MaxSize: 12, Results: 2},
+			expected: order.Recommendation{
+				PID:     1,
+				Current: &order.PackSetMetrics{Packs: []int{5, 10, 12}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+				Sets: []order.PackSetMetrics{
+					{Packs: []int{10}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+					{Packs: []int{5, 10}, ExpectedExcess: 0, ExpectedPacks: 1.25},
+				},
+			},
+		},
+		{
+			desc: "excess minimized before packages",
+			req:  order.RecommendationRequest{PID: 0, Demand: []order.Demand{{Qty: 7, Count: 1}}, MaxSizes: 2, MinSize: 3, MaxSize: 8, Results: 1},
+			expected: order.Recommendation{
+				PID: 0,
+				Sets: []order.PackSetMetrics{
+					{Packs: []int{7}, ExpectedExcess: 0, ExpectedPacks: 1},
+				},
+			},
+		},
+		{
+			desc:          "storage error",
+			req:           order.RecommendationRequest{PID: 99, Demand: demand, MaxSizes: 1, MinSize: 5, MaxSize: 12, Results: 2},
+			expectedError: errors.New("error"),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, err := NewRecommender(mockStorage{}).Recommend(context.Background(), tC.req)
+
+			assert.Equal(t, tC.expected, res)
+			assert.Equal(t, tC.expectedError, err)
+		})
+	}
+}
+
+func TestRecommendCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewRecommender(mockStorage{}).Recommend(ctx, order.RecommendationRequest{
+		PID:      0,
+		Demand:   []order.Demand{{Qty: 1000, Count: 1}},
+		MaxSizes: 3,
+		MinSize:  1,
+		MaxSize:  1000,
+		Results:  3,
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRecommendLimiter(t *testing.T) {
+	req := order.RecommendationRequest{
+		PID:      1,
+		Demand:   []order.Demand{{Qty: 40, Count: 1}, {Qty: 12, Count: 2}},
+		MaxSizes: 2,
+		MinSize:  1,
+		MaxSize:  20,
+		Results:  3,
+	}
+
+	// recommendations weigh the largest package of any set along with the largest order
+	var acquired []int
+	_, err := NewRecommender(mockStorage{}).WithLimiter(mockLimiter{capacity: 100, acquired: &acquired}).Recommend(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{60, -60}, acquired)
+
+	_, err = NewRecommender(mockStorage{}).WithLimiter(mockLimiter{capacity: 50, acquired: &acquired}).Recommend(context.Background(), req)
+	assert.ErrorIs(t, err, order.ErrCalculationTooLarge)
+
+	_, err = NewRecommender(mockStorage{}).WithLimiter(mockLimiter{capacity: 100, used: 80, acquired: &acquired}).Recommend(context.Background(), req)
+	assert.ErrorIs(t, err, order.ErrOverloaded)
+}
+
+func TestCandidateSizes(t *testing.T) {
+	assert.Equal(t, []int{3, 4, 5}, candidateSizes(3, 5))
+
+	sizes := candidateSizes(1, 1000)
+	assert.Len(t, sizes, maxRecommendCandidates)
+	assert.Equal(t, 1, sizes[0])
+	assert.Equal(t, 1000, sizes[len(sizes)-1])
+}
@@ -0,0 +1,113 @@
+package order
+
+import (
+	"container/heap"
+	"context"
+)
+
+// a residueNode holds the best known way of reaching a given residue modulo the fill package
+// costWeight and countWeight accumulate how far each package is from the fill one in cost and count per unit
+// total is the smallest order quantity that reaches the residue with those weights
+type residueNode struct {
+	reached     bool
+	costWeight  int
+	countWeight int
+	total       int
+}
+
+// residues maps every residue modulo the fill package to its best reaching combination
+// bound is the order quantity above which every residue node is valid for any total in its class
+type residues struct {
+	nodes []residueNode
+	bound int
+}
+
+// shortestResidues calculates the residues modulo the fill package of a sorted package options set
+// any total t above the bound is reachable whenever its residue is, using the residue total and
+// (t - total) / fill.size packages of the fill size, with the best possible cost and amount of packages
+func shortestResidues(ctx context.Context, options []packOption, fill packOption) (residues, error) {
+	nodes := make([]residueNode, fill.size)
+	nodes[0].reached = true
+
+	// dijkstra over the residues ordering by cost weight, count weight and total
+	// the fill package has the least cost per unit so no weight is ever negative
+	done := make([]bool, fill.size)
+	queue := &residueQueue{{}}
+	for step := 0; queue.Len() > 0; step++ {
+		err := checkCanceled(ctx, step)
+		if err != nil {
+			return residues{}, err
+		}
+
+		item := heap.Pop(queue).(residueItem)
+		if done[item.residue] {
+			continue
+		}
+		done[item.residue] = true
+
+		for _, option := range options {
+			if option.size == fill.size {
+				continue
+			}
+
+			next := residueItem{
+				residue: (item.residue + option.size) % fill.size,
+				residueNode: residueNode{
+					reached:     true,
+					costWeight:  item.costWeight + fill.size*option.cost - option.size*fill.cost,
+					countWeight: item.countWeight + fill.size - option.size,
+					total:       item.total + option.size,
+				},
+			}
+
+			node := &nodes[next.residue]
+			if done[next.residue] || node.reached && !next.less(*node) {
+				continue
+			}
+
+			*node = next.residueNode
+			heap.Push(queue, next)
+		}
+	}
+
+	var bound int
+	for _, node := range nodes {
+		if node.reached && node.total > bound {
+			bound = node.total
+		}
+	}
+
+	return residues{
+		nodes: nodes,
+		bound: bound,
+	}, nil
+}
+
+func (n residueNode) less(other residueNode) bool {
+	if n.costWeight != other.costWeight {
+		return n.costWeight < other.costWeight
+	}
+	if n.countWeight != other.countWeight {
+		return n.countWeight < other.countWeight
+	}
+	return n.total < other.total
+}
+
+type residueItem struct {
+	residueNode
+	residue int
+}
+
+// residueQueue implements heap.Interface ordering the residues to be visited
+type residueQueue []residueItem
+
+func (q residueQueue) Len() int           { return len(q) }
+func (q residueQueue) Less(i, j int) bool { return q[i].less(q[j].residueNode) }
+func (q residueQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *residueQueue) Push(x any)        { *q = append(*q, x.(residueItem)) }
+func (q *residueQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
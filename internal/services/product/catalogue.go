@@ -0,0 +1,78 @@
+package product
+
+import (
+	"context"
+	"slices"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// Export method retrieves the latest package sizes set of every product, in product id order
+func (c Configurator) Export(ctx context.Context) []product.Product {
+	products := c.storage.Products()
+	for i, prd := range products {
+		products[i] = product.Product{
+			PID:        prd.PID,
+			Packs:      prd.Packs,
+			Costs:      prd.Costs,
+			Containers: prd.Containers,
+			Version:    prd.Version,
+		}
+	}
+
+	return products
+}
+
+// List method retrieves the latest package sizes set of up to limit products with a product id above a cursor, in product id order
+// it also returns the cursor of the following page, the last listed product id, or 0 when there are no more products
+func (c Configurator) List(ctx context.Context, cursor, limit int) ([]product.Product, int) {
+	// an extra product tells whether there is a following page
+	products := c.storage.List(cursor, limit+1)
+	if len(products) <= limit {
+		return products, 0
+	}
+
+	products = products[:limit]
+	return products, products[limit-1].PID
+}
+
+// Import method stores the package sizes sets of many products on behalf of a caller
+// products whose latest version is the same are left unchanged, so importing the same catalogue again stores nothing
+// a dry run stores nothing either, reporting the versions the products would be stored as
+// products that can't be stored are reported as failed, the following ones being imported all the same
+func (c Configurator) Import(ctx context.Context, products []product.Product, caller string, dryRun bool) []product.ImportResult {
+	results := make([]product.ImportResult, len(products))
+	stored, failed := 0, 0
+	for i, prd := range products {
+		// products without any version are stored as their first one
+		current, err := c.storage.Product(prd.PID)
+		if err == nil && sameConfiguration(current, prd) {
+			results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportUnchanged, Version: current.Version}
+			continue
+		}
+
+		if dryRun {
+			stored++
+			results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportStored, Version: current.Version + 1}
+			continue
+		}
+
+		rev, err := c.Update(ctx, prd, caller)
+		if err != nil {
+			failed++
+			results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportFailed, Version: current.Version, Err: err}
+			continue
+		}
+		stored++
+		results[i] = product.ImportResult{PID: prd.PID, Status: product.ImportStored, Version: rev.Product.Version}
+	}
+	instrumentation.ContextLogger(ctx).Info("Products imported", "products", len(products), "stored", stored, "failed", failed, "dry_run", dryRun, "caller", caller)
+
+	return results
+}
+
+// sameConfiguration checks whether two products have the same package sizes, costs and packaging levels
+func sameConfiguration(a, b product.Product) bool {
+	return slices.Equal(a.Packs, b.Packs) && slices.Equal(a.Costs, b.Costs) && slices.Equal(a.Containers, b.Containers)
+}
@@ -0,0 +1,229 @@
+package product
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+// catalogueStorage keeps the latest version of every product, as needed to list and import catalogues
+// every stored version takes the generation after any other, and storing the unavailable product fails as a storage failure
+type catalogueStorage struct {
+	latest      map[int]product.Product
+	stored      *[]product.Revision
+	unavailable int
+}
+
+func (m catalogueStorage) Product(pid int) (product.Product, error) {
+	prd, found := m.latest[pid]
+	if !found {
+		return product.Product{}, product.ErrProductNotFound
+	}
+	return prd, nil
+}
+
+func (m catalogueStorage) Revision(pid, version int) (product.Revision, error) {
+	return product.Revision{}, product.ErrVersionNotFound
+}
+
+func (m catalogueStorage) History(pid int) []product.Revision {
+	return nil
+}
+
+func (m catalogueStorage) Products() []product.Product {
+	return nil
+}
+
+func (m catalogueStorage) List(after, limit int) []product.Product {
+	products := []product.Product{}
+	for _, pid := range slices.Sorted(maps.Keys(m.latest)) {
+		if pid > after && len(products) < limit {
+			products = append(products, m.latest[pid])
+		}
+	}
+	return products
+}
+
+func (m catalogueStorage) Delete(pid int) error {
+	delete(m.latest, pid)
+	return nil
+}
+
+func (m catalogueStorage) CompareAndStore(rev product.Revision, generation int) (product.Revision, error) {
+	if m.latest[rev.Product.PID].Generation != generation {
+		return product.Revision{}, product.ErrVersionConflict
+	}
+	return m.Store(rev)
+}
+
+func (m catalogueStorage) Store(rev product.Revision) (product.Revision, error) {
+	if rev.Product.PID == m.unavailable {
+		return product.Revision{}, product.ErrStorageUnavailable
+	}
+	rev.Product.Version = m.latest[rev.Product.PID].Version + 1
+	for _, prd := range m.latest {
+		rev.Product.Generation = max(rev.Product.Generation, prd.Generation)
+	}
+	for _, stored := range *m.stored {
+		rev.Product.Generation = max(rev.Product.Generation, stored.Product.Generation)
+	}
+	rev.Product.Generation++
+	m.latest[rev.Product.PID] = rev.Product
+	*m.stored = append(*m.stored, rev)
+	return rev, nil
+}
+
+func TestExport(t *testing.T) {
+	storage := mockStorage{
+		products: []product.Product{
+			{PID: 1, Packs: []int{5, 10}, Version: 2},
+			{PID: 4, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}}, Version: 1},
+		},
+	}
+
+	res := NewConfigurator(storage).Export(context.Background())
+
+	assert.Equal(t, []product.Product{
+		{PID: 1, Packs: []int{5, 10}, Version: 2},
+		{PID: 4, Packs: []int{250, 500}, Costs: []int{3, 5}, Containers: []product.ContainerLevel{{Name: "carton", Capacity: 4}}, Version: 1},
+	}, res)
+}
+
+func TestList(t *testing.T) {
+	storage := catalogueStorage{
+		latest: map[int]product.Product{
+			1: {PID: 1, Packs: []int{5, 10}, Version: 2},
+			4: {PID: 4, Packs: []int{250, 500}, Version: 1},
+			9: {PID: 9, Packs: []int{23, 31}, Version: 1},
+		},
+	}
+
+	testCases := []struct {
+		desc         string
+		cursor       int
+		limit        int
+		expected     []product.Product
+		expectedNext int
+	}{
+		{
+			desc:  "first page",
+			limit: 2,
+			expected: []product.Product{
+				{PID: 1, Packs: []int{5, 10}, Version: 2},
+				{PID: 4, Packs: []int{250, 500}, Version: 1},
+			},
+			expectedNext: 4,
+		},
+		{
+			desc:   "last page",
+			cursor: 4,
+			limit:  2,
+			expected: []product.Product{
+				{PID: 9, Packs: []int{23, 31}, Version: 1},
+			},
+			expectedNext: 0,
+		},
+		{
+			desc:  "last page filled",
+			limit: 3,
+			expected: []product.Product{
+				{PID: 1, Packs: []int{5, 10}, Version: 2},
+				{PID: 4, Packs: []int{250, 500}, Version: 1},
+				{PID: 9, Packs: []int{23, 31}, Version: 1},
+			},
+			expectedNext: 0,
+		},
+		{
+			desc:         "past the last product",
+			cursor:       9,
+			limit:        2,
+			expected:     []product.Product{},
+			expectedNext: 0,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			res, next := NewConfigurator(storage).List(context.Background(), tC.cursor, tC.limit)
+			assert.Equal(t, tC.expected, res)
+			assert.Equal(t, tC.expectedNext, next)
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+	products := []product.Product{
+		{PID: 1, Packs: []int{5, 10}},
+		{PID: 2, Packs: []int{250, 500}, Costs: []int{3, 5}},
+		{PID: 3, Packs: []int{23, 31}},
+	}
+
+	testCases := []struct {
+		desc           string
+		dryRun         bool
+		unavailable    int
+		expected       []product.ImportResult
+		expectedStored []product.Revision
+	}{
+		{
+			desc: "new, changed and unchanged products",
+			expected: []product.ImportResult{
+				{PID: 1, Status: product.ImportUnchanged, Version: 2},
+				{PID: 2, Status: product.ImportStored, Version: 2},
+				{PID: 3, Status: product.ImportStored, Version: 1},
+			},
+			expectedStored: []product.Revision{
+				{Product: product.Product{PID: 2, Packs: []int{250, 500}, Costs: []int{3, 5}, Version: 2, Generation: 1}, Timestamp: timestamp, Caller: "seed"},
+				{Product: product.Product{PID: 3, Packs: []int{23, 31}, Version: 1, Generation: 2}, Timestamp: timestamp, Caller: "seed"},
+			},
+		},
+		{
+			desc:        "storage unavailable for a product",
+			unavailable: 2,
+			expected: []product.ImportResult{
+				{PID: 1, Status: product.ImportUnchanged, Version: 2},
+				{PID: 2, Status: product.ImportFailed, Version: 1, Err: product.ErrStorageUnavailable},
+				{PID: 3, Status: product.ImportStored, Version: 1},
+			},
+			expectedStored: []product.Revision{
+				{Product: product.Product{PID: 3, Packs: []int{23, 31}, Version: 1, Generation: 1}, Timestamp: timestamp, Caller: "seed"},
+			},
+		},
+		{
+			desc:   "dry run",
+			dryRun: true,
+			expected: []product.ImportResult{
+				{PID: 1, Status: product.ImportUnchanged, Version: 2},
+				{PID: 2, Status: product.ImportStored, Version: 2},
+				{PID: 3, Status: product.ImportStored, Version: 1},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var stored []product.Revision
+			storage := catalogueStorage{
+				latest: map[int]product.Product{
+					1: {PID: 1, Packs: []int{5, 10}, Version: 2},
+					2: {PID: 2, Packs: []int{250, 500}, Version: 1},
+				},
+				stored:      &stored,
+				unavailable: tC.unavailable,
+			}
+
+			cfg := NewConfigurator(storage)
+			cfg.now = func() time.Time { return timestamp }
+			res := cfg.Import(context.Background(), products, "seed", tC.dryRun)
+
+			assert.Equal(t, tC.expected, res)
+			assert.Equal(t, tC.expectedStored, stored)
+		})
+	}
+}
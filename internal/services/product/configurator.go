@@ -3,42 +3,179 @@ package product
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
 )
 
-// Storage provides storage access to products package sizes
+// Storage provides storage access to products package sizes and their versions
 type Storage interface {
-	PackSizes(int) ([]int, error)
-	Store(int, []int)
+	Product(int) (product.Product, error)
+	Revision(int, int) (product.Revision, error)
+	History(int) []product.Revision
+	Products() []product.Product
+	List(int, int) []product.Product
+	Store(product.Revision) (product.Revision, error)
+	CompareAndStore(product.Revision, int) (product.Revision, error)
+	Delete(int) error
+}
+
+// Invalidator drops whatever was derived from the previous package sizes of a product
+type Invalidator interface {
+	Invalidate(pid int)
 }
 
 // Configurator provides the products package sizes management service
 type Configurator struct {
-	storage Storage
+	storage     Storage
+	invalidator Invalidator
+	now         func() time.Time
 }
 
 // NewConfigurator returns an initialized Configurator
 func NewConfigurator(storage Storage) Configurator {
 	return Configurator{
 		storage: storage,
+		now:     time.Now,
 	}
 }
 
-// PackSizes method retrieves the package sizes set of a given product
+// WithInvalidator method returns a copy of the Configurator invalidating a product every time new package sizes are stored
+func (c Configurator) WithInvalidator(invalidator Invalidator) Configurator {
+	c.invalidator = invalidator
+	return c
+}
+
+// PackSizes method retrieves the latest package sizes set of a given product
 func (c Configurator) PackSizes(ctx context.Context, pid int) (product.Product, error) {
-	packsizes, err := c.storage.PackSizes(pid)
+	prd, err := c.storage.Product(pid)
 	if err != nil {
 		return product.Product{}, err
 	}
 
 	return product.Product{
-		PID:   pid,
-		Packs: packsizes,
+		PID:        pid,
+		Packs:      prd.Packs,
+		Costs:      prd.Costs,
+		Containers: prd.Containers,
+		Version:    prd.Version,
+		Generation: prd.Generation,
 	}, nil
 }
 
-// Update method stores a new package sizes set for a given product
-func (c Configurator) Update(ctx context.Context, pid int, packsizes []int) {
-	c.storage.Store(pid, packsizes)
+// Update method stores a new package sizes set version for a given product on behalf of a caller
+func (c Configurator) Update(ctx context.Context, prd product.Product, caller string) (product.Revision, error) {
+	rev, err := c.storage.Store(product.Revision{
+		Product:   prd,
+		Timestamp: c.now().UTC(),
+		Caller:    caller,
+	})
+	if err != nil {
+		return product.Revision{}, err
+	}
+	c.stored(ctx, rev)
+
+	return rev, nil
+}
+
+// UpdateIf method stores a new package sizes set version for a given product on behalf of a caller, only when its latest generation satisfies a precondition
+// the version is stored only if the latest generation is still the one checked, so that concurrent changes are never overwritten
+// it fails with product.ErrVersionConflict when the latest generation doesn't satisfy the precondition
+func (c Configurator) UpdateIf(ctx context.Context, prd product.Product, caller string, precondition product.Precondition) (product.Revision, error) {
+	for {
+		current := 0
+		latest, err := c.storage.Product(prd.PID)
+		if err == nil {
+			current = latest.Generation
+		}
+		if !precondition.Matches(current) {
+			return product.Revision{}, product.ErrVersionConflict
+		}
+
+		rev, err := c.storage.CompareAndStore(product.Revision{
+			Product:   prd,
+			Timestamp: c.now().UTC(),
+			Caller:    caller,
+		}, current)
+		if errors.Is(err, product.ErrVersionConflict) {
+			// another version was stored meanwhile, which may satisfy the precondition as well
+			continue
+		}
+		if err != nil {
+			return product.Revision{}, err
+		}
+		c.stored(ctx, rev)
+
+		return rev, nil
+	}
+}
+
+// stored invalidates and logs a newly stored package sizes set version
+func (c Configurator) stored(ctx context.Context, rev product.Revision) {
+	if c.invalidator != nil {
+		c.invalidator.Invalidate(rev.Product.PID)
+	}
+	instrumentation.ContextLogger(ctx).Info("Package sizes stored", "pid", rev.Product.PID, "version", rev.Product.Version, "caller", rev.Caller)
+}
+
+// Delete method removes all package sizes set versions of a given product on behalf of a caller
+func (c Configurator) Delete(ctx context.Context, pid int, caller string) error {
+	err := c.storage.Delete(pid)
+	if err != nil {
+		return err
+	}
+	if c.invalidator != nil {
+		c.invalidator.Invalidate(pid)
+	}
+	instrumentation.ContextLogger(ctx).Info("Package sizes deleted", "pid", pid, "caller", caller)
+
+	return nil
+}
+
+// History method retrieves all package sizes set versions of a given product, from the oldest to the latest
+func (c Configurator) History(ctx context.Context, pid int) []product.Revision {
+	return c.storage.History(pid)
+}
+
+// Version method retrieves a given package sizes set version of a product
+func (c Configurator) Version(ctx context.Context, pid, version int) (product.Revision, error) {
+	return c.storage.Revision(pid, version)
+}
+
+// Restore method stores a previous package sizes set version of a product as its new latest version on behalf of a caller
+func (c Configurator) Restore(ctx context.Context, pid, version int, caller string) (product.Revision, error) {
+	prd, err := c.restored(pid, version)
+	if err != nil {
+		return product.Revision{}, err
+	}
+
+	return c.Update(ctx, prd, caller)
+}
+
+// RestoreIf method stores a previous package sizes set version of a product as its new latest version on behalf of a caller, only when its latest generation satisfies a precondition
+// it fails with product.ErrVersionConflict when the latest generation doesn't satisfy the precondition
+func (c Configurator) RestoreIf(ctx context.Context, pid, version int, caller string, precondition product.Precondition) (product.Revision, error) {
+	prd, err := c.restored(pid, version)
+	if err != nil {
+		return product.Revision{}, err
+	}
+
+	return c.UpdateIf(ctx, prd, caller, precondition)
+}
+
+// restored returns the package sizes set of a previous version of a product, to be stored again
+func (c Configurator) restored(pid, version int) (product.Product, error) {
+	rev, err := c.storage.Revision(pid, version)
+	if err != nil {
+		return product.Product{}, err
+	}
+
+	return product.Product{
+		PID:        pid,
+		Packs:      rev.Product.Packs,
+		Costs:      rev.Product.Costs,
+		Containers: rev.Product.Containers,
+	}, nil
 }
@@ -1,33 +1,84 @@
 package product
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockStorage struct {
-	calledPackSizes *bool
-	calledStore     *bool
-	pid             *int
-	packs           *[]int
-	response        []int
-	err             error
+	calledProduct  *bool
+	calledStore    *bool
+	calledRevision *bool
+	pid            *int
+	version        *int
+	product        *product.Product
+	response       product.Product
+	revision       product.Revision
+	history        []product.Revision
+	products       []product.Product
+	err            error
 }
 
-func (m mockStorage) PackSizes(pid int) ([]int, error) {
-	*m.calledPackSizes = true
+func (m mockStorage) Product(pid int) (product.Product, error) {
+	*m.calledProduct = true
 	*m.pid = pid
 	return m.response, m.err
 }
 
-func (m mockStorage) Store(pid int, packs []int) {
-	*m.calledStore = true
+func (m mockStorage) Revision(pid, version int) (product.Revision, error) {
+	*m.calledRevision = true
+	*m.pid = pid
+	*m.version = version
+	return m.revision, m.err
+}
+
+func (m mockStorage) History(pid int) []product.Revision {
+	*m.pid = pid
+	return m.history
+}
+
+func (m mockStorage) Products() []product.Product {
+	return m.products
+}
+
+func (m mockStorage) List(after, limit int) []product.Product {
+	return m.products
+}
+
+func (m mockStorage) Delete(pid int) error {
 	*m.pid = pid
-	*m.packs = packs
+	return m.err
+}
+
+func (m mockStorage) Store(rev product.Revision) (product.Revision, error) {
+	*m.calledStore = true
+	*m.pid = rev.Product.PID
+	*m.product = rev.Product
+	if m.err != nil {
+		return product.Revision{}, m.err
+	}
+
+	rev.Product.Version = 3
+	return rev, nil
+}
+
+func (m mockStorage) CompareAndStore(rev product.Revision, generation int) (product.Revision, error) {
+	return m.Store(rev)
+}
+
+type mockInvalidator struct {
+	invalidated *[]int
+}
+
+func (m mockInvalidator) Invalidate(pid int) {
+	*m.invalidated = append(*m.invalidated, pid)
 }
 
 func TestPackSizes(t *testing.T) {
@@ -49,12 +100,12 @@ func TestPackSizes(t *testing.T) {
 		{
 			desc: "product not found",
 			storage: mockStorage{
-				calledPackSizes: &requestedPackSizes,
-				calledStore:     nil,
-				pid:             &requestedPID,
-				packs:           nil,
-				response:        nil,
-				err:             errors.New("error"),
+				calledProduct: &requestedPackSizes,
+				calledStore:   nil,
+				pid:           &requestedPID,
+				product:       nil,
+				response:      product.Product{},
+				err:           errors.New("error"),
 			},
 			pid:               1,
 			expectedPackSizes: true,
@@ -65,12 +116,15 @@ func TestPackSizes(t *testing.T) {
 		{
 			desc: "product found",
 			storage: mockStorage{
-				calledPackSizes: &requestedPackSizes,
-				calledStore:     nil,
-				pid:             &requestedPID,
-				packs:           nil,
-				response:        []int{5, 10, 12},
-				err:             nil,
+				calledProduct: &requestedPackSizes,
+				calledStore:   nil,
+				pid:           &requestedPID,
+				product:       nil,
+				response: product.Product{
+					PID:   1,
+					Packs: []int{5, 10, 12},
+				},
+				err: nil,
 			},
 			pid:               1,
 			expectedPackSizes: true,
@@ -81,6 +135,54 @@ func TestPackSizes(t *testing.T) {
 			},
 			expectedError: assert.NoError,
 		},
+		{
+			desc: "product with costs found",
+			storage: mockStorage{
+				calledProduct: &requestedPackSizes,
+				calledStore:   nil,
+				pid:           &requestedPID,
+				product:       nil,
+				response: product.Product{
+					PID:   1,
+					Packs: []int{5, 10, 12},
+					Costs: []int{7, 12, 13},
+				},
+				err: nil,
+			},
+			pid:               1,
+			expectedPackSizes: true,
+			expectedPID:       1,
+			expected: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+				Costs: []int{7, 12, 13},
+			},
+			expectedError: assert.NoError,
+		},
+		{
+			desc: "product with packaging levels found",
+			storage: mockStorage{
+				calledProduct: &requestedPackSizes,
+				calledStore:   nil,
+				pid:           &requestedPID,
+				product:       nil,
+				response: product.Product{
+					PID:        1,
+					Packs:      []int{5, 10, 12},
+					Containers: []product.ContainerLevel{{Name: "carton", Capacity: 20}, {Name: "pallet", Capacity: 40}},
+				},
+				err: nil,
+			},
+			pid:               1,
+			expectedPackSizes: true,
+			expectedPID:       1,
+			expected: product.Product{
+				PID:        1,
+				Packs:      []int{5, 10, 12},
+				Containers: []product.ContainerLevel{{Name: "carton", Capacity: 20}, {Name: "pallet", Capacity: 40}},
+			},
+			expectedError: assert.NoError,
+		},
 	}
 
 	for _, tC := range testCases {
@@ -101,35 +203,84 @@ func TestPackSizes(t *testing.T) {
 
 func TestUpdate(t *testing.T) {
 	var (
-		requestedUpdate bool
-		requestedPID    int
-		requestedPacks  []int
+		requestedUpdate  bool
+		requestedPID     int
+		requestedProduct product.Product
 	)
-	ctx := context.Background()
+	var logs bytes.Buffer
+	logger := instrumentation.NewLogger(instrumentation.LoggerConfig{Output: &logs}).With("request_id", "4f2a9c61d0b3e875")
+	ctx := instrumentation.WithLogger(context.Background(), logger)
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
 
 	testCases := []struct {
-		desc           string
-		storage        mockStorage
-		pid            int
-		packSizes      []int
-		expectedUpdate bool
-		expectedPID    int
-		expectedPacks  []int
+		desc                string
+		storage             mockStorage
+		product             product.Product
+		expectedUpdate      bool
+		expectedPID         int
+		expectedProduct     product.Product
+		expected            product.Revision
+		expectedInvalidated []int
+		expectedLog         string
+		expectedError       assert.ErrorAssertionFunc
 	}{
 		{
 			desc: "update success",
 			storage: mockStorage{
-				calledPackSizes: nil,
-				calledStore:     &requestedUpdate,
-				pid:             &requestedPID,
-				packs:           &requestedPacks,
-				response:        nil,
-			},
-			pid:            1,
-			packSizes:      []int{5, 10, 12},
+				calledProduct: nil,
+				calledStore:   &requestedUpdate,
+				pid:           &requestedPID,
+				product:       &requestedProduct,
+			},
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+				Costs: []int{7, 12, 13},
+			},
 			expectedUpdate: true,
 			expectedPID:    1,
-			expectedPacks:  []int{5, 10, 12},
+			expectedProduct: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+				Costs: []int{7, 12, 13},
+			},
+			expected: product.Revision{
+				Product: product.Product{
+					PID:     1,
+					Packs:   []int{5, 10, 12},
+					Costs:   []int{7, 12, 13},
+					Version: 3,
+				},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			},
+			expectedInvalidated: []int{1},
+			expectedLog:         `msg="Package sizes stored" request_id=4f2a9c61d0b3e875 pid=1 version=3 caller=tester`,
+			expectedError:       assert.NoError,
+		},
+		{
+			desc: "storage unavailable",
+			storage: mockStorage{
+				calledProduct: nil,
+				calledStore:   &requestedUpdate,
+				pid:           &requestedPID,
+				product:       &requestedProduct,
+				err:           product.ErrStorageUnavailable,
+			},
+			product: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+			},
+			expectedUpdate: true,
+			expectedPID:    1,
+			expectedProduct: product.Product{
+				PID:   1,
+				Packs: []int{5, 10, 12},
+			},
+			expected:            product.Revision{},
+			expectedInvalidated: nil,
+			expectedLog:         "",
+			expectedError:       assert.Error,
 		},
 	}
 
@@ -137,14 +288,354 @@ func TestUpdate(t *testing.T) {
 		t.Run(tC.desc, func(t *testing.T) {
 			requestedUpdate = false
 			requestedPID = 0
-			requestedPacks = nil
+			requestedProduct = product.Product{}
+			logs.Reset()
+			var invalidated []int
 
-			cfg := NewConfigurator(tC.storage)
-			cfg.Update(ctx, tC.pid, tC.packSizes)
+			cfg := NewConfigurator(tC.storage).WithInvalidator(mockInvalidator{invalidated: &invalidated})
+			cfg.now = func() time.Time { return timestamp }
+			res, err := cfg.Update(ctx, tC.product, "tester")
+			tC.expectedError(t, err)
+			assert.Equal(t, tC.expected, res)
 
 			assert.Equal(t, tC.expectedUpdate, requestedUpdate)
 			assert.Equal(t, tC.expectedPID, requestedPID)
-			assert.Equal(t, tC.expectedPacks, requestedPacks)
+			assert.Equal(t, tC.expectedProduct, requestedProduct)
+			assert.Equal(t, tC.expectedInvalidated, invalidated)
+			assert.Contains(t, logs.String(), tC.expectedLog)
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	var (
+		requestedRevision bool
+		requestedStore    bool
+		requestedPID      int
+		requestedVersion  int
+		requestedProduct  product.Product
+	)
+	ctx := context.Background()
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc          string
+		storage       mockStorage
+		version       int
+		expectedStore bool
+		expected      product.Revision
+		expectedError assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "version not found",
+			storage: mockStorage{
+				err: product.ErrVersionNotFound,
+			},
+			version:       5,
+			expectedStore: false,
+			expected:      product.Revision{},
+			expectedError: assert.Error,
+		},
+		{
+			desc: "version restored",
+			storage: mockStorage{
+				revision: product.Revision{
+					Product: product.Product{
+						PID:        1,
+						Packs:      []int{5, 10, 12},
+						Costs:      []int{7, 12, 13},
+						Containers: []product.ContainerLevel{{Name: "carton", Capacity: 20}},
+						Version:    1,
+					},
+					Timestamp: timestamp.Add(-time.Hour),
+					Caller:    "creator",
+				},
+			},
+			version:       1,
+			expectedStore: true,
+			expected: product.Revision{
+				Product: product.Product{
+					PID:        1,
+					Packs:      []int{5, 10, 12},
+					Costs:      []int{7, 12, 13},
+					Containers: []product.ContainerLevel{{Name: "carton", Capacity: 20}},
+					Version:    3,
+				},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			},
+			expectedError: assert.NoError,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedRevision = false
+			requestedStore = false
+			requestedPID = 0
+			requestedVersion = 0
+			tC.storage.calledRevision = &requestedRevision
+			tC.storage.calledStore = &requestedStore
+			tC.storage.pid = &requestedPID
+			tC.storage.version = &requestedVersion
+			tC.storage.product = &requestedProduct
+
+			cfg := NewConfigurator(tC.storage)
+			cfg.now = func() time.Time { return timestamp }
+			res, err := cfg.Restore(ctx, 1, tC.version, "tester")
+			tC.expectedError(t, err)
+			assert.Equal(t, tC.expected, res)
+
+			assert.True(t, requestedRevision)
+			assert.Equal(t, tC.version, requestedVersion)
+			assert.Equal(t, tC.expectedStore, requestedStore)
+			assert.Equal(t, 1, requestedPID)
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	var (
+		requestedPID int
+		invalidated  []int
+	)
+	ctx := context.Background()
+
+	testCases := []struct {
+		desc                string
+		storage             mockStorage
+		expectedInvalidated []int
+		expectedError       assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "product not found",
+			storage: mockStorage{
+				err: product.ErrProductNotFound,
+			},
+			expectedInvalidated: nil,
+			expectedError:       assert.Error,
+		},
+		{
+			desc:                "product deleted",
+			storage:             mockStorage{},
+			expectedInvalidated: []int{1},
+			expectedError:       assert.NoError,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedPID = 0
+			invalidated = nil
+			tC.storage.pid = &requestedPID
+
+			cfg := NewConfigurator(tC.storage).WithInvalidator(mockInvalidator{invalidated: &invalidated})
+			err := cfg.Delete(ctx, 1, "tester")
+			tC.expectedError(t, err)
+
+			assert.Equal(t, 1, requestedPID)
+			assert.Equal(t, tC.expectedInvalidated, invalidated)
+		})
+	}
+}
+
+// racingStorage stores a concurrent change of a product right before the first compare and store
+type racingStorage struct {
+	catalogueStorage
+	concurrent *product.Product
+}
+
+func (m racingStorage) CompareAndStore(rev product.Revision, generation int) (product.Revision, error) {
+	if m.concurrent.PID != 0 {
+		m.Store(product.Revision{Product: *m.concurrent, Caller: "concurrent"})
+		*m.concurrent = product.Product{}
+	}
+	return m.catalogueStorage.CompareAndStore(rev, generation)
+}
+
+func TestUpdateIf(t *testing.T) {
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc                string
+		latest              map[int]product.Product
+		concurrent          product.Product
+		precondition        product.Precondition
+		expected            product.Revision
+		expectedStored      []product.Revision
+		expectedInvalidated []int
+		expectedError       error
+	}{
+		{
+			desc:          "product not configured",
+			latest:        map[int]product.Product{},
+			precondition:  product.Precondition{Any: true},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:          "stale generation",
+			latest:        map[int]product.Product{1: {PID: 1, Packs: []int{5}, Version: 3, Generation: 6}},
+			precondition:  product.Precondition{Generations: []int{4}},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:          "product configured again since the given generation",
+			latest:        map[int]product.Product{1: {PID: 1, Packs: []int{5}, Version: 1, Generation: 6}},
+			precondition:  product.Precondition{Generations: []int{1}},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:         "matching generation",
+			latest:       map[int]product.Product{1: {PID: 1, Packs: []int{5}, Version: 3, Generation: 6}},
+			precondition: product.Precondition{Generations: []int{4, 6}},
+			expected: product.Revision{
+				Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 4, Generation: 7},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			},
+			expectedStored: []product.Revision{{
+				Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 4, Generation: 7},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			}},
+			expectedInvalidated: []int{1},
+		},
+		{
+			desc:         "concurrent change failing the precondition",
+			latest:       map[int]product.Product{1: {PID: 1, Packs: []int{5}, Version: 3, Generation: 6}},
+			concurrent:   product.Product{PID: 1, Packs: []int{7}},
+			precondition: product.Precondition{Generations: []int{6}},
+			expectedStored: []product.Revision{{
+				Product: product.Product{PID: 1, Packs: []int{7}, Version: 4, Generation: 7},
+				Caller:  "concurrent",
+			}},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:         "concurrent change satisfying the precondition",
+			latest:       map[int]product.Product{1: {PID: 1, Packs: []int{5}, Version: 3, Generation: 6}},
+			concurrent:   product.Product{PID: 1, Packs: []int{7}},
+			precondition: product.Precondition{Any: true},
+			expected: product.Revision{
+				Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 5, Generation: 8},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			},
+			expectedStored: []product.Revision{
+				{
+					Product: product.Product{PID: 1, Packs: []int{7}, Version: 4, Generation: 7},
+					Caller:  "concurrent",
+				},
+				{
+					Product:   product.Product{PID: 1, Packs: []int{5, 10}, Version: 5, Generation: 8},
+					Timestamp: timestamp,
+					Caller:    "tester",
+				},
+			},
+			expectedInvalidated: []int{1},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var (
+				stored      []product.Revision
+				invalidated []int
+			)
+			concurrent := tC.concurrent
+			storage := racingStorage{
+				catalogueStorage: catalogueStorage{latest: tC.latest, stored: &stored},
+				concurrent:       &concurrent,
+			}
+
+			cfg := NewConfigurator(storage).WithInvalidator(mockInvalidator{invalidated: &invalidated})
+			cfg.now = func() time.Time { return timestamp }
+			res, err := cfg.UpdateIf(context.Background(), product.Product{PID: 1, Packs: []int{5, 10}}, "tester", tC.precondition)
+
+			assert.ErrorIs(t, err, tC.expectedError)
+			assert.Equal(t, tC.expected, res)
+			assert.Equal(t, tC.expectedStored, stored)
+			assert.Equal(t, tC.expectedInvalidated, invalidated)
+		})
+	}
+}
+
+// previousStorage keeps the previous versions of products along with their latest ones, so that they can be restored
+type previousStorage struct {
+	catalogueStorage
+	previous []product.Revision
+}
+
+func (m previousStorage) Revision(pid, version int) (product.Revision, error) {
+	for _, rev := range m.previous {
+		if rev.Product.PID == pid && rev.Product.Version == version {
+			return rev, nil
+		}
+	}
+	return product.Revision{}, product.ErrVersionNotFound
+}
+
+func TestRestoreIf(t *testing.T) {
+	timestamp := time.Date(2025, 11, 10, 2, 26, 35, 0, time.UTC)
+
+	testCases := []struct {
+		desc           string
+		version        int
+		precondition   product.Precondition
+		expected       product.Revision
+		expectedStored []product.Revision
+		expectedError  error
+	}{
+		{
+			desc:          "version not found",
+			version:       5,
+			precondition:  product.Precondition{Generations: []int{6}},
+			expectedError: product.ErrVersionNotFound,
+		},
+		{
+			desc:          "stale generation",
+			version:       1,
+			precondition:  product.Precondition{Generations: []int{4}},
+			expectedError: product.ErrVersionConflict,
+		},
+		{
+			desc:         "matching generation",
+			version:      1,
+			precondition: product.Precondition{Generations: []int{6}},
+			expected: product.Revision{
+				Product:   product.Product{PID: 1, Packs: []int{5, 10}, Costs: []int{3, 5}, Version: 4, Generation: 7},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			},
+			expectedStored: []product.Revision{{
+				Product:   product.Product{PID: 1, Packs: []int{5, 10}, Costs: []int{3, 5}, Version: 4, Generation: 7},
+				Timestamp: timestamp,
+				Caller:    "tester",
+			}},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var stored []product.Revision
+			storage := previousStorage{
+				catalogueStorage: catalogueStorage{
+					latest: map[int]product.Product{1: {PID: 1, Packs: []int{5}, Version: 3, Generation: 6}},
+					stored: &stored,
+				},
+				previous: []product.Revision{{
+					Product: product.Product{PID: 1, Packs: []int{5, 10}, Costs: []int{3, 5}, Version: 1, Generation: 2},
+					Caller:  "creator",
+				}},
+			}
+
+			cfg := NewConfigurator(storage)
+			cfg.now = func() time.Time { return timestamp }
+			res, err := cfg.RestoreIf(context.Background(), 1, tC.version, "tester", tC.precondition)
+
+			assert.ErrorIs(t, err, tC.expectedError)
+			assert.Equal(t, tC.expected, res)
+			assert.Equal(t, tC.expectedStored, stored)
 		})
 	}
 }
@@ -0,0 +1,50 @@
+// Package stock handles services for packages stock management
+package stock
+
+import (
+	"context"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/ftfmtavares/shipping-optimizer/internal/instrumentation"
+)
+
+// Storage provides storage access to products packages stock
+type Storage interface {
+	Stock(int) (product.Stock, error)
+	Store(product.Stock)
+	Decrement(product.Stock) (product.Stock, error)
+}
+
+// Inventory provides the products packages stock management service
+type Inventory struct {
+	storage Storage
+}
+
+// NewInventory returns an initialized Inventory
+func NewInventory(storage Storage) Inventory {
+	return Inventory{
+		storage: storage,
+	}
+}
+
+// Stock method retrieves the packages stock of a given product
+func (i Inventory) Stock(ctx context.Context, pid int) (product.Stock, error) {
+	return i.storage.Stock(pid)
+}
+
+// Set method replaces the packages stock of a given product
+func (i Inventory) Set(ctx context.Context, stk product.Stock) {
+	i.storage.Store(stk)
+	instrumentation.ContextLogger(ctx).Info("Stock set", "pid", stk.PID)
+}
+
+// Decrement method removes the given packages from the stock of a product
+func (i Inventory) Decrement(ctx context.Context, stk product.Stock) (product.Stock, error) {
+	res, err := i.storage.Decrement(stk)
+	if err != nil {
+		return product.Stock{}, err
+	}
+	instrumentation.ContextLogger(ctx).Info("Stock decremented", "pid", stk.PID)
+
+	return res, nil
+}
@@ -0,0 +1,184 @@
+package stock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ftfmtavares/shipping-optimizer/internal/domain/product"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockStorage struct {
+	calledStock     *bool
+	calledStore     *bool
+	calledDecrement *bool
+	stock           *product.Stock
+	response        product.Stock
+	err             error
+}
+
+func (m mockStorage) Stock(pid int) (product.Stock, error) {
+	*m.calledStock = true
+	*m.stock = product.Stock{PID: pid}
+	return m.response, m.err
+}
+
+func (m mockStorage) Store(stk product.Stock) {
+	*m.calledStore = true
+	*m.stock = stk
+}
+
+func (m mockStorage) Decrement(stk product.Stock) (product.Stock, error) {
+	*m.calledDecrement = true
+	*m.stock = stk
+	return m.response, m.err
+}
+
+func TestStock(t *testing.T) {
+	var (
+		requestedStock bool
+		requested      product.Stock
+	)
+	ctx := context.Background()
+
+	testCases := []struct {
+		desc          string
+		storage       mockStorage
+		pid           int
+		expected      product.Stock
+		expectedError assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "stock not found",
+			storage: mockStorage{
+				calledStock: &requestedStock,
+				stock:       &requested,
+				err:         errors.New("error"),
+			},
+			pid:           1,
+			expected:      product.Stock{},
+			expectedError: assert.Error,
+		},
+		{
+			desc: "stock found",
+			storage: mockStorage{
+				calledStock: &requestedStock,
+				stock:       &requested,
+				response: product.Stock{
+					PID:    1,
+					Levels: map[int]int{5: 10},
+				},
+			},
+			pid: 1,
+			expected: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 10},
+			},
+			expectedError: assert.NoError,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedStock = false
+			requested = product.Stock{}
+
+			inv := NewInventory(tC.storage)
+			res, err := inv.Stock(ctx, tC.pid)
+			tC.expectedError(t, err)
+			assert.Equal(t, tC.expected, res)
+
+			assert.True(t, requestedStock)
+			assert.Equal(t, tC.pid, requested.PID)
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	var (
+		requestedStore bool
+		requested      product.Stock
+	)
+	ctx := context.Background()
+
+	stk := product.Stock{
+		PID:    1,
+		Levels: map[int]int{5: 10, 10: 2},
+	}
+
+	inv := NewInventory(mockStorage{
+		calledStore: &requestedStore,
+		stock:       &requested,
+	})
+	inv.Set(ctx, stk)
+
+	assert.True(t, requestedStore)
+	assert.Equal(t, stk, requested)
+}
+
+func TestDecrement(t *testing.T) {
+	var (
+		requestedDecrement bool
+		requested          product.Stock
+	)
+	ctx := context.Background()
+
+	testCases := []struct {
+		desc          string
+		storage       mockStorage
+		decrement     product.Stock
+		expected      product.Stock
+		expectedError assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "insufficient stock",
+			storage: mockStorage{
+				calledDecrement: &requestedDecrement,
+				stock:           &requested,
+				err:             product.ErrInsufficientStock,
+			},
+			decrement: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 11},
+			},
+			expected:      product.Stock{},
+			expectedError: assert.Error,
+		},
+		{
+			desc: "decrement success",
+			storage: mockStorage{
+				calledDecrement: &requestedDecrement,
+				stock:           &requested,
+				response: product.Stock{
+					PID:    1,
+					Levels: map[int]int{5: 9},
+				},
+			},
+			decrement: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 1},
+			},
+			expected: product.Stock{
+				PID:    1,
+				Levels: map[int]int{5: 9},
+			},
+			expectedError: assert.NoError,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			requestedDecrement = false
+			requested = product.Stock{}
+
+			inv := NewInventory(tC.storage)
+			res, err := inv.Decrement(ctx, tC.decrement)
+			tC.expectedError(t, err)
+			assert.Equal(t, tC.expected, res)
+
+			assert.True(t, requestedDecrement)
+			assert.Equal(t, tC.decrement, requested)
+		})
+	}
+}